@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
-	"fmt"
 	"github.com/redis/go-redis/v9"
 	"time"
 )
@@ -17,101 +16,111 @@ func sha1String(s string) string {
 }
 
 type LuaScript struct {
-	Script  string
-	Keys    []string
-	Args    []string
-	Default map[string]any
+	Script    string
+	Keys      []string
+	Args      []string
+	Default   map[string]any
+	CheckSlot bool // 集群模式下执行前校验所有 KEYS 是否在同一个 slot
+	// Idempotent 脚本重复执行结果不变, 只有幂等的脚本才会按 Retry 重试
+	Idempotent bool
+	Retry      *RetryPolicy  // 临时错误的重试策略, 只对 RedisClient.ExecScript 生效
+	Timeout    time.Duration // RedisClient.ExecScript 的超时时间, 和 RdSubCmd.Timeout 一样
+	Limit      *Limit        // 这个脚本的客户端限流, 和 Config.CmdLimits 中的 EVALSHA/EVAL 同时生效, 只对 RedisClient.ExecScript 生效
 }
 
 // 缓存Lua脚本到redis
 // return 给定脚本的 SHA1 校验和
 func (rdm RedisClient) ScriptLoad(ctx context.Context, lua string) string {
-	cmd := rdm.Client.ScriptLoad(ctx, lua)
-	return cmd.Val()
+	return rdm.Client.ScriptLoad(ctx, lua).Val()
 }
 
-// 这里还需要实验一下
+// EvalSha 用脚本的 sha1 执行, 脚本不存在的时候先加载再执行
 func (rdm RedisClient) EvalSha(ctx context.Context, lua string, keys []string, values []any) *redis.Cmd {
-	hesHasScript := sha1String(lua)
-	cmd := rdm.Client.EvalSha(ctx, hesHasScript, keys, values)
-	if cmd.Err() != nil {
-		if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
-			// 如果是没有 sha的报错需要重新load
-			rdm.ScriptLoad(ctx, lua)
-			cmd = rdm.Client.EvalSha(ctx, hesHasScript, keys, values)
-			return cmd
-		}
-	}
-	return cmd
+	return evalSha(ctx, rdm.Client, lua, keys, values)
 }
 
 func (rdm RedisClient) ExecScript(ctx context.Context, lua LuaScript, keyInfo map[string]string, valueInfo map[string]any) *redis.Cmd {
-	var defaultData map[string]any = make(map[string]any)
-	if len(lua.Default) > 0 {
-		defaultData = handlerDefaultValue(lua.Default)
-	}
-	var err error
-	keys := []string{}
-	if len(lua.Keys) > 0 {
-		keys, err = getValues(lua.Keys, keyInfo, defaultData)
-	}
-	values := []any{}
-	if len(lua.Args) > 0 {
-		values, err = getValues(lua.Args, valueInfo, defaultData)
+	ctx = withDefaultKeyPrefix(ctx, rdm.Config.KeyPrefix)
+	keys, values, err := renderScript(ctx, lua, keyInfo, valueInfo)
+	if err != nil {
+		return errScriptCmd(ctx, err)
 	}
+	release, err := rdm.limits.acquireScript(ctx, lua)
 	if err != nil {
-		cmd := redis.Cmd{}
-		cmd.SetErr(err)
-		return &cmd
+		return errScriptCmd(ctx, err)
 	}
-
-	return rdm.EvalSha(ctx, lua.Script, keys, values)
+	defer release()
+	ctx, cancel := withCmdTimeout(ctx, lua.Timeout, rdm.Config)
+	defer cancel()
+	var cmd *redis.Cmd
+	_, _ = retryFor(lua.Retry, lua.Idempotent).do(ctx, func() error {
+		cmd = rdm.EvalSha(ctx, lua.Script, keys, values)
+		return cmd.Err()
+	})
+	cmd.SetErr(ClassifyError(cmd.Err()))
+	return cmd
 }
 
 // PipeLine 的专属
 // 缓存Lua脚本到redis
 // return 给定脚本的 SHA1 校验和
 func (rdm RedisPipeline) ScriptLoad(ctx context.Context, lua string) string {
-	cmd := rdm.Client.ScriptLoad(ctx, lua)
-	return cmd.Val()
+	return rdm.Client.ScriptLoad(ctx, lua).Val()
 }
 
-// 这里还需要实验一下
+// EvalSha 加入 pipeline, Exec 之前拿不到结果, 所以脚本需要提前用 RedisClient.ScriptLoad 加载
 func (rdm RedisPipeline) EvalSha(ctx context.Context, lua string, keys []string, values []any) *redis.Cmd {
-	hesHasScript := sha1String(lua)
-	cmd := rdm.Client.EvalSha(ctx, hesHasScript, keys, values)
-	if cmd.Err() != nil {
-		if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
-			// 如果是没有 sha的报错需要重新load
-			rdm.ScriptLoad(ctx, lua)
-			cmd = rdm.Client.EvalSha(ctx, hesHasScript, keys, values)
-			return cmd
-		}
-	}
-	return cmd
+	return evalSha(ctx, rdm.Client, lua, keys, values)
 }
 
 func (rdm RedisPipeline) ExecScript(ctx context.Context, lua LuaScript, keyInfo map[string]string, valueInfo map[string]any) *redis.Cmd {
-	var defaultData map[string]any = make(map[string]any)
+	ctx = withDefaultKeyPrefix(ctx, rdm.keyPrefix)
+	keys, values, err := renderScript(ctx, lua, keyInfo, valueInfo)
+	if err != nil {
+		return errScriptCmd(ctx, err)
+	}
+	return rdm.EvalSha(ctx, lua.Script, keys, values)
+}
+
+// renderScript 按照 LuaScript 的定义取出 KEYS 和 ARGV, 没有的使用默认值, KEYS 加上前缀并按需校验 slot
+func renderScript(ctx context.Context, lua LuaScript, keyInfo map[string]string, valueInfo map[string]any) ([]string, []any, error) {
+	defaultData := map[string]any{}
 	if len(lua.Default) > 0 {
 		defaultData = handlerDefaultValue(lua.Default)
 	}
-	var err error
-	keys := []string{}
-	if len(lua.Keys) > 0 {
-		keys, err = getValues(lua.Keys, keyInfo, defaultData)
-	}
-	values := []any{}
-	if len(lua.Args) > 0 {
-		values, err = getValues(lua.Args, valueInfo, defaultData)
+	keys, err := getValues(lua.Keys, keyInfo, defaultData)
+	if err != nil {
+		return nil, nil, err
 	}
+	values, err := getValues(lua.Args, valueInfo, defaultData)
 	if err != nil {
-		cmd := redis.Cmd{}
-		cmd.SetErr(err)
-		return &cmd
+		return nil, nil, err
+	}
+	keys = prefixKeys(ctx, keys)
+	if lua.CheckSlot {
+		if err = checkSlots(keys); err != nil {
+			return nil, nil, err
+		}
 	}
+	return keys, values, nil
+}
 
-	return rdm.EvalSha(ctx, lua.Script, keys, values)
+// evalSha RedisClient 和 RedisPipeline 共用, 直接执行的时候遇到 NOSCRIPT 会加载脚本之后重新执行
+// pipeline 中命令还没有执行, 不会触发重新加载
+func evalSha(ctx context.Context, c redis.Scripter, lua string, keys []string, values []any) *redis.Cmd {
+	sha := sha1String(lua)
+	cmd := c.EvalSha(ctx, sha, keys, values)
+	if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+		c.ScriptLoad(ctx, lua)
+		cmd = c.EvalSha(ctx, sha, keys, values)
+	}
+	return cmd
+}
+
+func errScriptCmd(ctx context.Context, err error) *redis.Cmd {
+	cmd := redis.NewCmd(ctx)
+	cmd.SetErr(err)
+	return cmd
 }
 
 func handlerDefaultValue(data map[string]any) map[string]any {
@@ -132,7 +141,7 @@ func getValues[T string | any](keyNames []string, keyInfo map[string]T, defaultD
 			if dv, exit := defaultData[key]; exit {
 				keys = append(keys, dv.(T))
 			} else {
-				return nil, fmt.Errorf("key %s not found in default data", key)
+				return nil, &MissingParamError{Name: key}
 			}
 		}
 	}
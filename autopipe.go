@@ -0,0 +1,191 @@
+package rdb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AutoPipelineOptions 自动 pipeline 的参数
+type AutoPipelineOptions struct {
+	Window   time.Duration // 第一个命令到达之后最多等待多久再发送, 默认 100µs
+	MaxBatch int           // 攒够这么多命令立即发送, 默认 128
+}
+
+// AutoPipelineStats 自动 pipeline 的统计
+type AutoPipelineStats struct {
+	Batches  uint64 // 发送的 pipeline 数
+	Commands uint64 // 发送的命令数
+	Full     uint64 // 因为达到 MaxBatch 发送的 pipeline 数, 其余是窗口到期发送的
+	MaxSize  int    // 最大的一次 pipeline 的命令数
+}
+
+// AvgSize 平均每个 pipeline 的命令数
+func (s AutoPipelineStats) AvgSize() float64 {
+	if s.Batches == 0 {
+		return 0
+	}
+	return float64(s.Commands) / float64(s.Batches)
+}
+
+// autoPipeliner 收集多个 goroutine 同时执行的命令, 合并成一个 pipeline 发送
+type autoPipeliner struct {
+	client *RedisClient
+	opts   AutoPipelineOptions
+
+	mu      sync.Mutex
+	pending []*autoRequest
+	timer   *time.Timer
+	stats   AutoPipelineStats
+}
+
+type autoRequest struct {
+	cb   *CommandBuilder
+	done chan struct{}
+}
+
+// EnableAutoPipeline 开启自动 pipeline, 之后通过 builder (Handler、HGet、Set 等) 直接执行的命令
+// 会在 Window 时间内或者攒够 MaxBatch 个之后合并成一个 pipeline 发送, 调用方仍然阻塞到拿到自己的结果
+// 过期时间和 ReturnNilError 的处理与单独执行一致, RdSubCmd.Retry 不生效; 显式的 PipeLine/TxPipeLine、ExecScript 和 ExecuteCmd 不受影响
+// 调用方的 ctx 和 RdSubCmd.Timeout/Config.CmdTimeout 照常生效: 等待中超时或者取消的命令直接返回错误, 还没有发送的不再发送;
+// 每个批次使用其中最早的 deadline 发送
+// 需要在初始化的时候调用, 不要和命令并发
+//
+//	client.EnableAutoPipeline(rdb.AutoPipelineOptions{Window: 200 * time.Microsecond})
+func (rdm *RedisClient) EnableAutoPipeline(opts AutoPipelineOptions) {
+	if opts.Window <= 0 {
+		opts.Window = 100 * time.Microsecond
+	}
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = 128
+	}
+	rdm.DisableAutoPipeline()
+	rdm.autoPipe = &autoPipeliner{client: rdm, opts: opts}
+}
+
+// DisableAutoPipeline 关闭自动 pipeline, 已经在等待的命令会立即发送
+func (rdm *RedisClient) DisableAutoPipeline() {
+	ap := rdm.autoPipe
+	if ap == nil {
+		return
+	}
+	rdm.autoPipe = nil
+	ap.flushPending()
+}
+
+// AutoPipelineStats 返回自动 pipeline 的统计, 没有开启的时候为零值
+func (rdm *RedisClient) AutoPipelineStats() AutoPipelineStats {
+	if rdm.autoPipe == nil {
+		return AutoPipelineStats{}
+	}
+	rdm.autoPipe.mu.Lock()
+	defer rdm.autoPipe.mu.Unlock()
+	return rdm.autoPipe.stats
+}
+
+// do 把命令加入当前批次并等待发送完成
+// 批次中发送的是 cb 的副本, 调用方的 ctx 先结束的时候直接返回, 不会和发送中的批次同时修改 cb
+func (ap *autoPipeliner) do(cb *CommandBuilder) {
+	ctx, cancel := withCmdTimeout(cb.ctx, cb.cmd.CMD[cb.cmdName].Timeout, ap.client.Config)
+	defer cancel()
+	req := &autoRequest{cb: cb.detach(ctx), done: make(chan struct{})}
+	ap.mu.Lock()
+	ap.pending = append(ap.pending, req)
+	switch {
+	case len(ap.pending) >= ap.opts.MaxBatch:
+		batch := ap.take()
+		ap.stats.Full++
+		ap.mu.Unlock()
+		ap.flush(batch)
+	case len(ap.pending) == 1:
+		ap.timer = time.AfterFunc(ap.opts.Window, ap.flushPending)
+		ap.mu.Unlock()
+	default:
+		ap.mu.Unlock()
+	}
+	select {
+	case <-req.done:
+		cb.adopt(req.cb)
+	case <-ctx.Done():
+		ap.remove(req)
+		cb.fail(ClassifyError(ctx.Err()))
+	}
+}
+
+// remove 从等待中的批次里去掉 req, 已经在发送的不受影响
+func (ap *autoPipeliner) remove(req *autoRequest) {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	for i, r := range ap.pending {
+		if r == req {
+			ap.pending = append(ap.pending[:i], ap.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// detach 复制一个使用 ctx 的 CommandBuilder 交给批次执行, args 也复制一份, build 会往里面写默认参数
+func (cb *CommandBuilder) detach(ctx context.Context) *CommandBuilder {
+	args := make(map[string]any, len(cb.args))
+	for k, v := range cb.args {
+		args[k] = v
+	}
+	return &CommandBuilder{
+		client:      cb.client,
+		ctx:         ctx,
+		cmd:         cb.cmd,
+		cmdName:     cb.cmdName,
+		args:        args,
+		includeArgs: cb.includeArgs,
+	}
+}
+
+// adopt 批次执行完之后把副本的结果拿回来
+func (cb *CommandBuilder) adopt(src *CommandBuilder) {
+	cb.cmder = src.cmder
+	cb.done = src.done
+	cb.returnNil = src.returnNil
+	cb.expire = src.expire
+}
+
+// take 取出当前批次, 需要持有 mu
+func (ap *autoPipeliner) take() []*autoRequest {
+	batch := ap.pending
+	ap.pending = nil
+	if ap.timer != nil {
+		ap.timer.Stop()
+		ap.timer = nil
+	}
+	return batch
+}
+
+func (ap *autoPipeliner) flushPending() {
+	ap.mu.Lock()
+	batch := ap.take()
+	ap.mu.Unlock()
+	ap.flush(batch)
+}
+
+func (ap *autoPipeliner) flush(batch []*autoRequest) {
+	if len(batch) == 0 {
+		return
+	}
+	builders := make([]*CommandBuilder, len(batch))
+	for i, req := range batch {
+		builders[i] = req.cb
+	}
+	// 各个命令的 ctx 可能在别的调用方返回之后被取消, pipeline 本身不使用它们, 只使用其中最早的 deadline
+	// 限流的许可在各个调用方的 exec 中已经拿到, 这里不再限流
+	_ = ap.client.batch(context.Background(), builders, false)
+
+	ap.mu.Lock()
+	ap.stats.Batches++
+	ap.stats.Commands += uint64(len(batch))
+	if len(batch) > ap.stats.MaxSize {
+		ap.stats.MaxSize = len(batch)
+	}
+	ap.mu.Unlock()
+	for _, req := range batch {
+		close(req.done)
+	}
+}
@@ -0,0 +1,110 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrBoundElsewhere 传给 Batch 的 CommandBuilder 已经绑定到别的 client 或者 pipeline
+var ErrBoundElsewhere = errors.New("rdb: command builder is bound to another client or pipeline")
+
+// Batch 把还没有执行的 CommandBuilder 放到同一个 pipeline 中一次发送, 之后各个 CommandBuilder 的方法直接返回结果
+//
+//	name := client.HGet(ctx, UserCmd, args1)
+//	score := client.ZScore(ctx, RankCmd, args2)
+//	_ = client.Batch(ctx, name, score)
+//	name.String().Val(), score.Float().Val()
+//
+// 过期时间和 ReturnNilError 的处理与单独执行一致; 已经执行过的 CommandBuilder 会被跳过, 没有绑定的会使用当前 client 的 key 前缀
+// 绑定到别的 client (BindClient) 或者 pipeline (Bind、RedisPipeline 的方法) 的 CommandBuilder 不会被接管,
+// 这时返回 ErrBoundElsewhere, 所有命令都不会发送
+// pipeline 使用所有命令中最早的 deadline: ctx、各个命令自己的 ctx 以及 RdSubCmd.Timeout/Config.CmdTimeout
+// Config.CmdLimits/KeyLimits 和 RdSubCmd.Limit 同样生效: 每个命令消耗各自的 RPS, 并发数按 pipeline 计算, 拿不到许可的命令不发送
+// 返回第一个失败的命令的错误, 被 ReturnNilError 忽略的 redis.Nil 不算
+func (rdm *RedisClient) Batch(ctx context.Context, builders ...*CommandBuilder) error {
+	for i, cb := range builders {
+		if cb == nil || cb.IsExecuted() {
+			continue
+		}
+		if cb.pipeliner != nil || cb.client != nil && cb.client.Client != rdm.Client {
+			return fmt.Errorf("%w: builders[%d] %s", ErrBoundElsewhere, i, cb.cmdName)
+		}
+	}
+	return rdm.batch(ctx, builders, true)
+}
+
+// batch 执行 Batch, limit 为 false 的时候不限流, 自动 pipeline 的命令在各自的 exec 中已经拿到许可
+func (rdm *RedisClient) batch(ctx context.Context, builders []*CommandBuilder, limit bool) error {
+	var pending []*CommandBuilder
+	for _, cb := range builders {
+		if cb != nil && !cb.IsExecuted() {
+			pending = append(pending, cb)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	execCtx, cancel := batchContext(ctx, pending, rdm.Config)
+	defer cancel()
+	if limit {
+		release, errs := rdm.limits.acquireBatch(execCtx, pending)
+		defer release()
+		for i, err := range errs {
+			if err != nil {
+				pending[i].fail(err)
+			}
+		}
+	}
+
+	pipe := newPipeline(*rdm)
+	pipe.tracker.batch = true
+	queued := 0
+	for _, cb := range pending {
+		if cb.IsExecuted() {
+			continue
+		}
+		cb.ctx = withDefaultKeyPrefix(cb.ctx, rdm.Config.KeyPrefix)
+		cb.client = rdm
+		cb.pipeliner = pipe.Client
+		cb.tracker = pipe.tracker
+		cb.exec()
+		queued++
+	}
+	if queued > 0 {
+		_, _ = pipe.Exec(execCtx)
+	}
+	var first error
+	for _, cb := range pending {
+		// 这个 pipeline 已经执行完, 之后的 Exec/Bind 不能再指向它
+		cb.pipeliner, cb.tracker = nil, nil
+		if err := cb.cmder.Err(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// batchContext 返回 pipeline 使用的 ctx, deadline 取所有命令中最早的一个
+func batchContext(ctx context.Context, builders []*CommandBuilder, config Config) (context.Context, context.CancelFunc) {
+	var deadline time.Time
+	earliest := func(d time.Time) {
+		if deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	now := time.Now()
+	for _, cb := range builders {
+		if d, ok := cb.ctx.Deadline(); ok {
+			earliest(d)
+		}
+		if timeout := cmdTimeout(cb.cmd.CMD[cb.cmdName].Timeout, config); timeout > 0 {
+			earliest(now.Add(timeout))
+		}
+	}
+	if deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, deadline)
+}
@@ -0,0 +1,227 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCircuitOpen 熔断器打开, 命令没有发送到 redis
+var ErrCircuitOpen = errors.New("rdb: circuit breaker is open")
+
+// BreakerState 熔断器的状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行, 统计失败率
+	BreakerOpen                         // 直接返回 ErrCircuitOpen
+	BreakerHalfOpen                     // 放行少量探测请求, 成功之后关闭, 失败重新打开
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerOptions 熔断器的参数, 零值使用默认值
+type BreakerOptions struct {
+	Window         time.Duration               // 统计失败率的时间窗口, 默认 10s
+	MinRequests    int                         // 窗口内请求数达到这个值才判断失败率, 默认 20
+	FailureRate    float64                     // 失败率达到这个值打开, 默认 0.5
+	OpenTimeout    time.Duration               // 打开之后多久进入半开, 默认 5s
+	HalfOpenProbes int                         // 半开状态放行的探测请求数, 全部成功之后关闭, 默认 1
+	IsFailure      func(err error) bool        // 哪些错误算失败, 默认网络错误、超时和 LOADING/BUSY 等临时错误, 业务错误和 redis.Nil 不算
+	OnStateChange  func(from, to BreakerState) // 状态变化的回调, 不持有锁
+	Now            func() time.Time            // 当前时间, 测试的时候替换
+}
+
+// Breaker 熔断器, redis 不可用的时候快速失败, 避免每个请求都等到连接或者读写超时
+// 实现了 redis.Hook, 用 RedisClient.UseBreaker 接入之后 CommandBuilder、ExecuteCmd、pipeline、事务和 lua 脚本都会经过它
+// 也可以用 Do 包装任意的执行函数
+type Breaker struct {
+	opts BreakerOptions
+
+	mu          sync.Mutex
+	state       BreakerState
+	generation  int // 每次状态变化加一, 忽略状态变化之前发出的请求的结果
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int // 半开状态已经放行的探测请求
+	successes   int // 半开状态成功的探测请求
+}
+
+func NewBreaker(opts BreakerOptions) *Breaker {
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Second
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = 20
+	}
+	if opts.FailureRate <= 0 {
+		opts.FailureRate = 0.5
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = 5 * time.Second
+	}
+	if opts.HalfOpenProbes <= 0 {
+		opts.HalfOpenProbes = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = isBreakerFailure
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Breaker{opts: opts, windowStart: opts.Now()}
+}
+
+// isBreakerFailure 默认的失败判断, 说明 redis 本身不可用的错误
+func isBreakerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) || RetryTransient.Retryable(err)
+}
+
+// State 当前的状态, 打开超过 OpenTimeout 之后在下一个请求到来时才变成半开
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Do 熔断器允许的时候执行 fn 并记录结果, 否则直接返回 ErrCircuitOpen
+func (b *Breaker) Do(fn func() error) error {
+	done, err := b.allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err)
+	return err
+}
+
+// allow 判断是否放行, 放行的时候返回记录结果的函数
+func (b *Breaker) allow() (func(error), error) {
+	b.mu.Lock()
+	var changed []BreakerState
+	if b.state == BreakerOpen && b.opts.Now().Sub(b.openedAt) >= b.opts.OpenTimeout {
+		changed = b.setState(BreakerHalfOpen)
+	}
+	var err error
+	switch b.state {
+	case BreakerOpen:
+		err = ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probes >= b.opts.HalfOpenProbes {
+			err = ErrCircuitOpen
+		} else {
+			b.probes++
+		}
+	}
+	gen := b.generation
+	b.mu.Unlock()
+	b.notify(changed)
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) { b.done(gen, err) }, nil
+}
+
+func (b *Breaker) done(gen int, err error) {
+	failed := b.opts.IsFailure(err)
+	b.mu.Lock()
+	if gen != b.generation {
+		b.mu.Unlock()
+		return
+	}
+	var changed []BreakerState
+	switch b.state {
+	case BreakerClosed:
+		if now := b.opts.Now(); now.Sub(b.windowStart) >= b.opts.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.opts.MinRequests && float64(b.failures) >= b.opts.FailureRate*float64(b.requests) {
+			changed = b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		if failed {
+			changed = b.setState(BreakerOpen)
+		} else if b.successes++; b.successes >= b.opts.HalfOpenProbes {
+			changed = b.setState(BreakerClosed)
+		}
+	}
+	b.mu.Unlock()
+	b.notify(changed)
+}
+
+// setState 切换状态并清空统计, 需要持有 mu, 返回需要回调的 [from, to]
+func (b *Breaker) setState(to BreakerState) []BreakerState {
+	from := b.state
+	now := b.opts.Now()
+	b.state = to
+	b.generation++
+	b.windowStart, b.requests, b.failures = now, 0, 0
+	b.probes, b.successes = 0, 0
+	if to == BreakerOpen {
+		b.openedAt = now
+	}
+	return []BreakerState{from, to}
+}
+
+func (b *Breaker) notify(changed []BreakerState) {
+	if changed != nil && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(changed[0], changed[1])
+	}
+}
+
+func (b *Breaker) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (b *Breaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		return b.Do(func() error { return next(ctx, cmd) })
+	}
+}
+
+// ProcessPipelineHook pipeline 和事务作为一个请求统计, 打开的时候所有命令都设置 ErrCircuitOpen
+func (b *Breaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		done, err := b.allow()
+		if err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		err = next(ctx, cmds)
+		done(err)
+		return err
+	}
+}
+
+// UseBreaker 在 client 的执行路径上加入熔断器, 之后通过这个 client 执行的命令 (包括 pipeline 和 lua 脚本) 都受它控制
+// 熔断器作为 go-redis 的 hook 加入, 不能移除, 需要在初始化的时候调用
+func (rdm *RedisClient) UseBreaker(b *Breaker) {
+	rdm.Client.AddHook(b)
+	rdm.Breaker = b
+}
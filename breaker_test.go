@@ -0,0 +1,138 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeClock 可以手动推进的时钟
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestBreaker_States(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var changes []string
+	b := NewBreaker(BreakerOptions{
+		MinRequests:    4,
+		FailureRate:    0.5,
+		OpenTimeout:    time.Second,
+		HalfOpenProbes: 2,
+		Now:            clock.Now,
+		OnStateChange:  func(from, to BreakerState) { changes = append(changes, from.String()+"->"+to.String()) },
+	})
+	fail := func() error { return io.EOF }
+	ok := func() error { return nil }
+	calls := 0
+	counted := func(fn func() error) func() error {
+		return func() error { calls++; return fn() }
+	}
+
+	// 业务错误不算失败
+	for i := 0; i < 4; i++ {
+		_ = b.Do(func() error { return redis.Nil })
+	}
+	_ = b.Do(fail)
+	_ = b.Do(ok)
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected closed, got %v", b.State())
+	}
+
+	// 新窗口内失败率达到 50% 打开
+	clock.Advance(11 * time.Second)
+	_ = b.Do(fail)
+	_ = b.Do(ok)
+	_ = b.Do(fail)
+	_ = b.Do(ok)
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected open, got %v", b.State())
+	}
+	if err := b.Do(counted(ok)); !errors.Is(err, ErrCircuitOpen) || calls != 0 {
+		t.Fatalf("open breaker should fail fast, got %v", err)
+	}
+
+	// 半开: 失败重新打开
+	clock.Advance(time.Second)
+	if err := b.Do(counted(fail)); !errors.Is(err, io.EOF) || calls != 1 || b.State() != BreakerOpen {
+		t.Fatalf("failed probe should reopen, got %v %v", err, b.State())
+	}
+
+	// 半开: 探测数量有限, 全部成功之后关闭
+	clock.Advance(time.Second)
+	done1, err1 := b.allow()
+	done2, err2 := b.allow()
+	if _, err := b.allow(); err1 != nil || err2 != nil || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected 2 probes, got %v %v %v", err1, err2, err)
+	}
+	done1(nil)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("expected half-open, got %v", b.State())
+	}
+	done2(nil)
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected closed, got %v", b.State())
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %s, want %s", i, changes[i], want[i])
+		}
+	}
+}
+
+func TestRedisClient_UseBreaker(t *testing.T) {
+	down := true
+	hook := &replyHook{reply: func(args []any) (any, error) {
+		if down {
+			return nil, io.EOF
+		}
+		return "v", nil
+	}}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	client := &RedisClient{Client: c}
+	client.setup()
+	// 熔断器要在 replyHook 之前加入, replyHook 不会调用下一个 hook
+	client.UseBreaker(NewBreaker(BreakerOptions{MinRequests: 2, OpenTimeout: time.Second, Now: clock.Now}))
+	c.AddHook(hook)
+	str := RdCmd{Key: "s:{{id}}", CMD: map[Command]RdSubCmd{GET: {}}}
+	ctx := context.Background()
+
+	client.Get(ctx, str, map[string]any{"id": 1}).Err()
+	client.Get(ctx, str, map[string]any{"id": 1}).Err()
+	if client.Breaker.State() != BreakerOpen {
+		t.Fatalf("expected open, got %v", client.Breaker.State())
+	}
+	hook.calls = nil
+	if err := client.Get(ctx, str, map[string]any{"id": 1}).Err(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if err := client.ExecScript(ctx, LuaScript{Script: "return 1"}, nil, nil).Err(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen from script, got %v", err)
+	}
+	pipe := client.PipeLine()
+	queued := pipe.Get(ctx, str, map[string]any{"id": 1})
+	queued.Exec(ctx)
+	if _, err := pipe.Exec(ctx); !errors.Is(err, ErrCircuitOpen) || !errors.Is(queued.String().Err(), ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen from pipeline, got %v", err)
+	}
+	if len(hook.calls) != 0 {
+		t.Errorf("nothing should be sent while open: %v", hook.calls)
+	}
+
+	down = false
+	clock.Advance(time.Second)
+	if v := client.Get(ctx, str, map[string]any{"id": 1}).String().Val(); v != "v" || client.Breaker.State() != BreakerClosed {
+		t.Errorf("probe should close the breaker, got %q %v", v, client.Breaker.State())
+	}
+}
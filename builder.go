@@ -3,6 +3,7 @@ package rdb
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -14,25 +15,54 @@ type RdSubCmd struct {
 	CmdName        string //真正的 命令名, 当这个存在的时候就不会使用上层map的key作为命令名; 作用是检出同一个key对于同一个命令的不同参数的应对
 	Params         string // 这里的数据 最后都会转化为 字符串数组， 数字也会变成字符串的， 一定要注意下
 	Exp            func() time.Duration
+	Expire         *ExpirePolicy  // 更丰富的过期策略, 设置之后 Exp 不再生效, 见 ExpirePolicy
+	ExpireTarget   ExpireTarget   // 过期时间设置在哪些 key 上, 默认是外层的 key, *STORE/RPOPLPUSH/SMOVE 用 ExpireTargetDest, MSET 用 ExpireTargetAll
+	AtomicExpire   bool           // 命令和过期时间在一次往返中原子执行, 避免命令成功之后设置过期时间失败导致 key 永不过期
+	ExpireStrict   bool           // 过期时间设置失败的时候作为命令的错误返回 (ErrExpireFailed), 默认只记录不影响命令
 	DefaultParams  map[string]any // 设置默认的参数
 	NoUseKey       bool           // 不使用外层的key
 	ReturnNilError bool           // 是否返回 redis的nil错误， 这个可以用来判断字段是不是在redis中， 批量操作的指令是不会有redis.nil错误的
+	Idempotent     bool           // 重复执行结果不变 (GET、SET、HSET 等), 只有幂等的命令才会按 Retry 重试
+	Retry          *RetryPolicy   // 临时错误的重试策略, 见 RetryPolicy
+	Timeout        time.Duration  // 直接执行的超时时间 (包括重试), 和调用方 ctx 的 deadline 取较短的, 没有设置的时候使用 Config.CmdTimeout
+	Limit          *Limit         // 这个 key 模板上这个子命令的客户端限流, 和 Config.CmdLimits/KeyLimits 同时生效
 }
 
 // RedisCmdBuilder 用于构建 Redis 命令的结构体
 type RdCmd struct {
 	Key string
 	CMD map[Command]RdSubCmd
+	// HashTag 集群 hash tag 的占位符名, 例如 "userId", key 中的 {{userId}} 会渲染成 {42}, 效果等同于直接写 {{{userId}}}
+	// 设置后会在发送前校验所有 key 是否在同一个 slot
+	HashTag   string
+	CheckSlot bool // 不使用 HashTag 的时候也可以单独打开 slot 校验
 }
 
-// Build 构造 Redis 命令参数
+// Build 构造 Redis 命令参数, 没有定义的子命令 panic
+// 缺少参数、过滤器出错和 slot 校验失败的时候不报错, 照常返回渲染的参数, 需要拿到错误的时候使用 BuildE
 func Build(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) ([]any, string, RdSubCmd) {
+	cmdArgs, keyStr, subCmd, err := build(ctx, cmd, cmdName, args, includeArgs...)
+	if errors.Is(err, ErrUnknownCommand) {
+		panic(err)
+	}
+	return cmdArgs, keyStr, subCmd
+}
+
+// BuildE 和 Build 一样, 出错的时候返回错误而不是 panic
+// 缺少参数 (*MissingParamError)、过滤器出错 (ErrFilter) 和 slot 校验失败 (ErrCrossSlot) 的时候参数依然会正常返回
+// 没有定义的子命令返回 ErrUnknownCommand, 参数只有命令名
+func BuildE(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) ([]any, string, RdSubCmd, error) {
+	return build(ctx, cmd, cmdName, args, includeArgs...)
+}
+
+// build 见 BuildE
+func build(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) ([]any, string, RdSubCmd, error) {
 	if args == nil {
 		args = map[string]any{}
 	}
 	subCmd, ok := cmd.CMD[cmdName]
 	if !ok {
-		panic(fmt.Errorf("unknown command: %s", cmdName))
+		return []any{string(cmdName)}, cmd.Key, subCmd, fmt.Errorf("%w: %s", ErrUnknownCommand, cmdName)
 	}
 	// 填充默认参数
 	for k, v := range subCmd.DefaultParams {
@@ -41,22 +71,36 @@ func Build(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any,
 		}
 	}
 
+	// 渲染失败的占位符原样保留, 参数照常返回, 命令带着第一个错误失败
+	var renderErr error
 	paramsStr := []any{}
 	if subCmd.Params != "" {
 		tempData := strings.Split(subCmd.Params, " ")
 		for _, v := range tempData {
-			paramsStr = append(paramsStr, string(highPerfReplace([]byte(v), args)))
+			param, err := highPerfReplace([]byte(v), args)
+			if renderErr == nil {
+				renderErr = err
+			}
+			paramsStr = append(paramsStr, string(param))
 		}
 	}
 
 	// 构造 key
 	keyStr := cmd.Key
 	if !subCmd.NoUseKey {
-		keyStr = string(highPerfReplace([]byte(cmd.Key), args))
+		key, err := highPerfReplace([]byte(hashTagTemplate(cmd)), args)
+		if renderErr == nil {
+			renderErr = err
+		}
+		keyStr = string(key)
 	}
 
-	// 构造参数
-	cmdArgs := []any{string(cmdName)}
+	// 构造参数, 设置了 CmdName 的时候使用真正的命令名
+	realName := cmdName
+	if subCmd.CmdName != "" {
+		realName = Command(subCmd.CmdName)
+	}
+	cmdArgs := []any{string(realName)}
 	if keyStr != "" {
 		cmdArgs = append(cmdArgs, keyStr)
 	}
@@ -64,15 +108,77 @@ func Build(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any,
 	if len(includeArgs) > 0 {
 		cmdArgs = append(cmdArgs, includeArgs...)
 	}
-	return cmdArgs, keyStr, subCmd
+
+	// 给所有 key 位置加上前缀, 返回的 key 也要保持一致
+	applyKeyPrefix(ctx, realName, cmdArgs)
+	if keyStr != "" {
+		keyStr = fmt.Sprint(cmdArgs[1])
+	}
+
+	if renderErr == nil {
+		renderErr = missingParam(cmd, subCmd, keyStr, paramsStr, args)
+	}
+	if renderErr != nil {
+		return cmdArgs, keyStr, subCmd, renderErr
+	}
+	if cmd.HashTag != "" || cmd.CheckSlot {
+		if err := checkCmdSlots(realName, cmdArgs); err != nil {
+			return cmdArgs, keyStr, subCmd, err
+		}
+	}
+	return cmdArgs, keyStr, subCmd, nil
+}
+
+// missingParam 渲染之后还留有占位符的时候, 用和 Explain 相同的规则找出第一个没有值的参数
+// 只有渲染结果中有 {{ 的时候才需要重新扫描模板
+func missingParam(cmd RdCmd, subCmd RdSubCmd, keyStr string, params []any, args map[string]any) error {
+	leftover := strings.Contains(keyStr, "{{")
+	for _, p := range params {
+		leftover = leftover || strings.Contains(p.(string), "{{")
+	}
+	if !leftover {
+		return nil
+	}
+	templates := []string{subCmd.Params}
+	if !subCmd.NoUseKey {
+		templates = append(templates, hashTagTemplate(cmd))
+	}
+	if names := unresolvedPlaceholders(templates, args); len(names) > 0 {
+		return &MissingParamError{Name: names[0]}
+	}
+	return nil
+}
+
+// hashTagTemplate 把 key 模板中 HashTag 对应的 {{name}} 换成 {{{name}}}
+func hashTagTemplate(cmd RdCmd) string {
+	if cmd.HashTag == "" || strings.Contains(cmd.Key, "{{{"+cmd.HashTag+"}}}") {
+		return cmd.Key
+	}
+	return strings.ReplaceAll(cmd.Key, "{{"+cmd.HashTag+"}}", "{{{"+cmd.HashTag+"}}}")
 }
 
-func highPerfReplace(template []byte, replacements map[string]any) []byte {
+// highPerfReplace 渲染模板中的占位符, 过滤器出错的占位符原样保留并返回第一个错误
+func highPerfReplace(template []byte, replacements map[string]any) ([]byte, error) {
 	var result []byte
-	buf := make([]byte, 0, 16)
+	var firstErr error
 
 	i := 0
 	for i < len(template) {
+		// {{{name}}} 是集群 hash tag 写法, 渲染成 {value}
+		if i+2 < len(template) && template[i] == '{' && template[i+1] == '{' && template[i+2] == '{' {
+			end := bytes.Index(template[i:], []byte("}}}"))
+			if end != -1 {
+				inner, err := highPerfReplace(template[i+1:i+end+2], replacements)
+				if firstErr == nil {
+					firstErr = err
+				}
+				result = append(result, '{')
+				result = append(result, inner...)
+				result = append(result, '}')
+				i += end + 3
+				continue
+			}
+		}
 		// 查找 '{{' 和 '}}' 分隔的占位符
 		if i+1 < len(template) && template[i] == '{' && template[i+1] == '{' {
 			end := bytes.Index(template[i:], []byte("}}"))
@@ -81,42 +187,25 @@ func highPerfReplace(template []byte, replacements map[string]any) []byte {
 				break
 			}
 			key := string(template[i+2 : i+end])
-			if val, found := replacements[key]; found {
-				// 根据类型进行处理
-				switch v := val.(type) {
-				case string:
-					result = append(result, []byte(v)...)
-				case int:
-					result = append(result, []byte(strconv.Itoa(v))...)
-				case int64:
-					result = append(result, []byte(strconv.FormatInt(v, 10))...)
-				case int32:
-					result = append(result, []byte(strconv.FormatInt(int64(v), 10))...)
-				case float64:
-					result = append(result, strconv.AppendFloat(buf[:0], float64(v), 'f', -1, 64)...)
-				case float32:
-					result = append(result, strconv.AppendFloat(buf[:0], float64(v), 'f', -1, 64)...)
-				case bool:
-					result = append(result, []byte(strconv.FormatBool(v))...)
-				case []int:
-					result = append(result, []byte(IntSliceToString(v, " "))...)
-				case []int64:
-					result = append(result, []byte(IntSliceToString(v, " "))...)
-				case []int32:
-					result = append(result, []byte(IntSliceToString(v, " "))...)
-				case []string:
-					result = append(result, []byte(StringSliceToString(v, " "))...)
-				case []float32:
-					result = append(result, []byte(FloatSliceToString(v, " ", -1))...)
-				case []float64:
-					result = append(result, []byte(FloatSliceToString(v, " ", -1))...)
-				default:
-					// 如果类型不匹配，保留原始占位符
-					result = append(result, []byte(fmt.Sprintf("{{%s}}", key))...)
+			// {{name|filter:arg}} 带过滤器的占位符
+			key, filterSpec, hasFilter := strings.Cut(key, "|")
+			val, found := replacements[key]
+			if found && hasFilter {
+				var err error
+				if val, err = applyFilters(val, filterSpec); err != nil {
+					found = false
+					if firstErr == nil {
+						firstErr = fmt.Errorf("%w: {{%s|%s}}: %w", ErrFilter, key, filterSpec, err)
+					}
 				}
-			} else {
-				// 如果没有找到对应的值，则保留原始占位符
-				result = append(result, template[i:i+end+4]...)
+			}
+			appended := false
+			if found {
+				result, appended = appendValue(result, val)
+			}
+			if !appended {
+				// 如果没有找到对应的值或者类型不匹配，则保留原始占位符
+				result = append(result, template[i:i+end+2]...)
 			}
 			i += end + 2 // 跳过 '}}'
 		} else {
@@ -124,7 +213,82 @@ func highPerfReplace(template []byte, replacements map[string]any) []byte {
 			i++
 		}
 	}
-	return result
+	return result, firstErr
+}
+
+// appendValue 根据类型把值追加到 result, 不支持的类型返回 false
+func appendValue(result []byte, val any) ([]byte, bool) {
+	switch v := val.(type) {
+	case string:
+		result = append(result, v...)
+	case int:
+		result = strconv.AppendInt(result, int64(v), 10)
+	case int64:
+		result = strconv.AppendInt(result, v, 10)
+	case int32:
+		result = strconv.AppendInt(result, int64(v), 10)
+	case float64:
+		result = strconv.AppendFloat(result, v, 'f', -1, 64)
+	case float32:
+		result = strconv.AppendFloat(result, float64(v), 'f', -1, 64)
+	case bool:
+		result = strconv.AppendBool(result, v)
+	case []int:
+		result = append(result, IntSliceToString(v, " ")...)
+	case []int64:
+		result = append(result, IntSliceToString(v, " ")...)
+	case []int32:
+		result = append(result, IntSliceToString(v, " ")...)
+	case []string:
+		result = append(result, StringSliceToString(v, " ")...)
+	case []float32:
+		result = append(result, FloatSliceToString(v, " ", -1)...)
+	case []float64:
+		result = append(result, FloatSliceToString(v, " ", -1)...)
+	default:
+		return result, false
+	}
+	return result, true
+}
+
+// Placeholders 返回模板中所有占位符的名字, 按出现顺序, 不去重
+// {{{name}}} 形式的 hash tag 也会返回 name, {{name|filter}} 只返回 name, 没有闭合的 {{ 会返回错误
+func Placeholders(template string) ([]string, error) {
+	specs, err := placeholderSpecs(template)
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		name, _, _ := strings.Cut(spec, "|")
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names, err
+}
+
+// placeholderSpecs 返回占位符 {{ }} 中的完整内容, 包含过滤器
+func placeholderSpecs(template string) ([]string, error) {
+	var specs []string
+	i := 0
+	for i < len(template) {
+		start := strings.Index(template[i:], "{{")
+		if start == -1 {
+			break
+		}
+		start += i
+		open, closeTag := 2, "}}"
+		if strings.HasPrefix(template[start:], "{{{") && strings.Contains(template[start:], "}}}") {
+			open, closeTag = 3, "}}}"
+		}
+		end := strings.Index(template[start+open:], closeTag)
+		if end == -1 {
+			return specs, fmt.Errorf("unclosed placeholder at offset %d in %q", start, template)
+		}
+		spec := template[start+open : start+open+end]
+		if name, _, _ := strings.Cut(spec, "|"); strings.TrimSpace(name) == "" {
+			return specs, fmt.Errorf("empty placeholder at offset %d in %q", start, template)
+		}
+		specs = append(specs, spec)
+		i = start + open + end + len(closeTag)
+	}
+	return specs, nil
 }
 
 // 快速版本：[]int → string
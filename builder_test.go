@@ -1,7 +1,10 @@
 package rdb
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -18,8 +21,62 @@ func Test_highPerfReplace(t *testing.T) {
 	}
 
 	// 调用模板替换函数
-	result := highPerfReplace(template, replacements)
+	result, _ := highPerfReplace(template, replacements)
 
 	// 输出替换结果
 	fmt.Println(string(result))
 }
+
+func TestBuild_CmdName(t *testing.T) {
+	cmd := RdCmd{
+		Key: "user:{{userId}}",
+		CMD: map[Command]RdSubCmd{
+			"GET_NAME": {CmdName: "HGET", Params: "name"},
+			HGET:       {Params: "{{field}}"},
+		},
+	}
+	ctx := WithKeyPrefix(context.Background(), "app:")
+
+	// 设置了 CmdName 的时候发送真正的命令名, key 的位置也按真正的命令计算
+	cmdArgs, key, _ := Build(ctx, cmd, "GET_NAME", map[string]any{"userId": 1})
+	if want := []any{"HGET", "app:user:1", "name"}; !reflect.DeepEqual(cmdArgs, want) {
+		t.Errorf("got %v, want %v", cmdArgs, want)
+	}
+	if key != "app:user:1" {
+		t.Errorf("key got %s", key)
+	}
+
+	cmdArgs, _, _ = Build(ctx, cmd, HGET, map[string]any{"userId": 1, "field": "age"})
+	if want := []any{"HGET", "app:user:1", "age"}; !reflect.DeepEqual(cmdArgs, want) {
+		t.Errorf("got %v, want %v", cmdArgs, want)
+	}
+}
+
+func TestBuildE(t *testing.T) {
+	cmd := RdCmd{Key: "user:{{userId}}", CMD: map[Command]RdSubCmd{HGET: {Params: "{{field}}"}}}
+	ctx := context.Background()
+
+	// 缺少参数的时候 Build 照常返回渲染的参数, BuildE 返回错误
+	cmdArgs, _, _ := Build(ctx, cmd, HGET, map[string]any{"userId": 1})
+	if want := []any{"HGET", "user:1", "{{field}}"}; !reflect.DeepEqual(cmdArgs, want) {
+		t.Errorf("got %v, want %v", cmdArgs, want)
+	}
+	var missing *MissingParamError
+	if _, _, _, err := BuildE(ctx, cmd, HGET, map[string]any{"userId": 1}); !errors.As(err, &missing) || missing.Name != "field" {
+		t.Errorf("expected MissingParamError for field, got %v", err)
+	}
+	if _, _, _, err := BuildE(ctx, cmd, HGET, map[string]any{"userId": 1, "field": "age"}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// 没有定义的子命令 BuildE 返回错误, Build 依然 panic
+	if _, _, _, err := BuildE(ctx, cmd, GET, nil); !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("expected ErrUnknownCommand, got %v", err)
+	}
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrUnknownCommand) {
+			t.Errorf("expected panic with ErrUnknownCommand, got %v", err)
+		}
+	}()
+	Build(ctx, cmd, GET, nil)
+}
@@ -0,0 +1,322 @@
+package rdb
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Catalog 注册表中所有定义的快照, 用于审计服务用到了哪些 key、过期时间和命令
+// 可以导出成 Markdown/JSON, JSON 可以提交到仓库里, 代码评审的时候用 DiffCatalogs 对比 key 布局的变化
+type Catalog struct {
+	Cmds []CatalogCmd `json:"cmds"`
+	Luas []CatalogLua `json:"luas,omitempty"`
+}
+
+type CatalogCmd struct {
+	Name         string          `json:"name"`
+	Key          string          `json:"key"`
+	Placeholders []string        `json:"placeholders,omitempty"`
+	HashTag      string          `json:"hashTag,omitempty"`
+	SubCmds      []CatalogSubCmd `json:"subCmds"`
+}
+
+type CatalogSubCmd struct {
+	Name           string            `json:"name"` // RdCmd.CMD 的 key
+	CmdName        string            `json:"cmdName,omitempty"`
+	Params         string            `json:"params,omitempty"`
+	TTL            string            `json:"ttl,omitempty"`
+	ReturnNilError bool              `json:"returnNilError,omitempty"`
+	NoUseKey       bool              `json:"noUseKey,omitempty"`
+	DefaultParams  map[string]string `json:"defaultParams,omitempty"` // 统一转成字符串, 保证 JSON 往返之后对比结果稳定
+}
+
+type CatalogLua struct {
+	Name    string            `json:"name"`
+	Keys    []string          `json:"keys,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Default map[string]string `json:"default,omitempty"`
+	Script  string            `json:"script"` // 脚本内容的 sha1, 只用于发现脚本的变化
+}
+
+// Catalog 生成注册表的快照, 按名字排序
+func (r *Registry) Catalog() Catalog {
+	var c Catalog
+	for _, name := range r.CmdNames() {
+		c.Cmds = append(c.Cmds, catalogCmd(name, r.MustCmd(name)))
+	}
+	for _, name := range r.LuaNames() {
+		lua := r.MustLua(name)
+		sum := sha1.Sum([]byte(lua.Script))
+		c.Luas = append(c.Luas, CatalogLua{
+			Name:    name,
+			Keys:    lua.Keys,
+			Args:    lua.Args,
+			Default: stringDefaults(lua.Default),
+			Script:  hex.EncodeToString(sum[:]),
+		})
+	}
+	return c
+}
+
+func catalogCmd(name string, cmd RdCmd) CatalogCmd {
+	c := CatalogCmd{Name: name, Key: cmd.Key, HashTag: cmd.HashTag}
+	c.Placeholders, _ = Placeholders(cmd.Key)
+	for subName, sub := range cmd.CMD {
+		c.SubCmds = append(c.SubCmds, CatalogSubCmd{
+			Name:           string(subName),
+			CmdName:        sub.CmdName,
+			Params:         sub.Params,
+			TTL:            describeExpire(sub),
+			ReturnNilError: sub.ReturnNilError,
+			NoUseKey:       sub.NoUseKey,
+			DefaultParams:  stringDefaults(sub.DefaultParams),
+		})
+	}
+	sort.Slice(c.SubCmds, func(i, j int) bool { return c.SubCmds[i].Name < c.SubCmds[j].Name })
+	return c
+}
+
+func stringDefaults(defaults map[string]any) map[string]string {
+	if len(defaults) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(defaults))
+	for k, v := range defaults {
+		m[k] = formatValue(v)
+	}
+	return m
+}
+
+// describeExpire 过期策略的可读描述, 例如 "30s NX jitter=5s target=dest atomic"
+// 只有 ExpireIn 的固定时间输出具体值; 绝对时间输出 "at", Exp/ExpireInFunc 每次执行时计算, 输出 "func",
+// 导出的时候不调用它们, 这样同样的定义每次导出的结果相同
+func describeExpire(sub RdSubCmd) string {
+	p := sub.expirePolicy()
+	if p == nil {
+		return ""
+	}
+	var parts []string
+	if p.At != nil {
+		parts = append(parts, "at")
+	} else if p.fixed > 0 {
+		parts = append(parts, p.fixed.String())
+	} else if p.In != nil {
+		parts = append(parts, "func")
+	}
+	if p.Millis {
+		parts = append(parts, "millis")
+	}
+	if p.Cond != ExpireAlways {
+		parts = append(parts, string(p.Cond))
+	}
+	if p.Jitter > 0 {
+		parts = append(parts, "jitter="+p.Jitter.String())
+	}
+	if sub.ExpireTarget != ExpireTargetKey {
+		parts = append(parts, "target="+string(sub.ExpireTarget))
+	}
+	if sub.AtomicExpire {
+		parts = append(parts, "atomic")
+	}
+	if sub.ExpireStrict {
+		parts = append(parts, "strict")
+	}
+	return strings.Join(parts, " ")
+}
+
+// JSON 导出带缩进的 JSON, 可以用 json.Unmarshal 读回 Catalog
+func (c Catalog) JSON() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// Markdown 导出 Markdown 文档, 每个 RdCmd 一节, 子命令用表格列出
+func (c Catalog) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# Redis key catalog\n")
+	if len(c.Cmds) > 0 {
+		b.WriteString("\n## Commands\n")
+	}
+	for _, cmd := range c.Cmds {
+		fmt.Fprintf(&b, "\n### %s\n\n", cmd.Name)
+		fmt.Fprintf(&b, "- key: `%s`\n", cmd.Key)
+		if len(cmd.Placeholders) > 0 {
+			fmt.Fprintf(&b, "- placeholders: %s\n", strings.Join(cmd.Placeholders, ", "))
+		}
+		if cmd.HashTag != "" {
+			fmt.Fprintf(&b, "- hashTag: %s\n", cmd.HashTag)
+		}
+		b.WriteString("\n| sub command | cmdName | params | ttl | returnNilError | noUseKey | defaults |\n")
+		b.WriteString("|---|---|---|---|---|---|---|\n")
+		for _, sub := range cmd.SubCmds {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %s |\n",
+				mdCell(sub.Name), mdCell(sub.CmdName), mdCode(sub.Params), mdCell(sub.TTL),
+				mdBool(sub.ReturnNilError), mdBool(sub.NoUseKey), mdCell(formatDefaults(sub.DefaultParams)))
+		}
+	}
+	if len(c.Luas) > 0 {
+		b.WriteString("\n## Lua scripts\n\n")
+		b.WriteString("| name | keys | args | defaults | sha1 |\n")
+		b.WriteString("|---|---|---|---|---|\n")
+		for _, lua := range c.Luas {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n",
+				mdCell(lua.Name), mdCell(strings.Join(lua.Keys, ", ")), mdCell(strings.Join(lua.Args, ", ")),
+				mdCell(formatDefaults(lua.Default)), mdCode(lua.Script))
+		}
+	}
+	return b.String()
+}
+
+func mdCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+func mdCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + mdCell(s) + "`"
+}
+
+func mdBool(b bool) string {
+	if b {
+		return "yes"
+	}
+	return ""
+}
+
+// formatDefaults 按 key 排序输出 a=1, b=2
+func formatDefaults(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + m[k]
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CatalogChange 两个 Catalog 之间的一处差异
+type CatalogChange struct {
+	Kind  string `json:"kind"`            // added, removed, changed
+	Name  string `json:"name"`            // 例如 cmd UserWealth, cmd UserWealth.HSET, lua GetUser
+	Field string `json:"field,omitempty"` // changed 的时候是变化的字段
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+func (c CatalogChange) String() string {
+	if c.Kind == "changed" {
+		return fmt.Sprintf("changed %s %s: %q -> %q", c.Name, c.Field, c.Old, c.New)
+	}
+	return c.Kind + " " + c.Name
+}
+
+// DiffCatalogs 对比两个 Catalog, 返回按名字排序的差异, 没有差异时返回 nil
+func DiffCatalogs(old, new Catalog) []CatalogChange {
+	var changes []CatalogChange
+	oldCmds, newCmds := map[string]CatalogCmd{}, map[string]CatalogCmd{}
+	for _, cmd := range old.Cmds {
+		oldCmds[cmd.Name] = cmd
+	}
+	for _, cmd := range new.Cmds {
+		newCmds[cmd.Name] = cmd
+	}
+	for _, name := range unionNames(oldCmds, newCmds) {
+		o, inOld := oldCmds[name]
+		n, inNew := newCmds[name]
+		label := "cmd " + name
+		switch {
+		case !inOld:
+			changes = append(changes, CatalogChange{Kind: "added", Name: label})
+		case !inNew:
+			changes = append(changes, CatalogChange{Kind: "removed", Name: label})
+		default:
+			changes = diffField(changes, label, "key", o.Key, n.Key)
+			changes = diffField(changes, label, "hashTag", o.HashTag, n.HashTag)
+			changes = diffSubCmds(changes, label, o.SubCmds, n.SubCmds)
+		}
+	}
+
+	oldLuas, newLuas := map[string]CatalogLua{}, map[string]CatalogLua{}
+	for _, lua := range old.Luas {
+		oldLuas[lua.Name] = lua
+	}
+	for _, lua := range new.Luas {
+		newLuas[lua.Name] = lua
+	}
+	for _, name := range unionNames(oldLuas, newLuas) {
+		o, inOld := oldLuas[name]
+		n, inNew := newLuas[name]
+		label := "lua " + name
+		switch {
+		case !inOld:
+			changes = append(changes, CatalogChange{Kind: "added", Name: label})
+		case !inNew:
+			changes = append(changes, CatalogChange{Kind: "removed", Name: label})
+		default:
+			changes = diffField(changes, label, "keys", strings.Join(o.Keys, ", "), strings.Join(n.Keys, ", "))
+			changes = diffField(changes, label, "args", strings.Join(o.Args, ", "), strings.Join(n.Args, ", "))
+			changes = diffField(changes, label, "default", formatDefaults(o.Default), formatDefaults(n.Default))
+			changes = diffField(changes, label, "script", o.Script, n.Script)
+		}
+	}
+	return changes
+}
+
+func diffSubCmds(changes []CatalogChange, label string, old, new []CatalogSubCmd) []CatalogChange {
+	oldSubs, newSubs := map[string]CatalogSubCmd{}, map[string]CatalogSubCmd{}
+	for _, sub := range old {
+		oldSubs[sub.Name] = sub
+	}
+	for _, sub := range new {
+		newSubs[sub.Name] = sub
+	}
+	for _, name := range unionNames(oldSubs, newSubs) {
+		o, inOld := oldSubs[name]
+		n, inNew := newSubs[name]
+		subLabel := label + "." + name
+		switch {
+		case !inOld:
+			changes = append(changes, CatalogChange{Kind: "added", Name: subLabel})
+		case !inNew:
+			changes = append(changes, CatalogChange{Kind: "removed", Name: subLabel})
+		case !reflect.DeepEqual(o, n):
+			changes = diffField(changes, subLabel, "cmdName", o.CmdName, n.CmdName)
+			changes = diffField(changes, subLabel, "params", o.Params, n.Params)
+			changes = diffField(changes, subLabel, "ttl", o.TTL, n.TTL)
+			changes = diffField(changes, subLabel, "returnNilError", fmt.Sprint(o.ReturnNilError), fmt.Sprint(n.ReturnNilError))
+			changes = diffField(changes, subLabel, "noUseKey", fmt.Sprint(o.NoUseKey), fmt.Sprint(n.NoUseKey))
+			changes = diffField(changes, subLabel, "defaultParams", formatDefaults(o.DefaultParams), formatDefaults(n.DefaultParams))
+		}
+	}
+	return changes
+}
+
+func diffField(changes []CatalogChange, name, field, old, new string) []CatalogChange {
+	if old == new {
+		return changes
+	}
+	return append(changes, CatalogChange{Kind: "changed", Name: name, Field: field, Old: old, New: new})
+}
+
+func unionNames[V any](a, b map[string]V) []string {
+	names := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		names = append(names, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,97 @@
+package rdb
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Catalog(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Load("user.yaml", []byte(userDefinitions)); err != nil {
+		t.Fatal(err)
+	}
+	c := r.Catalog()
+	if len(c.Cmds) != 1 || len(c.Luas) != 1 {
+		t.Fatalf("unexpected catalog %+v", c)
+	}
+	cmd := c.Cmds[0]
+	if cmd.Key != "user:{{userId}}:wealth" || !reflect.DeepEqual(cmd.Placeholders, []string{"userId"}) {
+		t.Errorf("unexpected cmd %+v", cmd)
+	}
+	names := make([]string, len(cmd.SubCmds))
+	for i, sub := range cmd.SubCmds {
+		names[i] = sub.Name
+	}
+	if !reflect.DeepEqual(names, []string{"HGET", "HSET", "ZRANK", "expireLong"}) {
+		t.Errorf("sub commands should be sorted, got %v", names)
+	}
+	if hset := cmd.SubCmds[1]; hset.TTL != "30s NX" || hset.Params != "{{field}} {{value}}" {
+		t.Errorf("unexpected HSET %+v", hset)
+	}
+	if long := cmd.SubCmds[3]; long.CmdName != "EXPIRE" || long.DefaultParams["expireTime"] != "176400" {
+		t.Errorf("unexpected expireLong %+v", long)
+	}
+
+	// JSON 往返之后没有差异
+	data, err := c.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Catalog
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if changes := DiffCatalogs(c, back); changes != nil {
+		t.Errorf("round trip should not change the catalog: %v", changes)
+	}
+
+	md := c.Markdown()
+	for _, want := range []string{"### UserWealth", "- key: `user:{{userId}}:wealth`", "| HSET |  | `{{field}} {{value}}` | 30s NX |", "| ZRANK |  |  |  | yes |", "## Lua scripts"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestDiffCatalogs(t *testing.T) {
+	old := NewRegistry()
+	_ = old.Register("Wallet", RdCmd{Key: "wallet:{{uid}}", CMD: map[Command]RdSubCmd{
+		HGET: {},
+		HSET: {Params: "{{f}} {{v}}", Expire: ExpireIn(time.Hour)},
+		HDEL: {Params: "{{f}}", Exp: func() time.Duration { return time.Hour }},
+	}})
+	_ = old.Register("Gone", RdCmd{Key: "gone:{{id}}", CMD: map[Command]RdSubCmd{GET: {}}})
+	_ = old.RegisterLua("Script", LuaScript{Script: "return 1", Keys: []string{"k"}})
+
+	cur := NewRegistry()
+	_ = cur.Register("Wallet", RdCmd{Key: "wallet:{{{uid}}}", CMD: map[Command]RdSubCmd{
+		HSET: {Params: "{{f}} {{v}}", Expire: ExpireIn(2 * time.Hour)},
+		// 函数计算的过期时间导出为 "func", 返回值不同也没有差异
+		HDEL: {Params: "{{f}}", Exp: func() time.Duration { return 3 * time.Hour }},
+		HLEN: {Expire: ExpireInFunc(func() time.Duration { return time.Minute })},
+	}})
+	_ = cur.Register("New", RdCmd{Key: "new:{{id}}", CMD: map[Command]RdSubCmd{GET: {}}})
+	_ = cur.RegisterLua("Script", LuaScript{Script: "return 2", Keys: []string{"k"}})
+
+	var got []string
+	for _, change := range DiffCatalogs(old.Catalog(), cur.Catalog()) {
+		got = append(got, change.String())
+	}
+	want := []string{
+		"removed cmd Gone",
+		"added cmd New",
+		`changed cmd Wallet key: "wallet:{{uid}}" -> "wallet:{{{uid}}}"`,
+		"removed cmd Wallet.HGET",
+		"added cmd Wallet.HLEN",
+		`changed cmd Wallet.HSET ttl: "1h0m0s" -> "2h0m0s"`,
+	}
+	if ttl := cur.Catalog().Cmds[1].SubCmds[1].TTL; ttl != "func" {
+		t.Errorf("function ttl should be exported as func, got %q", ttl)
+	}
+	if len(got) != len(want)+1 || !reflect.DeepEqual(got[:len(want)], want) || !strings.HasPrefix(got[len(want)], "changed lua Script script:") {
+		t.Errorf("unexpected diff:\n%s", strings.Join(got, "\n"))
+	}
+}
@@ -1,5 +1,11 @@
 package rdb
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 type Command string
 
 var (
@@ -21,6 +27,10 @@ var (
 	PTTL      Command = "PTTL"
 	TYPE      Command = "TYPE"
 	UNLINK    Command = "UNLINK"
+	COPY      Command = "COPY"
+	OBJECT    Command = "OBJECT"
+	SORT      Command = "SORT"
+	SORT_RO   Command = "SORT_RO"
 	SCAN      Command = "SCAN"
 
 	// Strings
@@ -41,6 +51,7 @@ var (
 	DECR        Command = "DECR"
 	DECRBY      Command = "DECRBY"
 	APPEND      Command = "APPEND"
+	LCS         Command = "LCS"
 
 	// Hashes
 	HDEL         Command = "HDEL"
@@ -61,11 +72,15 @@ var (
 
 	// Lists
 	BLPOP      Command = "BLPOP"
+	BLMOVE     Command = "BLMOVE"
+	BLMPOP     Command = "BLMPOP"
 	BRPOP      Command = "BRPOP"
 	BRPOPLPUSH Command = "BRPOPLPUSH"
 	LINDEX     Command = "LINDEX"
 	LINSERT    Command = "LINSERT"
 	LLEN       Command = "LLEN"
+	LMOVE      Command = "LMOVE"
+	LMPOP      Command = "LMPOP"
 	LPOP       Command = "LPOP"
 	LPUSH      Command = "LPUSH"
 	LPUSHX     Command = "LPUSHX"
@@ -85,6 +100,7 @@ var (
 	SDIFFSTORE  Command = "SDIFFSTORE"
 	SINTER      Command = "SINTER"
 	SINTERSTORE Command = "SINTERSTORE"
+	SINTERCARD  Command = "SINTERCARD"
 	SISMEMBER   Command = "SISMEMBER"
 	SMEMBERS    Command = "SMEMBERS"
 	SMOVE       Command = "SMOVE"
@@ -97,10 +113,16 @@ var (
 
 	// Sorted Sets
 	ZADD             Command = "ZADD"
+	BZMPOP           Command = "BZMPOP"
+	BZPOPMAX         Command = "BZPOPMAX"
+	BZPOPMIN         Command = "BZPOPMIN"
 	ZCARD            Command = "ZCARD"
 	ZCOUNT           Command = "ZCOUNT"
+	ZDIFF            Command = "ZDIFF"
+	ZDIFFSTORE       Command = "ZDIFFSTORE"
 	ZINCRBY          Command = "ZINCRBY"
 	ZINTER           Command = "ZINTER"
+	ZINTERCARD       Command = "ZINTERCARD"
 	ZINTERSTORE      Command = "ZINTERSTORE"
 	ZLEXCOUNT        Command = "ZLEXCOUNT"
 	ZMPOP            Command = "ZMPOP"
@@ -111,6 +133,7 @@ var (
 	ZRANGE           Command = "ZRANGE"
 	ZRANGEBYLEX      Command = "ZRANGEBYLEX"
 	ZRANGEBYSCORE    Command = "ZRANGEBYSCORE"
+	ZRANGESTORE      Command = "ZRANGESTORE"
 	ZRANK            Command = "ZRANK"
 	ZREM             Command = "ZREM"
 	ZREMRANGEBYLEX   Command = "ZREMRANGEBYLEX"
@@ -130,6 +153,11 @@ var (
 	PFCOUNT Command = "PFCOUNT"
 	PFMERGE Command = "PFMERGE"
 
+	// Geo
+	GEORADIUS         Command = "GEORADIUS"
+	GEORADIUSBYMEMBER Command = "GEORADIUSBYMEMBER"
+	GEOSEARCHSTORE    Command = "GEOSEARCHSTORE"
+
 	// Bitmaps
 	BITCOUNT Command = "BITCOUNT"
 	BITFIELD Command = "BITFIELD"
@@ -168,9 +196,13 @@ var (
 	WATCH   Command = "WATCH"
 
 	// Scripting
-	EVAL    Command = "EVAL"
-	EVALSHA Command = "EVALSHA"
-	SCRIPT  Command = "SCRIPT"
+	EVAL       Command = "EVAL"
+	EVALSHA    Command = "EVALSHA"
+	EVAL_RO    Command = "EVAL_RO"
+	EVALSHA_RO Command = "EVALSHA_RO"
+	FCALL      Command = "FCALL"
+	FCALL_RO   Command = "FCALL_RO"
+	SCRIPT     Command = "SCRIPT"
 
 	// Connection
 	AUTH   Command = "AUTH"
@@ -200,3 +232,258 @@ var (
 	SYNC         Command = "SYNC"
 	TIME         Command = "TIME"
 )
+
+// knownCommands 上面定义的所有命令, 加载定义文件的时候用来检查子命令的名字
+var knownCommands = commandSet(
+	// Keys
+	DEL, DUMP, EXISTS, EXPIRE, EXPIREAT, KEYS, MOVE, PERSIST, PEXPIRE, PEXPIREAT, RENAME, RENAMENX,
+	TOUCH, TTL, PTTL, TYPE, UNLINK, COPY, OBJECT, SORT, SORT_RO, SCAN,
+	// Strings
+	SET, GET, GETSET, SETRANGE, GETRANGE, MGET, MSET, SETEX, MSETNX, SETNX, STRLEN, INCR, INCRBY,
+	INCRBYFLOAT, DECR, DECRBY, APPEND, LCS,
+	// Hashes
+	HDEL, HEXISTS, HGET, HGETALL, HINCRBY, HINCRBYFLOAT, HKEYS, HLEN, HMGET, HMSET, HSET, HSETNX,
+	HSTRLEN, HVALS, HSCAN,
+	// Lists
+	BLPOP, BLMOVE, BLMPOP, BRPOP, BRPOPLPUSH, LINDEX, LINSERT, LLEN, LMOVE, LMPOP, LPOP, LPUSH,
+	LPUSHX, LRANGE, LREM, LSET, LTRIM, RPOP, RPOPLPUSH, RPUSH, RPUSHX,
+	// Sets
+	SADD, SCARD, SDIFF, SDIFFSTORE, SINTER, SINTERSTORE, SINTERCARD, SISMEMBER, SMEMBERS, SMOVE,
+	SPOP, SRANDMEMBER, SREM, SUNION, SUNIONSTORE, SSCAN,
+	// Sorted Sets
+	ZADD, BZMPOP, BZPOPMAX, BZPOPMIN, ZCARD, ZCOUNT, ZDIFF, ZDIFFSTORE, ZINCRBY, ZINTER,
+	ZINTERCARD, ZINTERSTORE, ZLEXCOUNT, ZMPOP, ZMSCORE, ZPOPMAX, ZPOPMIN, ZRANDMEMBER, ZRANGE,
+	ZRANGEBYLEX, ZRANGEBYSCORE, ZRANGESTORE, ZRANK, ZREM, ZREMRANGEBYLEX, ZREMRANGEBYRANK,
+	ZREMRANGEBYSCORE, ZREVRANGE, ZREVRANGEBYLEX, ZREVRANGEBYSCORE, ZREVRANK, ZSCORE, ZUNION,
+	ZUNIONSTORE, ZSCAN,
+	// HyperLogLog
+	PFADD, PFCOUNT, PFMERGE,
+	// Geo
+	GEORADIUS, GEORADIUSBYMEMBER, GEOSEARCHSTORE,
+	// Bitmaps
+	BITCOUNT, BITFIELD, BITOP, BITPOS, GETBIT, SETBIT,
+	// Streams
+	XADD, XDEL, XLEN, XRANGE, XREVRANGE, XREAD, XREADGROUP, XACK, XGROUP, XINFO, XPENDING, XTRIM,
+	// Pub/Sub
+	PUBLISH, PUBSUB, SUBSCRIBE, UNSUBSCRIBE, PSUBSCRIBE, PUNSUBSCRIBE,
+	// Transactions
+	DISCARD, EXEC, MULTI, UNWATCH, WATCH,
+	// Scripting
+	EVAL, EVALSHA, EVAL_RO, EVALSHA_RO, FCALL, FCALL_RO, SCRIPT,
+	// Connection
+	AUTH, ECHO, PING, QUIT, SELECT,
+	// Server
+	BGREWRITEAOF, BGSAVE, CLIENT, COMMAND, CONFIG, DBSIZE, DEBUG, FLUSHALL, FLUSHDB, INFO,
+	LASTSAVE, MONITOR, REPLICAOF, ROLE, SAVE, SHUTDOWN, SLOWLOG, SYNC, TIME,
+)
+
+func commandSet(cmds ...Command) map[Command]bool {
+	set := make(map[Command]bool, len(cmds))
+	for _, c := range cmds {
+		set[c] = true
+	}
+	return set
+}
+
+// keySpec 描述一个命令的参数中哪些位置是 key
+// 下标以完整参数列表为准, 0 是命令名本身, 1 是第一个参数
+// last 为负数时表示从末尾倒数, 例如 -1 表示最后一个参数
+// numKeysAt > 0 时, 该位置的参数是 key 的个数, 紧随其后的 numkeys 个参数都是 key (ZINTERSTORE, EVAL 等)
+// streams 为 true 时, STREAMS 关键字之后前一半的参数是 key (XREAD, XREADGROUP)
+// store 为 true 时, STORE/STOREDIST 关键字之后的参数也是 key (SORT, GEORADIUS)
+type keySpec struct {
+	first     int
+	last      int
+	step      int
+	numKeysAt int
+	streams   bool
+	store     bool
+}
+
+var (
+	singleKey   = keySpec{first: 1, last: 1, step: 1}
+	allKeys     = keySpec{first: 1, last: -1, step: 1}
+	twoKeys     = keySpec{first: 1, last: 2, step: 1}
+	noKeys      = keySpec{}
+	destNumKeys = keySpec{first: 1, last: 1, step: 1, numKeysAt: 2}
+	storeKey    = keySpec{first: 1, last: 1, step: 1, store: true}
+)
+
+// commandKeySpecs 未出现在表里的命令按 singleKey 处理
+// 有多个 key 的命令必须列在这里, 否则只有第一个 key 会加前缀和参与 slot 校验
+var commandKeySpecs = map[Command]keySpec{
+	// Keys
+	DEL:      allKeys,
+	EXISTS:   allKeys,
+	RENAME:   twoKeys,
+	RENAMENX: twoKeys,
+	TOUCH:    allKeys,
+	UNLINK:   allKeys,
+	COPY:     twoKeys,
+	OBJECT:   {first: 2, last: 2, step: 1},
+	SORT:     storeKey,
+	SORT_RO:  singleKey,
+	KEYS:     noKeys,
+	SCAN:     noKeys,
+
+	// Strings
+	MGET:   allKeys,
+	MSET:   {first: 1, last: -1, step: 2},
+	MSETNX: {first: 1, last: -1, step: 2},
+	LCS:    twoKeys,
+
+	// Lists
+	BLPOP:      {first: 1, last: -2, step: 1},
+	BRPOP:      {first: 1, last: -2, step: 1},
+	BRPOPLPUSH: twoKeys,
+	RPOPLPUSH:  twoKeys,
+	LMOVE:      twoKeys,
+	BLMOVE:     twoKeys,
+	LMPOP:      {numKeysAt: 1},
+	BLMPOP:     {numKeysAt: 2},
+
+	// Sets
+	SDIFF:       allKeys,
+	SDIFFSTORE:  allKeys,
+	SINTER:      allKeys,
+	SINTERSTORE: allKeys,
+	SINTERCARD:  {numKeysAt: 1},
+	SMOVE:       twoKeys,
+	SUNION:      allKeys,
+	SUNIONSTORE: allKeys,
+
+	// Sorted Sets
+	ZINTER:      {numKeysAt: 1},
+	ZUNION:      {numKeysAt: 1},
+	ZMPOP:       {numKeysAt: 1},
+	ZINTERSTORE: destNumKeys,
+	ZUNIONSTORE: destNumKeys,
+	ZDIFF:       {numKeysAt: 1},
+	ZDIFFSTORE:  destNumKeys,
+	ZINTERCARD:  {numKeysAt: 1},
+	BZMPOP:      {numKeysAt: 2},
+	BZPOPMIN:    {first: 1, last: -2, step: 1},
+	BZPOPMAX:    {first: 1, last: -2, step: 1},
+	ZRANGESTORE: twoKeys,
+
+	// HyperLogLog
+	PFCOUNT: allKeys,
+	PFMERGE: allKeys,
+
+	// Geo
+	GEORADIUS:         storeKey,
+	GEORADIUSBYMEMBER: storeKey,
+	GEOSEARCHSTORE:    twoKeys,
+
+	// Bitmaps
+	BITOP: {first: 2, last: -1, step: 1},
+
+	// Streams
+	XREAD:      {streams: true},
+	XREADGROUP: {streams: true},
+	XGROUP:     {first: 2, last: 2, step: 1},
+	XINFO:      {first: 2, last: 2, step: 1},
+
+	// Pub/Sub
+	PUBLISH:      noKeys,
+	PUBSUB:       noKeys,
+	SUBSCRIBE:    noKeys,
+	UNSUBSCRIBE:  noKeys,
+	PSUBSCRIBE:   noKeys,
+	PUNSUBSCRIBE: noKeys,
+
+	// Transactions
+	DISCARD: noKeys,
+	EXEC:    noKeys,
+	MULTI:   noKeys,
+	UNWATCH: noKeys,
+	WATCH:   allKeys,
+
+	// Scripting
+	EVAL:       {numKeysAt: 2},
+	EVALSHA:    {numKeysAt: 2},
+	EVAL_RO:    {numKeysAt: 2},
+	EVALSHA_RO: {numKeysAt: 2},
+	FCALL:      {numKeysAt: 2},
+	FCALL_RO:   {numKeysAt: 2},
+	SCRIPT:     noKeys,
+
+	// Connection
+	AUTH:   noKeys,
+	ECHO:   noKeys,
+	PING:   noKeys,
+	QUIT:   noKeys,
+	SELECT: noKeys,
+
+	// Server
+	BGREWRITEAOF: noKeys,
+	BGSAVE:       noKeys,
+	CLIENT:       noKeys,
+	COMMAND:      noKeys,
+	CONFIG:       noKeys,
+	DBSIZE:       noKeys,
+	DEBUG:        noKeys,
+	FLUSHALL:     noKeys,
+	FLUSHDB:      noKeys,
+	INFO:         noKeys,
+	LASTSAVE:     noKeys,
+	MONITOR:      noKeys,
+	REPLICAOF:    noKeys,
+	ROLE:         noKeys,
+	SAVE:         noKeys,
+	SHUTDOWN:     noKeys,
+	SLOWLOG:      noKeys,
+	SYNC:         noKeys,
+	TIME:         noKeys,
+}
+
+// keyIndexes 返回完整参数列表 args (args[0] 为命令名) 中所有 key 所在的下标
+func keyIndexes(cmdName Command, args []any) []int {
+	spec, ok := commandKeySpecs[Command(strings.ToUpper(string(cmdName)))]
+	if !ok {
+		spec = singleKey
+	}
+	n := len(args)
+	var idx []int
+	if spec.streams {
+		for i := 1; i < n; i++ {
+			if s, ok := args[i].(string); ok && strings.EqualFold(s, "STREAMS") {
+				rest := n - i - 1
+				for j := i + 1; j <= i+rest/2; j++ {
+					idx = append(idx, j)
+				}
+				break
+			}
+		}
+		return idx
+	}
+	if spec.first > 0 && spec.step > 0 {
+		last := spec.last
+		if last < 0 {
+			last = n + last
+		}
+		if last >= n {
+			last = n - 1
+		}
+		for i := spec.first; i <= last; i += spec.step {
+			idx = append(idx, i)
+		}
+	}
+	if spec.numKeysAt > 0 && spec.numKeysAt < n {
+		numKeys, err := strconv.Atoi(fmt.Sprint(args[spec.numKeysAt]))
+		if err == nil {
+			for i := spec.numKeysAt + 1; i <= spec.numKeysAt+numKeys && i < n; i++ {
+				idx = append(idx, i)
+			}
+		}
+	}
+	if spec.store {
+		for i := 2; i < n-1; i++ {
+			if s, ok := args[i].(string); ok && (strings.EqualFold(s, "STORE") || strings.EqualFold(s, "STOREDIST")) {
+				idx = append(idx, i+1)
+				i++
+			}
+		}
+	}
+	return idx
+}
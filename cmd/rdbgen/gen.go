@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+	"text/template"
+
+	"github.com/preceeder/rdb"
+)
+
+// methodNames 和 builder 上的方法名保持一致
+var methodNames = map[string]string{
+	"HSET": "HSet", "HGET": "HGet", "HDEL": "HDel", "HGETALL": "HGetAll", "HMSET": "HMSet", "HMGET": "HMGet",
+	"HSETNX": "HSetNx", "HINCRBY": "HIncrBy", "HINCRBYFLOAT": "HIncrByFloat", "HKEYS": "HKeys", "HLEN": "HLen",
+	"HVALS": "HVals", "HEXISTS": "HExists",
+	"LINDEX": "LIndex", "LINSERT": "LInsert", "LLEN": "LLen", "LPUSH": "LPush", "LPUSHX": "LPushx", "LPOP": "LPop",
+	"LRANGE": "LRange", "LREM": "LRem", "LSET": "LSet", "LTRIM": "LTrim", "RPOP": "RPop", "RPOPLPUSH": "RPopLPush",
+	"RPUSH": "RPush", "RPUSHX": "RPushx",
+	"SADD": "SAdd", "SCARD": "SCard", "SDIFF": "SDiff", "SDIFFSTORE": "SDiffStore", "SINTER": "SInter",
+	"SINTERSTORE": "SInterStore", "SISMEMBER": "SIsMember", "SMEMBERS": "SMembers", "SMOVE": "SMove", "SREM": "SRem",
+	"SUNION": "SUnion", "SUNIONSTORE": "SUnionStore",
+	"SET": "Set", "MSET": "MSet", "SETRANGE": "SetRange", "SETEX": "SetEx", "SETNX": "SetNx", "DEL": "Del", "GET": "Get",
+	"GETSET": "GetSet", "GETRANGE": "GetRange", "MGET": "MGet", "INCR": "Incr", "INCRBY": "IncrBy",
+	"INCRBYFLOAT": "IncrByFloat", "DECRBY": "DecrBy", "DECR": "Decr", "APPEND": "StringAppend",
+	"ZADD": "ZAdd", "ZCARD": "ZCard", "ZCOUNT": "ZCount", "ZINCRBY": "ZIncrBy", "ZLEXCOUNT": "ZLexCount",
+	"ZRANGE": "ZRange", "ZREVRANGE": "ZRevRange", "ZRANGEBYLEX": "ZRangeByLex", "ZRANGEBYSCORE": "ZRangeByScore",
+	"ZREVRANGEBYSCORE": "ZRevRangeByScore", "ZRANK": "ZRank", "ZREVRANK": "ZRevRank", "ZREM": "ZRem",
+	"ZREMRANGEBYLEX": "ZRemRangeByLex", "ZREMRANGEBYRANK": "ZRemRangeByRank", "ZREMRANGEBYSCORE": "ZRemRangeByScore",
+	"ZSCORE": "ZScore", "ZINTERSTORE": "ZInterStore", "ZINTER": "ZInter", "ZUNIONSTORE": "ZUnionStore", "ZUNION": "ZUnion",
+}
+
+// resultKind CommandBuilder 上的取值方法以及对应的 go 类型
+type resultKind struct {
+	Accessor string
+	GoType   string
+	CmdType  string
+}
+
+var (
+	kindString          = resultKind{"String", "string", "StringCmd"}
+	kindInt             = resultKind{"Int", "int64", "IntCmd"}
+	kindBool            = resultKind{"Bool", "bool", "BoolCmd"}
+	kindFloat           = resultKind{"Float", "float64", "FloatCmd"}
+	kindStringSlice     = resultKind{"StringSlice", "[]string", "StringSliceCmd"}
+	kindSlice           = resultKind{"Slice", "[]interface{}", "SliceCmd"}
+	kindMapStringString = resultKind{"MapStringString", "map[string]string", "MapStringStringCmd"}
+	kindZSlice          = resultKind{"ZSlice", "[]redis.Z", "ZSliceCmd"}
+	kindFloatSlice      = resultKind{"FloatSlice", "[]float64", "FloatSliceCmd"}
+)
+
+var resultKinds = map[string]resultKind{}
+
+func init() {
+	groups := map[resultKind]string{
+		kindString: "GET GETSET GETRANGE HGET LINDEX LPOP RPOP RPOPLPUSH BRPOPLPUSH SPOP SRANDMEMBER SET SETEX MSET " +
+			"LSET LTRIM HMSET RENAME TYPE ECHO PING",
+		kindInt: "INCR DECR INCRBY DECRBY HINCRBY HLEN LLEN SCARD ZCARD ZCOUNT ZLEXCOUNT DEL EXISTS UNLINK TOUCH SADD " +
+			"SREM ZADD ZREM LPUSH RPUSH LPUSHX RPUSHX HDEL HSET APPEND STRLEN SETRANGE ZRANK ZREVRANK SDIFFSTORE " +
+			"SINTERSTORE SUNIONSTORE ZINTERSTORE ZUNIONSTORE LREM LINSERT TTL PTTL PFADD PFCOUNT HSTRLEN BITCOUNT " +
+			"SETBIT GETBIT BITOP BITPOS ZREMRANGEBYLEX ZREMRANGEBYRANK ZREMRANGEBYSCORE XLEN XDEL XACK PUBLISH",
+		kindBool:  "SETNX HSETNX HEXISTS SISMEMBER SMOVE MSETNX EXPIRE PEXPIRE EXPIREAT PEXPIREAT PERSIST RENAMENX",
+		kindFloat: "INCRBYFLOAT HINCRBYFLOAT ZINCRBY ZSCORE",
+		kindStringSlice: "HKEYS HVALS SMEMBERS SINTER SUNION SDIFF LRANGE ZRANGE ZREVRANGE ZRANGEBYSCORE " +
+			"ZREVRANGEBYSCORE ZRANGEBYLEX ZREVRANGEBYLEX ZINTER ZUNION KEYS BLPOP BRPOP",
+		kindSlice:           "MGET HMGET",
+		kindMapStringString: "HGETALL",
+		kindZSlice:          "ZPOPMAX ZPOPMIN",
+		kindFloatSlice:      "ZMSCORE",
+	}
+	for kind, cmds := range groups {
+		for _, c := range strings.Fields(cmds) {
+			resultKinds[c] = kind
+		}
+	}
+}
+
+// commandResult 根据真正的命令名推导返回类型, 带 WITHSCORES 的范围查询返回 ZSlice
+func commandResult(cmd, params string) (resultKind, bool) {
+	kind, ok := resultKinds[cmd]
+	if ok && kind == kindStringSlice && strings.HasPrefix(cmd, "Z") && strings.Contains(strings.ToUpper(params), "WITHSCORES") {
+		return kindZSlice, true
+	}
+	return kind, ok
+}
+
+type genParam struct {
+	Name  string // 占位符名
+	Ident string // 生成代码中的参数名
+	Type  string
+}
+
+type genMethod struct {
+	Method  string
+	Comment string
+	CmdExpr string
+	Params  []genParam
+	Kind    resultKind
+	Known   bool
+}
+
+type genAccessor struct {
+	Name    string
+	Type    string
+	Expr    string
+	Key     string
+	Methods []genMethod
+}
+
+type genFile struct {
+	Package   string
+	Q         string // rdb 包的限定符
+	NeedRedis bool
+	Accessors []genAccessor
+}
+
+var reservedIdents = map[string]bool{"ctx": true, "client": true, "pipe": true, "includeArgs": true, "c": true, "cb": true}
+
+func buildMethod(spec cmdSpec, sub subSpec, q string) (genMethod, error) {
+	realCmd := strings.ToUpper(sub.Name)
+	if sub.CmdName != "" {
+		realCmd = strings.ToUpper(sub.CmdName)
+	}
+	method, ok := methodNames[strings.ToUpper(sub.Name)]
+	if !ok || sub.Name != strings.ToUpper(sub.Name) {
+		method = exported(strings.ToLower(sub.Name[:1]) + sub.Name[1:])
+	}
+
+	var names []string
+	if !sub.NoUseKey {
+		keyNames, err := rdb.Placeholders(spec.Key)
+		if err != nil {
+			return genMethod{}, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		names = append(names, keyNames...)
+	}
+	paramNames, err := rdb.Placeholders(sub.Params)
+	if err != nil {
+		return genMethod{}, fmt.Errorf("%s.%s: %w", spec.Name, sub.Name, err)
+	}
+	names = append(names, paramNames...)
+
+	m := genMethod{Method: method}
+	m.Comment = strings.TrimSpace(fmt.Sprintf("%s %s %s", realCmd, spec.Key, sub.Params))
+	if sub.NoUseKey {
+		m.Comment = strings.TrimSpace(fmt.Sprintf("%s %s", realCmd, sub.Params))
+	}
+	if sub.Expr != "" {
+		m.CmdExpr = sub.Expr
+	} else {
+		m.CmdExpr = fmt.Sprintf("%sCommand(%q)", q, sub.Name)
+	}
+	m.Kind, m.Known = commandResult(realCmd, sub.Params)
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] || sub.Defaults[name] {
+			continue
+		}
+		seen[name] = true
+		typ := spec.Types[name]
+		if typ == "" {
+			typ = "any"
+		}
+		m.Params = append(m.Params, genParam{Name: name, Ident: paramIdent(name), Type: typ})
+	}
+	return m, nil
+}
+
+func paramIdent(name string) string {
+	ident := exported(name)
+	ident = strings.ToLower(ident[:1]) + ident[1:]
+	if token.IsKeyword(ident) || reservedIdents[ident] || !token.IsIdentifier(ident) {
+		ident += "Param"
+	}
+	return ident
+}
+
+func generate(pkg string, specs []cmdSpec) ([]byte, error) {
+	file := genFile{Package: pkg, Q: "rdb."}
+	if pkg == "rdb" {
+		file.Q = ""
+	}
+	for _, spec := range specs {
+		acc := genAccessor{
+			Name: spec.Name,
+			Type: strings.ToLower(spec.Name[:1]) + spec.Name[1:] + "Ops",
+			Expr: spec.Expr,
+			Key:  spec.Key,
+		}
+		for _, sub := range spec.Subs {
+			m, err := buildMethod(spec, sub, file.Q)
+			if err != nil {
+				return nil, err
+			}
+			file.NeedRedis = file.NeedRedis || m.Known
+			acc.Methods = append(acc.Methods, m)
+		}
+		file.Accessors = append(file.Accessors, acc)
+	}
+
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, file); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, buf.String())
+	}
+	return src, nil
+}
+
+var fileTemplate = template.Must(template.New("rdbgen").Parse(`// Code generated by rdbgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+{{if or .Q .NeedRedis}}
+{{end}}
+{{- if .Q}}	"github.com/preceeder/rdb"
+{{end}}
+{{- if .NeedRedis}}	"github.com/redis/go-redis/v9"
+{{end -}}
+)
+{{$q := .Q}}
+{{range $acc := .Accessors}}
+// {{.Name}} {{.Key}}
+var {{.Name}} = {{.Type}}{cmd: {{.Expr}}}
+
+type {{.Type}} struct {
+	cmd {{$q}}RdCmd
+}
+{{range .Methods}}
+// {{.Method}} {{.Comment}}
+func (c {{$acc.Type}}) {{.Method}}(ctx context.Context, client *{{$q}}RedisClient{{range .Params}}, {{.Ident}} {{.Type}}{{end}}, includeArgs ...any) ({{if .Known}}{{.Kind.GoType}}{{else}}any{{end}}, error) {
+	cb := client.Handler(ctx, c.cmd, {{.CmdExpr}}, map[string]any{ {{range .Params}}{{printf "%q" .Name}}: {{.Ident}}, {{end}} }, includeArgs...)
+{{- if .Known}}
+	return cb.{{.Kind.Accessor}}().Result()
+{{- else}}
+	return cb.Val(), cb.Err()
+{{- end}}
+}
+
+// {{.Method}}Pipe 加入 pipeline, 结果在 Exec 之后获取
+func (c {{$acc.Type}}) {{.Method}}Pipe(ctx context.Context, pipe *{{$q}}RedisPipeline{{range .Params}}, {{.Ident}} {{.Type}}{{end}}, includeArgs ...any) {{if .Known}}*redis.{{.Kind.CmdType}}{{else}}*{{$q}}CommandBuilder{{end}} {
+	cb := pipe.Handler(ctx, c.cmd, {{.CmdExpr}}, map[string]any{ {{range .Params}}{{printf "%q" .Name}}: {{.Ident}}, {{end}} }, includeArgs...)
+{{- if .Known}}
+	return cb.{{.Kind.Accessor}}()
+{{- else}}
+	_ = cb.Err() // Err 会把命令加入 pipeline
+	return cb
+{{- end}}
+}
+{{end}}
+{{end}}
+`))
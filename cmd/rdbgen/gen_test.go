@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const userSource = `package models
+
+import (
+	"time"
+
+	"github.com/preceeder/rdb"
+)
+
+//rdbgen:types userId=int64
+var UserWealthCmd = rdb.RdCmd{
+	Key: "user:{{userId}}:wealth",
+	CMD: map[rdb.Command]rdb.RdSubCmd{
+		rdb.HGET:   {Params: "{{field}}"},
+		rdb.HSET:   {Params: "{{field}} {{value}}", Exp: func() time.Duration { return time.Hour }},
+		rdb.ZRANGE: {Params: "{{start}} {{stop}} WITHSCORES"},
+		"expire":   {Params: "{{expireTime}}", DefaultParams: map[string]any{"expireTime": 10}},
+		"custom":   {CmdName: "OBJECT", Params: "ENCODING", NoUseKey: true},
+	},
+}
+
+//rdbgen:skip
+var SkippedCmd = rdb.RdCmd{Key: "skipped"}
+`
+
+func TestGenerateFromSource(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "defs.go"), []byte(userSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pkg, specs, err := scanPackage(dir, filepath.Join(dir, "rdb_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg != "models" || len(specs) != 1 {
+		t.Fatalf("unexpected scan result %s %+v", pkg, specs)
+	}
+	for i := range specs {
+		specs[i].mergeTypes(map[string]string{"field": "string", "userId": "string"})
+	}
+	src, err := generate(pkg, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	for _, want := range []string{
+		"var UserWealth = userWealthOps{cmd: UserWealthCmd}",
+		"func (c userWealthOps) HGet(ctx context.Context, client *rdb.RedisClient, userId int64, field string, includeArgs ...any) (string, error)",
+		"func (c userWealthOps) HGetPipe(ctx context.Context, pipe *rdb.RedisPipeline, userId int64, field string, includeArgs ...any) *redis.StringCmd",
+		"func (c userWealthOps) HSet(ctx context.Context, client *rdb.RedisClient, userId int64, field string, value any, includeArgs ...any) (int64, error)",
+		"func (c userWealthOps) ZRange(ctx context.Context, client *rdb.RedisClient, userId int64, start any, stop any, includeArgs ...any) ([]redis.Z, error)",
+		"func (c userWealthOps) Expire(ctx context.Context, client *rdb.RedisClient, userId int64, includeArgs ...any) (bool, error)",
+		`rdb.Command("expire")`,
+		"func (c userWealthOps) Custom(ctx context.Context, client *rdb.RedisClient, includeArgs ...any) (any, error)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code missing %q\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "Skipped") {
+		t.Error("rdbgen:skip should be honored")
+	}
+}
+
+func TestGenerateFromDefinitions(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "user.yaml")
+	data := `
+cmds:
+  user_wealth:
+    key: "user:{{userId}}:wealth"
+    cmd:
+      HGET:
+        params: "{{field}}"
+      SMEMBERS:
+        cmdName: SMEMBERS
+`
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	specs, err := loadDefinitions(file, "Defs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := generate("models", specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	for _, want := range []string{
+		`var UserWealth = userWealthOps{cmd: Defs.MustCmd("user_wealth")}`,
+		`rdb.Command("HGET")`,
+		"func (c userWealthOps) SMembers(ctx context.Context, client *rdb.RedisClient, userId any, includeArgs ...any) ([]string, error)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code missing %q\n%s", want, code)
+		}
+	}
+}
+
+func TestParamIdent(t *testing.T) {
+	tests := map[string]string{"userId": "userId", "user_id": "userId", "type": "typeParam", "ctx": "ctxParam"}
+	for name, want := range tests {
+		if got := paramIdent(name); got != want {
+			t.Errorf("paramIdent(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// rdbgen 根据 RdCmd 定义生成带类型的调用方法
+//
+// 定义可以来自 go 源码中的 RdCmd 变量, 也可以来自 yaml/json 定义文件(见 rdb.Registry.Load)
+//
+//	//go:generate go run github.com/preceeder/rdb/cmd/rdbgen -types userId=int64
+//	var UserWealthCmd = rdb.RdCmd{Key: "user:{{userId}}:wealth", CMD: ...}
+//
+// 会生成
+//
+//	UserWealth.HGet(ctx, client, userId int64, field any, includeArgs ...any) (string, error)
+//	UserWealth.HGetPipe(ctx, pipe, userId int64, field any, includeArgs ...any) *redis.StringCmd
+//
+// 占位符的类型默认是 any, 可以通过 -types 参数统一指定, 也可以在变量的注释里用
+// //rdbgen:types userId=int64,field=string 单独指定, //rdbgen:skip 表示不生成
+//
+// 使用定义文件的时候需要 -defs 指定文件或目录, -registry 指定运行时加载了这些定义的 *rdb.Registry 表达式
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	var (
+		dir      = flag.String("dir", ".", "package directory to scan for RdCmd variables")
+		defs     = flag.String("defs", "", "yaml/json definition file or directory, replaces -dir scanning")
+		registry = flag.String("registry", "", "expression of the *rdb.Registry holding -defs at runtime")
+		pkg      = flag.String("pkg", "", "package name of the generated file, defaults to the scanned package")
+		out      = flag.String("out", "rdb_gen.go", "output file, relative to -dir")
+		types    = flag.String("types", "", "placeholder types, e.g. userId=int64,field=string")
+	)
+	flag.Parse()
+
+	globalTypes, err := parseTypes(*types)
+	if err != nil {
+		fatal(err)
+	}
+	outFile := *out
+	if !filepath.IsAbs(outFile) {
+		outFile = filepath.Join(*dir, outFile)
+	}
+
+	var specs []cmdSpec
+	pkgName := *pkg
+	if *defs != "" {
+		if *registry == "" {
+			fatal(fmt.Errorf("-registry is required with -defs"))
+		}
+		if pkgName == "" {
+			pkgName, _ = packageName(*dir, outFile)
+		}
+		specs, err = loadDefinitions(*defs, *registry)
+	} else {
+		var scanned string
+		scanned, specs, err = scanPackage(*dir, outFile)
+		if pkgName == "" {
+			pkgName = scanned
+		}
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if pkgName == "" {
+		fatal(fmt.Errorf("can't detect package name, use -pkg"))
+	}
+	for i := range specs {
+		specs[i].mergeTypes(globalTypes)
+	}
+
+	src, err := generate(pkgName, specs)
+	if err != nil {
+		fatal(err)
+	}
+	if err := os.WriteFile(outFile, src, 0o644); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "rdbgen:", err)
+	os.Exit(1)
+}
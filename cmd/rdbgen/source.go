@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/preceeder/rdb"
+)
+
+// cmdSpec 生成一个 RdCmd 的访问对象需要的信息
+type cmdSpec struct {
+	Name  string // 生成的变量名, 例如 UserWealth
+	Expr  string // 获取 RdCmd 的表达式, 例如 UserWealthCmd
+	Key   string
+	Subs  []subSpec
+	Types map[string]string
+}
+
+type subSpec struct {
+	Name     string // CMD 中的 key
+	Expr     string // 源码中使用命令常量时的写法, 例如 rdb.HGET, 为空时生成 Command("...")
+	CmdName  string
+	Params   string
+	NoUseKey bool
+	Defaults map[string]bool
+}
+
+func (c *cmdSpec) mergeTypes(types map[string]string) {
+	if c.Types == nil {
+		c.Types = map[string]string{}
+	}
+	for k, v := range types {
+		if _, ok := c.Types[k]; !ok {
+			c.Types[k] = v
+		}
+	}
+}
+
+// parseTypes 解析 userId=int64,field=string
+func parseTypes(s string) (map[string]string, error) {
+	types := map[string]string{}
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		name, typ, ok := strings.Cut(item, "=")
+		if !ok || name == "" || typ == "" {
+			return nil, fmt.Errorf("invalid type %q, expected name=type", item)
+		}
+		types[name] = typ
+	}
+	return types, nil
+}
+
+// scanPackage 扫描目录中非测试 go 文件里所有 RdCmd 类型的包级变量
+func scanPackage(dir, outFile string) (string, []cmdSpec, error) {
+	fset := token.NewFileSet()
+	files, err := goFiles(dir, outFile)
+	if err != nil {
+		return "", nil, err
+	}
+	var pkgName string
+	var specs []cmdSpec
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return "", nil, err
+		}
+		pkgName = f.Name.Name
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+			for _, s := range gen.Specs {
+				vs := s.(*ast.ValueSpec)
+				doc := vs.Doc
+				if doc == nil && len(gen.Specs) == 1 {
+					doc = gen.Doc
+				}
+				for i, name := range vs.Names {
+					if i >= len(vs.Values) {
+						break
+					}
+					spec, ok, err := parseCmdLit(fset, name.Name, vs.Values[i], doc)
+					if err != nil {
+						return "", nil, err
+					}
+					if ok {
+						specs = append(specs, spec)
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return pkgName, specs, nil
+}
+
+// packageName 读取目录中任意一个 go 文件的包名
+func packageName(dir, outFile string) (string, error) {
+	files, err := goFiles(dir, outFile)
+	if err != nil || len(files) == 0 {
+		return "", err
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), files[0], nil, parser.PackageClauseOnly)
+	if err != nil {
+		return "", err
+	}
+	return f.Name.Name, nil
+}
+
+func goFiles(dir, outFile string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	outAbs, _ := filepath.Abs(outFile)
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file := filepath.Join(dir, name)
+		if abs, _ := filepath.Abs(file); abs == outAbs {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func parseCmdLit(fset *token.FileSet, varName string, expr ast.Expr, doc *ast.CommentGroup) (cmdSpec, bool, error) {
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok || !isType(lit.Type, "RdCmd") {
+		return cmdSpec{}, false, nil
+	}
+	spec := cmdSpec{Name: accessorName(varName), Expr: varName, Types: map[string]string{}}
+	if doc != nil {
+		for _, c := range doc.List {
+			text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+			if text == "rdbgen:skip" {
+				return cmdSpec{}, false, nil
+			}
+			if rest, ok := strings.CutPrefix(text, "rdbgen:types"); ok {
+				types, err := parseTypes(rest)
+				if err != nil {
+					return cmdSpec{}, false, fmt.Errorf("%s: %w", fset.Position(c.Pos()), err)
+				}
+				spec.Types = types
+			}
+		}
+	}
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		field, _ := kv.Key.(*ast.Ident)
+		if field == nil {
+			continue
+		}
+		switch field.Name {
+		case "Key":
+			key, ok := stringLit(kv.Value)
+			if !ok {
+				return cmdSpec{}, false, fmt.Errorf("%s: %s.Key must be a string literal", fset.Position(kv.Pos()), varName)
+			}
+			spec.Key = key
+		case "CMD":
+			m, ok := kv.Value.(*ast.CompositeLit)
+			if !ok {
+				return cmdSpec{}, false, fmt.Errorf("%s: %s.CMD must be a map literal", fset.Position(kv.Pos()), varName)
+			}
+			for _, e := range m.Elts {
+				skv, ok := e.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				sub, err := parseSubCmdLit(fset, skv)
+				if err != nil {
+					return cmdSpec{}, false, err
+				}
+				spec.Subs = append(spec.Subs, sub)
+			}
+		}
+	}
+	sort.Slice(spec.Subs, func(i, j int) bool { return spec.Subs[i].Name < spec.Subs[j].Name })
+	return spec, true, nil
+}
+
+func parseSubCmdLit(fset *token.FileSet, kv *ast.KeyValueExpr) (subSpec, error) {
+	sub := subSpec{Defaults: map[string]bool{}}
+	switch k := kv.Key.(type) {
+	case *ast.Ident:
+		sub.Name, sub.Expr = k.Name, k.Name
+	case *ast.SelectorExpr:
+		pkg, ok := k.X.(*ast.Ident)
+		if !ok {
+			return sub, fmt.Errorf("%s: unsupported command key", fset.Position(kv.Pos()))
+		}
+		sub.Name, sub.Expr = k.Sel.Name, pkg.Name+"."+k.Sel.Name
+	default:
+		name, ok := stringLit(kv.Key)
+		if !ok {
+			return sub, fmt.Errorf("%s: unsupported command key", fset.Position(kv.Pos()))
+		}
+		sub.Name = name
+	}
+	lit, ok := kv.Value.(*ast.CompositeLit)
+	if !ok {
+		return sub, fmt.Errorf("%s: %s must be a RdSubCmd literal", fset.Position(kv.Pos()), sub.Name)
+	}
+	for _, elt := range lit.Elts {
+		fkv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		field, _ := fkv.Key.(*ast.Ident)
+		if field == nil {
+			continue
+		}
+		switch field.Name {
+		case "Params":
+			sub.Params, ok = stringLit(fkv.Value)
+		case "CmdName":
+			sub.CmdName, ok = stringLit(fkv.Value)
+		case "NoUseKey":
+			ident, isIdent := fkv.Value.(*ast.Ident)
+			sub.NoUseKey, ok = isIdent && ident.Name == "true", isIdent
+		case "DefaultParams":
+			m, isMap := fkv.Value.(*ast.CompositeLit)
+			ok = isMap
+			if isMap {
+				for _, e := range m.Elts {
+					if dkv, isKV := e.(*ast.KeyValueExpr); isKV {
+						if name, isStr := stringLit(dkv.Key); isStr {
+							sub.Defaults[name] = true
+						}
+					}
+				}
+			}
+		}
+		if !ok {
+			return sub, fmt.Errorf("%s: %s.%s must be a literal", fset.Position(fkv.Pos()), sub.Name, field.Name)
+		}
+	}
+	return sub, nil
+}
+
+// loadDefinitions 从 yaml/json 定义生成, 运行时通过 registry 取得 RdCmd
+func loadDefinitions(path, registry string) ([]cmdSpec, error) {
+	r := rdb.NewRegistry()
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		err = r.LoadFS(os.DirFS(path), ".")
+	} else {
+		err = r.LoadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var specs []cmdSpec
+	for _, name := range r.CmdNames() {
+		cmd := r.MustCmd(name)
+		spec := cmdSpec{
+			Name:  exported(name),
+			Expr:  fmt.Sprintf("%s.MustCmd(%q)", registry, name),
+			Key:   cmd.Key,
+			Types: map[string]string{},
+		}
+		for cmdName, sub := range cmd.CMD {
+			s := subSpec{
+				Name:     string(cmdName),
+				CmdName:  sub.CmdName,
+				Params:   sub.Params,
+				NoUseKey: sub.NoUseKey,
+				Defaults: map[string]bool{},
+			}
+			for k := range sub.DefaultParams {
+				s.Defaults[k] = true
+			}
+			spec.Subs = append(spec.Subs, s)
+		}
+		sort.Slice(spec.Subs, func(i, j int) bool { return spec.Subs[i].Name < spec.Subs[j].Name })
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func isType(expr ast.Expr, name string) bool {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name == name
+	case *ast.SelectorExpr:
+		return t.Sel.Name == name
+	}
+	return false
+}
+
+func stringLit(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// accessorName UserWealthCmd -> UserWealth, 没有 Cmd 后缀的加上 Cmds 避免和原变量重名
+func accessorName(name string) string {
+	name = exported(name)
+	if trimmed := strings.TrimSuffix(name, "Cmd"); trimmed != name && trimmed != "" {
+		return trimmed
+	}
+	return name + "Cmds"
+}
+
+func exported(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if r == '_' || r == '-' || r == ':' || r == '.' {
+			upper = true
+			continue
+		}
+		if upper {
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
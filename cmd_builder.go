@@ -8,6 +8,7 @@ import (
 
 // CommandBuilder 命令构建器，支持链式调用
 // 同时实现 redis.Cmder 接口，以便可以直接作为 redis.Cmder 使用
+// 每个 CommandBuilder 最多执行一次, 原始回复缓存在 *redis.Cmd 中, Int()/StringSlice()/ZSlice() 等方法从原始回复转换
 type CommandBuilder struct {
 	client      *RedisClient
 	pipeliner   redis.Pipeliner // 如果设置，表示在 Pipeline 中
@@ -16,7 +17,14 @@ type CommandBuilder struct {
 	cmdName     Command
 	args        map[string]any
 	includeArgs []any
-	cmder       redis.Cmder // 缓存的 cmder，用于实现 redis.Cmder 接口
+	cmder       redis.Cmder      // 缓存的原始 *redis.Cmd，用于实现 redis.Cmder 接口
+	typed       []redis.Cmder    // 从原始回复转换得到的各种类型的 cmder, 同一种类型只转换一次
+	done        bool             // 已经拿到回复, pipeline 中要在 Exec 之后才为 true
+	returnNil   bool             // 执行时子命令的 ReturnNilError, 批量执行的时候使用
+	attempts    int              // 直接执行的次数, 包括重试
+	redact      []string         // pipeline 中的 Explain 使用, 来自 Config.RedactParams
+	expire      *expirePlan      // 过期时间的执行结果
+	tracker     *pipelineTracker // pipeline 中 Exec 之后统一检查过期时间和转换结果
 }
 
 // 实现 redis.Cmder 接口，以便 CommandBuilder 可以直接作为 redis.Cmder 使用
@@ -31,103 +39,216 @@ func (cb *CommandBuilder) Args() []interface{} {
 	if cb.cmder != nil {
 		return cb.cmder.Args()
 	}
-	cmdList, _, _ := Build(cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	cmdList, _, _, _ := build(cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
 	return cmdList
 }
 
 func (cb *CommandBuilder) SetErr(err error) {
 	if cb.cmder != nil {
-		if setter, ok := cb.cmder.(interface{ SetErr(error) }); ok {
-			setter.SetErr(err)
-		}
+		cb.cmder.SetErr(err)
 	}
 }
 
 func (cb *CommandBuilder) Err() error {
-	// 如果还未执行，使用默认的 *redis.Cmd 执行
-	if cb.cmder == nil {
-		cmdList, key, subCmd := Build(cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cmder := redis.NewCmd(cb.ctx, cmdList...)
-
-		if cb.pipeliner != nil {
-			_ = cb.pipeliner.Process(cb.ctx, cmder)
-			if subCmd.Exp != nil {
-				exp := subCmd.Exp()
-				cb.pipeliner.Expire(cb.ctx, key, exp)
-			}
-			cb.cmder = cmder
-		} else {
-			processErr := cb.client.Client.Process(cb.ctx, cmder)
-			cmdErr := cmder.Err()
-			if processErr != nil {
-				cmdErr = processErr
-			}
-			if !subCmd.ReturnNilError && errors.Is(cmdErr, redis.Nil) {
-				cmdErr = nil
-			}
-			if cmdErr != nil {
-				cmder.SetErr(cmdErr)
-			}
-			if subCmd.Exp != nil {
-				exp := subCmd.Exp()
-				expireCmd := cb.client.Client.Expire(cb.ctx, key, exp)
-				if expireCmd.Err() != nil {
-					// 记录错误但不影响主命令
-				}
-			}
-			cb.cmder = cmder
+	cb.exec()
+	return cb.cmder.Err()
+}
+
+func (cb *CommandBuilder) Val() interface{} {
+	cb.exec()
+	return cb.cmder.(*redis.Cmd).Val()
+}
+
+// exec 执行命令, 多次调用只会执行一次
+// 统一使用 *redis.Cmd 接收原始回复, 避免先调用 Err() 再调用 Int() 的时候 INCR、LPOP 这类命令被执行两次
+func (cb *CommandBuilder) exec() {
+	if cb.cmder != nil {
+		return
+	}
+	if cb.pipeliner == nil && cb.client != nil {
+		release, err := cb.client.limits.acquire(cb.ctx, cb.cmd, cb.cmdName)
+		if err != nil {
+			// 被限流的命令不发送到 redis
+			cb.fail(err)
+			return
+		}
+		defer release()
+		if cb.client.autoPipe != nil {
+			// 自动 pipeline, 合并到同一批次中发送, 阻塞到拿到结果
+			cb.client.autoPipe.do(cb)
+			return
 		}
 	}
-	if cb.cmder != nil {
-		return cb.cmder.Err()
+	cmdList, key, subCmd, buildErr := build(cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	plan := planExpire(cb.ctx, subCmd, key, cmdList, cb.pipeliner != nil)
+	cmder := redis.NewCmd(cb.ctx, plan.cmdArgs...)
+	cb.cmder = cmder
+	cb.returnNil = subCmd.ReturnNilError
+
+	switch {
+	case buildErr != nil:
+		// 构建失败(例如 slot 校验不通过)的命令不发送到 redis
+		cmder.SetErr(buildErr)
+		cb.done = true
+	case cb.pipeliner == nil && cb.client == nil:
+		cmder.SetErr(ErrUnbound)
+		cb.done = true
+	case cb.pipeliner != nil:
+		processWithExpireInPipeline(cb.ctx, cb.pipeliner, cmder, plan)
+		cb.expire = plan
+		cb.tracker.add(cb)
+	default:
+		ctx, cancel := withCmdTimeout(cb.ctx, subCmd.Timeout, cb.client.Config)
+		attempts, processErr := processWithExpire(ctx, cb.client, cmder, plan, retryFor(subCmd.Retry, subCmd.Idempotent))
+		cancel()
+		cb.expire = plan
+		cb.attempts = attempts
+		cmdErr := cmder.Err()
+		if processErr != nil {
+			cmdErr = processErr
+		}
+		if !subCmd.ReturnNilError && errors.Is(cmdErr, redis.Nil) {
+			cmdErr = nil
+		}
+		cmder.SetErr(ClassifyError(cmdErr))
+		cb.done = true
 	}
-	return nil
 }
 
-func (cb *CommandBuilder) Val() interface{} {
-	// 如果还未执行，使用默认的 *redis.Cmd 执行
+// fail 不发送命令, 直接以 err 结束, 用于限流和等待中 ctx 结束的命令
+func (cb *CommandBuilder) fail(err error) {
+	cmdList, _, _, _ := build(cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	cb.cmder = redis.NewCmd(cb.ctx, cmdList...)
+	cb.cmder.SetErr(err)
+	cb.done = true
+}
+
+// finish pipeline Exec 之后把原始回复转换到已经返回的各个类型的 cmder 上
+func (cb *CommandBuilder) finish() {
+	cb.done = true
+	for _, typed := range cb.typed {
+		cb.fill(typed)
+	}
+}
+
+func (cb *CommandBuilder) fill(dst redis.Cmder) {
+	raw := cb.cmder.(*redis.Cmd)
+	if err := raw.Err(); err != nil {
+		dst.SetErr(err)
+		return
+	}
+	if err := convertReply(dst, raw.Val()); err != nil {
+		dst.SetErr(err)
+	}
+}
+
+// typedCmd 返回 T 类型的结果, 命令只执行一次, 同一种类型多次调用返回同一个 cmder
+// 回复和 T 的结构不匹配的时候 cmder 的错误为 *ConversionError
+// pipeline 中在 Exec 之前返回的 cmder 会在 RedisPipeline.Exec 之后填充结果
+func typedCmd[T redis.Cmder](cb *CommandBuilder, newCmd func(ctx context.Context, args ...any) T) T {
+	for _, c := range cb.typed {
+		if typed, ok := c.(T); ok {
+			return typed
+		}
+	}
+	cb.exec()
+	typed := newCmd(cb.ctx, cb.cmder.Args()...)
+	cb.typed = append(cb.typed, typed)
+	if cb.done {
+		cb.fill(typed)
+	}
+	return typed
+}
+
+// ErrUnbound CommandBuilder 没有绑定 client 或者 pipeline, 不能执行
+var ErrUnbound = errors.New("rdb: command builder is not bound to a client or pipeline")
+
+// Result 显式执行之后的结果句柄, 上面的方法都不会再次执行命令
+// 直接执行的时候 Exec 返回时已经拿到回复; pipeline 中要在 RedisPipeline.Exec 之后才有结果, 可以用 Done 判断
+type Result struct {
+	*CommandBuilder
+}
+
+// Done 是否已经拿到回复
+func (r Result) Done() bool {
+	return r.done
+}
+
+// Exec 显式执行命令, 多次调用只会执行一次
+// 在 pipeline 中表示把命令加入 pipeline; ctx 会替换构建时的 ctx, 构建时的 key 前缀保持不变
+func (cb *CommandBuilder) Exec(ctx context.Context) Result {
 	if cb.cmder == nil {
-		cmdList, key, subCmd := Build(cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cmder := redis.NewCmd(cb.ctx, cmdList...)
-
-		if cb.pipeliner != nil {
-			_ = cb.pipeliner.Process(cb.ctx, cmder)
-			if subCmd.Exp != nil {
-				exp := subCmd.Exp()
-				cb.pipeliner.Expire(cb.ctx, key, exp)
-			}
-			cb.cmder = cmder
-		} else {
-			processErr := cb.client.Client.Process(cb.ctx, cmder)
-			cmdErr := cmder.Err()
-			if processErr != nil {
-				cmdErr = processErr
-			}
-			if !subCmd.ReturnNilError && errors.Is(cmdErr, redis.Nil) {
-				cmdErr = nil
-			}
-			if cmdErr != nil {
-				cmder.SetErr(cmdErr)
+		if prefix, ok := KeyPrefixFromContext(cb.ctx); ok {
+			if _, override := KeyPrefixFromContext(ctx); !override {
+				ctx = WithKeyPrefix(ctx, prefix)
 			}
-			if subCmd.Exp != nil {
-				exp := subCmd.Exp()
-				expireCmd := cb.client.Client.Expire(cb.ctx, key, exp)
-				if expireCmd.Err() != nil {
-					// 记录错误但不影响主命令
-				}
-			}
-			cb.cmder = cmder
 		}
+		cb.ctx = ctx
 	}
-	if cb.cmder != nil {
-		if valProvider, ok := cb.cmder.(interface{ Val() interface{} }); ok {
-			return valProvider.Val()
-		}
+	cb.exec()
+	return Result{cb}
+}
+
+// Do 使用构建时的 ctx 执行命令
+func (cb *CommandBuilder) Do() Result {
+	cb.exec()
+	return Result{cb}
+}
+
+// IsExecuted 是否已经执行, pipeline 中加入 pipeline 之后就返回 true, 拿到回复要看 Result.Done
+// Name/Args/IsExecuted 不会触发执行
+func (cb *CommandBuilder) IsExecuted() bool {
+	return cb.cmder != nil
+}
+
+// Attempts 直接执行的次数, 按 RdSubCmd.Retry 重试过的大于 1; 没有执行或者在 pipeline 中执行的为 0
+func (cb *CommandBuilder) Attempts() int {
+	return cb.attempts
+}
+
+// Bind 返回绑定到 pipeline 或者事务 (RedisClient.TxPipeLine) 的新 CommandBuilder, 原来的不受影响
+// 可以在一层构建命令, 在另一层决定放到哪个 pipeline 中执行
+func (cb *CommandBuilder) Bind(pipe *RedisPipeline) *CommandBuilder {
+	b := cb.rebind()
+	b.ctx = withDefaultKeyPrefix(b.ctx, pipe.keyPrefix)
+	b.pipeliner = pipe.Client
+	b.tracker = pipe.tracker
+	return b
+}
+
+// BindClient 返回绑定到 client 直接执行的新 CommandBuilder, 原来的不受影响
+func (cb *CommandBuilder) BindClient(client *RedisClient) *CommandBuilder {
+	b := cb.rebind()
+	b.ctx = withDefaultKeyPrefix(b.ctx, client.Config.KeyPrefix)
+	b.client = client
+	return b
+}
+
+// rebind 复制命令的定义, 不复制执行状态
+func (cb *CommandBuilder) rebind() *CommandBuilder {
+	return &CommandBuilder{
+		ctx:         cb.ctx,
+		cmd:         cb.cmd,
+		cmdName:     cb.cmdName,
+		args:        cb.args,
+		includeArgs: cb.includeArgs,
 	}
-	return nil
+}
+
+// ExpireErr 返回设置过期时间的错误, 没有设置过期时间或者还没有执行的时候返回 nil
+// pipeline 中要在 Exec 之后才有结果
+func (cb *CommandBuilder) ExpireErr() error {
+	return cb.expire.err()
+}
+
+// ExpireApplied 过期时间是否设置成功
+// 带有 NX/XX/GT/LT 条件并且条件不满足的时候返回 false, 合并到命令中原子执行的时候以命令本身是否成功为准
+func (cb *CommandBuilder) ExpireApplied() bool {
+	return cb.expire.applied()
 }
 
 // NewCommandBuilder 创建命令构建器
+// client 为 nil 的时候只构建不执行, 之后用 Bind/BindClient 绑定再执行
 func NewCommandBuilder(client *RedisClient, ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) *CommandBuilder {
 	return &CommandBuilder{
 		client:      client,
@@ -154,8 +275,13 @@ func NewPipelineCommandBuilder(pipeliner redis.Pipeliner, ctx context.Context, c
 // BuildCmd 构建 Redis 命令但不执行，返回构建好的 redis.Cmder
 // 这个方法可以让你构建命令，然后自己决定如何执行
 func (rdm RedisClient) BuildCmd(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) redis.Cmder {
-	cmdList, _, _ := Build(ctx, cmd, cmdName, args, includeArgs...)
-	return redis.NewCmd(ctx, cmdList...)
+	ctx = withDefaultKeyPrefix(ctx, rdm.Config.KeyPrefix)
+	cmdList, _, _, err := build(ctx, cmd, cmdName, args, includeArgs...)
+	cmder := redis.NewCmd(ctx, cmdList...)
+	if err != nil {
+		cmder.SetErr(err)
+	}
+	return cmder
 }
 
 // ExecuteCmd 执行命令并返回具体的类型
@@ -170,7 +296,10 @@ func (rdm RedisClient) BuildCmd(ctx context.Context, cmd RdCmd, cmdName Command,
 //	val, _ := cmd.Result()
 func ExecuteCmd[T redis.Cmder](rdm *RedisClient, ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) T {
 	var zero T
-	cmdList, key, subCmd := Build(ctx, cmd, cmdName, args, includeArgs...)
+	ctx = withDefaultKeyPrefix(ctx, rdm.Config.KeyPrefix)
+	cmdList, key, subCmd, buildErr := build(ctx, cmd, cmdName, args, includeArgs...)
+	plan := planExpire(ctx, subCmd, key, cmdList, false)
+	cmdList = plan.cmdArgs
 
 	// 根据泛型类型 T 创建对应的 redis.Cmder
 	var cmder redis.Cmder
@@ -219,7 +348,23 @@ func ExecuteCmd[T redis.Cmder](rdm *RedisClient, ctx context.Context, cmd RdCmd,
 		cmder = redis.NewCmd(ctx, cmdList...)
 	}
 
-	processErr := rdm.Client.Process(ctx, cmder)
+	// 构建失败(例如 slot 校验不通过)的命令不发送到 redis
+	if buildErr != nil {
+		cmder.SetErr(buildErr)
+		result, _ := cmder.(T)
+		return result
+	}
+	release, err := rdm.limits.acquire(ctx, cmd, cmdName)
+	if err != nil {
+		cmder.SetErr(err)
+		result, _ := cmder.(T)
+		return result
+	}
+	defer release()
+
+	execCtx, cancel := withCmdTimeout(ctx, subCmd.Timeout, rdm.Config)
+	_, processErr := processWithExpire(execCtx, rdm, cmder, plan, retryFor(subCmd.Retry, subCmd.Idempotent))
+	cancel()
 	cmdErr := cmder.Err()
 	if processErr != nil {
 		cmdErr = processErr
@@ -227,21 +372,7 @@ func ExecuteCmd[T redis.Cmder](rdm *RedisClient, ctx context.Context, cmd RdCmd,
 	if !subCmd.ReturnNilError && errors.Is(cmdErr, redis.Nil) {
 		cmdErr = nil
 	}
-	if cmdErr != nil {
-		// 如果 cmder 支持 SetErr，设置错误
-		if errSetter, ok := cmder.(interface{ SetErr(error) }); ok {
-			errSetter.SetErr(cmdErr)
-		}
-	}
-
-	// 设置过期时间
-	if subCmd.Exp != nil {
-		exp := subCmd.Exp()
-		expireCmd := rdm.Client.Expire(ctx, key, exp)
-		if expireCmd.Err() != nil {
-			// 记录错误但不影响主命令
-		}
-	}
+	cmder.SetErr(ClassifyError(cmdErr))
 
 	// 类型断言，确保返回的是期望的类型
 	result, ok := cmder.(T)
@@ -260,417 +391,138 @@ func ExecuteCmd[T redis.Cmder](rdm *RedisClient, ctx context.Context, cmd RdCmd,
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) String() *redis.StringCmd {
-	// 如果已经执行过，直接返回缓存的 cmder
-	if cb.cmder != nil {
-		if strCmd, ok := cb.cmder.(*redis.StringCmd); ok {
-			return strCmd
-		}
-	}
-
-	// 如果在 Pipeline 中，使用 Pipeline 模式
-	if cb.pipeliner != nil {
-		cmdList, key, subCmd := Build(cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cmder := redis.NewStringCmd(cb.ctx, cmdList...)
-		_ = cb.pipeliner.Process(cb.ctx, cmder)
-		if subCmd.Exp != nil {
-			exp := subCmd.Exp()
-			cb.pipeliner.Expire(cb.ctx, key, exp)
-		}
-		cb.cmder = cmder
-		return cmder
-	}
-
-	return ExecuteCmd[*redis.StringCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-}
-
-// executeCmdInPipeline 在 Pipeline 中执行命令的通用方法（辅助函数）
-// 根据期望的返回类型创建对应的 redis.Cmder
-// 错误通过返回的 Cmder 的 Err() 方法获取（在 Pipeline Exec() 后）
-func executeCmdInPipeline[T redis.Cmder](pipeliner redis.Pipeliner, ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) T {
-	var zero T
-	cmdList, key, subCmd := Build(ctx, cmd, cmdName, args, includeArgs...)
-
-	// 根据泛型类型 T 创建对应的 redis.Cmder
-	var cmder redis.Cmder
-	switch any(zero).(type) {
-	case *redis.StringCmd:
-		cmder = redis.NewStringCmd(ctx, cmdList...)
-	case *redis.IntCmd:
-		cmder = redis.NewIntCmd(ctx, cmdList...)
-	case *redis.SliceCmd:
-		cmder = redis.NewSliceCmd(ctx, cmdList...)
-	case *redis.FloatCmd:
-		cmder = redis.NewFloatCmd(ctx, cmdList...)
-	case *redis.BoolCmd:
-		cmder = redis.NewBoolCmd(ctx, cmdList...)
-	case *redis.MapStringIntCmd:
-		cmder = redis.NewMapStringIntCmd(ctx, cmdList...)
-	case *redis.MapStringStringCmd:
-		cmder = redis.NewMapStringStringCmd(ctx, cmdList...)
-	case *redis.StringSliceCmd:
-		cmder = redis.NewStringSliceCmd(ctx, cmdList...)
-	case *redis.IntSliceCmd:
-		cmder = redis.NewIntSliceCmd(ctx, cmdList...)
-	case *redis.FloatSliceCmd:
-		cmder = redis.NewFloatSliceCmd(ctx, cmdList...)
-	case *redis.BoolSliceCmd:
-		cmder = redis.NewBoolSliceCmd(ctx, cmdList...)
-	case *redis.KeyValueSliceCmd:
-		cmder = redis.NewKeyValueSliceCmd(ctx, cmdList...)
-	case *redis.MapStringInterfaceCmd:
-		cmder = redis.NewMapStringInterfaceCmd(ctx, cmdList...)
-	case *redis.MapStringStringSliceCmd:
-		cmder = redis.NewMapStringStringSliceCmd(ctx, cmdList...)
-	case *redis.MapStringInterfaceSliceCmd:
-		cmder = redis.NewMapStringInterfaceSliceCmd(ctx, cmdList...)
-	case *redis.MapStringSliceInterfaceCmd:
-		cmder = redis.NewMapStringSliceInterfaceCmd(ctx, cmdList...)
-	case *redis.MapMapStringInterfaceCmd:
-		cmder = redis.NewMapMapStringInterfaceCmd(ctx, cmdList...)
-	case *redis.ZSliceCmd:
-		cmder = redis.NewZSliceCmd(ctx, cmdList...)
-	case *redis.ZSliceWithKeyCmd:
-		cmder = redis.NewZSliceWithKeyCmd(ctx, cmdList...)
-	case *redis.ZWithKeyCmd:
-		cmder = redis.NewZWithKeyCmd(ctx, cmdList...)
-	default:
-		cmder = redis.NewCmd(ctx, cmdList...)
-	}
-
-	_ = pipeliner.Process(ctx, cmder)
-	if subCmd.Exp != nil {
-		exp := subCmd.Exp()
-		pipeliner.Expire(ctx, key, exp)
-	}
-
-	result, ok := cmder.(T)
-	if !ok {
-		// 如果类型不匹配，返回零值
-		// 这种情况理论上不应该发生，因为我们在 switch 中已经创建了正确的类型
-		return zero
-	}
-	return result
+	return typedCmd(cb, redis.NewStringCmd)
 }
 
 // Int 执行命令并返回 *redis.IntCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) Int() *redis.IntCmd {
-	if cb.cmder != nil {
-		if intCmd, ok := cb.cmder.(*redis.IntCmd); ok {
-			return intCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		intCmd := executeCmdInPipeline[*redis.IntCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = intCmd
-		return intCmd
-	}
-	return ExecuteCmd[*redis.IntCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewIntCmd)
 }
 
 // Slice 执行命令并返回 *redis.SliceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) Slice() *redis.SliceCmd {
-	if cb.cmder != nil {
-		if sliceCmd, ok := cb.cmder.(*redis.SliceCmd); ok {
-			return sliceCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		sliceCmd := executeCmdInPipeline[*redis.SliceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = sliceCmd
-		return sliceCmd
-	}
-	return ExecuteCmd[*redis.SliceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewSliceCmd)
 }
 
 // Float 执行命令并返回 *redis.FloatCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) Float() *redis.FloatCmd {
-	if cb.cmder != nil {
-		if floatCmd, ok := cb.cmder.(*redis.FloatCmd); ok {
-			return floatCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		floatCmd := executeCmdInPipeline[*redis.FloatCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = floatCmd
-		return floatCmd
-	}
-	return ExecuteCmd[*redis.FloatCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewFloatCmd)
 }
 
 // Bool 执行命令并返回 *redis.BoolCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) Bool() *redis.BoolCmd {
-	if cb.cmder != nil {
-		if boolCmd, ok := cb.cmder.(*redis.BoolCmd); ok {
-			return boolCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		boolCmd := executeCmdInPipeline[*redis.BoolCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = boolCmd
-		return boolCmd
-	}
-	return ExecuteCmd[*redis.BoolCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewBoolCmd)
 }
 
 // MapStringInt 执行命令并返回 *redis.MapStringIntCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) MapStringInt() *redis.MapStringIntCmd {
-	if cb.cmder != nil {
-		if mapCmd, ok := cb.cmder.(*redis.MapStringIntCmd); ok {
-			return mapCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		mapCmd := executeCmdInPipeline[*redis.MapStringIntCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = mapCmd
-		return mapCmd
-	}
-	return ExecuteCmd[*redis.MapStringIntCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewMapStringIntCmd)
 }
 
 // MapStringString 执行命令并返回 *redis.MapStringStringCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) MapStringString() *redis.MapStringStringCmd {
-	if cb.cmder != nil {
-		if mapCmd, ok := cb.cmder.(*redis.MapStringStringCmd); ok {
-			return mapCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		mapCmd := executeCmdInPipeline[*redis.MapStringStringCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = mapCmd
-		return mapCmd
-	}
-	return ExecuteCmd[*redis.MapStringStringCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewMapStringStringCmd)
 }
 
 // StringSlice 执行命令并返回 *redis.StringSliceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) StringSlice() *redis.StringSliceCmd {
-	if cb.cmder != nil {
-		if strSliceCmd, ok := cb.cmder.(*redis.StringSliceCmd); ok {
-			return strSliceCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		strSliceCmd := executeCmdInPipeline[*redis.StringSliceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = strSliceCmd
-		return strSliceCmd
-	}
-	return ExecuteCmd[*redis.StringSliceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewStringSliceCmd)
 }
 
 // IntSlice 执行命令并返回 *redis.IntSliceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) IntSlice() *redis.IntSliceCmd {
-	if cb.cmder != nil {
-		if intSliceCmd, ok := cb.cmder.(*redis.IntSliceCmd); ok {
-			return intSliceCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		intSliceCmd := executeCmdInPipeline[*redis.IntSliceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = intSliceCmd
-		return intSliceCmd
-	}
-	return ExecuteCmd[*redis.IntSliceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewIntSliceCmd)
 }
 
 // FloatSlice 执行命令并返回 *redis.FloatSliceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) FloatSlice() *redis.FloatSliceCmd {
-	if cb.cmder != nil {
-		if floatSliceCmd, ok := cb.cmder.(*redis.FloatSliceCmd); ok {
-			return floatSliceCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		floatSliceCmd := executeCmdInPipeline[*redis.FloatSliceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = floatSliceCmd
-		return floatSliceCmd
-	}
-	return ExecuteCmd[*redis.FloatSliceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewFloatSliceCmd)
 }
 
 // BoolSlice 执行命令并返回 *redis.BoolSliceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) BoolSlice() *redis.BoolSliceCmd {
-	if cb.cmder != nil {
-		if boolSliceCmd, ok := cb.cmder.(*redis.BoolSliceCmd); ok {
-			return boolSliceCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		boolSliceCmd := executeCmdInPipeline[*redis.BoolSliceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = boolSliceCmd
-		return boolSliceCmd
-	}
-	return ExecuteCmd[*redis.BoolSliceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewBoolSliceCmd)
 }
 
 // KeyValueSlice 执行命令并返回 *redis.KeyValueSliceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) KeyValueSlice() *redis.KeyValueSliceCmd {
-	if cb.cmder != nil {
-		if kvSliceCmd, ok := cb.cmder.(*redis.KeyValueSliceCmd); ok {
-			return kvSliceCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		kvSliceCmd := executeCmdInPipeline[*redis.KeyValueSliceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = kvSliceCmd
-		return kvSliceCmd
-	}
-	return ExecuteCmd[*redis.KeyValueSliceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewKeyValueSliceCmd)
 }
 
 // MapStringInterface 执行命令并返回 *redis.MapStringInterfaceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) MapStringInterface() *redis.MapStringInterfaceCmd {
-	if cb.cmder != nil {
-		if mapCmd, ok := cb.cmder.(*redis.MapStringInterfaceCmd); ok {
-			return mapCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		mapCmd := executeCmdInPipeline[*redis.MapStringInterfaceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = mapCmd
-		return mapCmd
-	}
-	return ExecuteCmd[*redis.MapStringInterfaceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewMapStringInterfaceCmd)
 }
 
 // MapStringStringSlice 执行命令并返回 *redis.MapStringStringSliceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) MapStringStringSlice() *redis.MapStringStringSliceCmd {
-	if cb.cmder != nil {
-		if mapCmd, ok := cb.cmder.(*redis.MapStringStringSliceCmd); ok {
-			return mapCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		mapCmd := executeCmdInPipeline[*redis.MapStringStringSliceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = mapCmd
-		return mapCmd
-	}
-	return ExecuteCmd[*redis.MapStringStringSliceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewMapStringStringSliceCmd)
 }
 
 // MapStringInterfaceSlice 执行命令并返回 *redis.MapStringInterfaceSliceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) MapStringInterfaceSlice() *redis.MapStringInterfaceSliceCmd {
-	if cb.cmder != nil {
-		if mapCmd, ok := cb.cmder.(*redis.MapStringInterfaceSliceCmd); ok {
-			return mapCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		mapCmd := executeCmdInPipeline[*redis.MapStringInterfaceSliceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = mapCmd
-		return mapCmd
-	}
-	return ExecuteCmd[*redis.MapStringInterfaceSliceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewMapStringInterfaceSliceCmd)
 }
 
 // MapStringSliceInterface 执行命令并返回 *redis.MapStringSliceInterfaceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) MapStringSliceInterface() *redis.MapStringSliceInterfaceCmd {
-	if cb.cmder != nil {
-		if mapCmd, ok := cb.cmder.(*redis.MapStringSliceInterfaceCmd); ok {
-			return mapCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		mapCmd := executeCmdInPipeline[*redis.MapStringSliceInterfaceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = mapCmd
-		return mapCmd
-	}
-	return ExecuteCmd[*redis.MapStringSliceInterfaceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewMapStringSliceInterfaceCmd)
 }
 
 // MapMapStringInterface 执行命令并返回 *redis.MapMapStringInterfaceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) MapMapStringInterface() *redis.MapMapStringInterfaceCmd {
-	if cb.cmder != nil {
-		if mapCmd, ok := cb.cmder.(*redis.MapMapStringInterfaceCmd); ok {
-			return mapCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		mapCmd := executeCmdInPipeline[*redis.MapMapStringInterfaceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = mapCmd
-		return mapCmd
-	}
-	return ExecuteCmd[*redis.MapMapStringInterfaceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewMapMapStringInterfaceCmd)
 }
 
 // ZSlice 执行命令并返回 *redis.ZSliceCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) ZSlice() *redis.ZSliceCmd {
-	if cb.cmder != nil {
-		if zSliceCmd, ok := cb.cmder.(*redis.ZSliceCmd); ok {
-			return zSliceCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		zSliceCmd := executeCmdInPipeline[*redis.ZSliceCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = zSliceCmd
-		return zSliceCmd
-	}
-	return ExecuteCmd[*redis.ZSliceCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewZSliceCmd)
 }
 
 // ZSliceWithKey 执行命令并返回 *redis.ZSliceWithKeyCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) ZSliceWithKey() *redis.ZSliceWithKeyCmd {
-	if cb.cmder != nil {
-		if zSliceCmd, ok := cb.cmder.(*redis.ZSliceWithKeyCmd); ok {
-			return zSliceCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		zSliceCmd := executeCmdInPipeline[*redis.ZSliceWithKeyCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = zSliceCmd
-		return zSliceCmd
-	}
-	return ExecuteCmd[*redis.ZSliceWithKeyCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewZSliceWithKeyCmd)
 }
 
 // ZWithKey 执行命令并返回 *redis.ZWithKeyCmd
 // 如果在 Pipeline 中，命令会被添加到 Pipeline，结果需要在 Exec() 后获取
 // 错误通过返回的 Cmder 的 Err() 方法获取
 func (cb *CommandBuilder) ZWithKey() *redis.ZWithKeyCmd {
-	if cb.cmder != nil {
-		if zCmd, ok := cb.cmder.(*redis.ZWithKeyCmd); ok {
-			return zCmd
-		}
-	}
-	if cb.pipeliner != nil {
-		zCmd := executeCmdInPipeline[*redis.ZWithKeyCmd](cb.pipeliner, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
-		cb.cmder = zCmd
-		return zCmd
-	}
-	return ExecuteCmd[*redis.ZWithKeyCmd](cb.client, cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs...)
+	return typedCmd(cb, redis.NewZWithKeyCmd)
 }
@@ -184,7 +184,7 @@ func TestExecuteCmd_Generic(t *testing.T) {
 	}
 
 	// 使用泛型方法 ExecuteCmd
-	cmd := ExecuteCmd[*redis.StringCmd](&client, context.Background(), StringCmd, GET, map[string]any{
+	cmd := ExecuteCmd[*redis.StringCmd](client, context.Background(), StringCmd, GET, map[string]any{
 		"keyName": "test_generic",
 	})
 	if cmd.Err() != nil {
@@ -265,7 +265,7 @@ func TestExecuteCmd_AllTypes(t *testing.T) {
 		"keyName": "test_all_types",
 		"value":   "test",
 	})
-	strCmd, _ := client.Get(context.Background(), StringCmd, map[string]any{"keyName": "test_all_types"}).String()
+	strCmd := client.Get(context.Background(), StringCmd, map[string]any{"keyName": "test_all_types"}).String()
 	fmt.Printf("String(): %T\n", strCmd)
 
 	// 测试 Int()
@@ -281,7 +281,7 @@ func TestExecuteCmd_AllTypes(t *testing.T) {
 		"keyName": "test_all_types_int",
 		"value":   "10",
 	})
-	intCmd, _ := client.Incr(context.Background(), IntCmd, map[string]any{"keyName": "test_all_types_int"}).Int()
+	intCmd := client.Incr(context.Background(), IntCmd, map[string]any{"keyName": "test_all_types_int"}).Int()
 	fmt.Printf("Int(): %T, value: %d\n", intCmd, intCmd.Val())
 
 	// 测试 Slice()
@@ -296,7 +296,7 @@ func TestExecuteCmd_AllTypes(t *testing.T) {
 	client.HMSet(context.Background(), HashCmd, map[string]any{
 		"keyName": "test_all_types_slice",
 	}, "field1", "value1")
-	sliceCmd, _ := client.HGetAll(context.Background(), HashCmd, map[string]any{"keyName": "test_all_types_slice"}).Slice()
+	sliceCmd := client.HGetAll(context.Background(), HashCmd, map[string]any{"keyName": "test_all_types_slice"}).Slice()
 	fmt.Printf("Slice(): %T\n", sliceCmd)
 
 	// 测试 Float()
@@ -312,7 +312,7 @@ func TestExecuteCmd_AllTypes(t *testing.T) {
 		"keyName": "test_all_types_float",
 		"value":   "10.5",
 	})
-	floatCmd, _ := client.IncrByFloat(context.Background(), FloatCmd, map[string]any{
+	floatCmd := client.IncrByFloat(context.Background(), FloatCmd, map[string]any{
 		"keyName":   "test_all_types_float",
 		"increment": 2.5,
 	}).Float()
@@ -327,7 +327,7 @@ func TestExecuteCmd_AllTypes(t *testing.T) {
 			},
 		},
 	}
-	boolCmd, _ := client.SetNx(context.Background(), BoolCmd, map[string]any{
+	boolCmd := client.SetNx(context.Background(), BoolCmd, map[string]any{
 		"keyName": "test_all_types_bool",
 		"value":   "test",
 	}).Bool()
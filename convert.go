@@ -0,0 +1,398 @@
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ConversionError 缓存的原始回复不能转换成请求的类型, 例如对 HGETALL 的回复调用 Int()
+type ConversionError struct {
+	Cmd    string // 命令名
+	Target string // 请求的类型, 例如 *redis.IntCmd
+	Value  any    // 原始回复
+	Err    error  // 解析失败的原因, 可能为 nil
+}
+
+func (e *ConversionError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("rdb: %s: can't convert reply %.100v to %s: %v", e.Cmd, e.Value, e.Target, e.Err)
+	}
+	return fmt.Sprintf("rdb: %s: can't convert reply %.100v (%T) to %s", e.Cmd, e.Value, e.Value, e.Target)
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// FillReply 把原始回复按照 cmd 的类型转换并设置到 cmd 上, 给 hook 或者测试替身 (rdbtest) 伪造回复使用
+// val 的格式和 *redis.Cmd.Val() 一致, 转换失败返回 *ConversionError
+func FillReply(cmd redis.Cmder, val any) error {
+	return convertReply(cmd, val)
+}
+
+// convertReply 把 *redis.Cmd 的原始回复按照 dst 的类型转换并设置到 dst 上
+// 规则与 go-redis 各类型 Cmd 的 readReply 一致, 兼容 RESP2 的扁平数组和 RESP3 的 map/嵌套数组, nil 回复转换成零值
+func convertReply(dst redis.Cmder, val any) error {
+	var err error
+	switch cmd := dst.(type) {
+	case *redis.Cmd:
+		cmd.SetVal(val)
+	case *redis.StringCmd:
+		var v string
+		if v, err = toString(val); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.StatusCmd:
+		var v string
+		if v, err = toString(val); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.IntCmd:
+		var v int64
+		if v, err = toInt64(val); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.FloatCmd:
+		var v float64
+		if v, err = toFloat64(val); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.BoolCmd:
+		var v bool
+		if v, err = toBool(val); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.SliceCmd:
+		var v []any
+		if v, err = toSlice(val); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.StringSliceCmd:
+		var v []string
+		if v, err = convertSlice(val, toString); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.IntSliceCmd:
+		var v []int64
+		if v, err = convertSlice(val, toInt64); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.FloatSliceCmd:
+		var v []float64
+		if v, err = convertSlice(val, toFloat64); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.BoolSliceCmd:
+		var v []bool
+		if v, err = convertSlice(val, toBool); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.MapStringStringCmd:
+		var v map[string]string
+		if v, err = convertMap(val, toString); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.MapStringIntCmd:
+		var v map[string]int64
+		if v, err = convertMap(val, toInt64); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.MapStringInterfaceCmd:
+		var v map[string]any
+		if v, err = convertMap(val, toAny); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.MapStringSliceInterfaceCmd:
+		var v map[string][]any
+		if v, err = convertMap(val, toSlice); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.MapStringStringSliceCmd:
+		var v []map[string]string
+		if v, err = convertSlice(val, func(e any) (map[string]string, error) { return convertMap(e, toString) }); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.MapStringInterfaceSliceCmd:
+		var v []map[string]any
+		if v, err = convertSlice(val, func(e any) (map[string]any, error) { return convertMap(e, toAny) }); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.MapMapStringInterfaceCmd:
+		// 与 go-redis 一致, RESP2 的回复是多个扁平数组, 合并到同一个 map 中
+		var v map[string]any
+		if v, err = mergeMaps(val); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.KeyValueSliceCmd:
+		var pairs [][2]any
+		if pairs, err = toPairs(val); err == nil {
+			kvs := make([]redis.KeyValue, len(pairs))
+			for i, p := range pairs {
+				if kvs[i].Key, err = toString(p[0]); err != nil {
+					break
+				}
+				if kvs[i].Value, err = toString(p[1]); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				cmd.SetVal(kvs)
+			}
+		}
+	case *redis.ZSliceCmd:
+		var v []redis.Z
+		if v, err = toZSlice(val); err == nil {
+			cmd.SetVal(v)
+		}
+	case *redis.ZSliceWithKeyCmd:
+		var key string
+		var v []redis.Z
+		if key, v, err = toZSliceWithKey(val); err == nil {
+			cmd.SetVal(key, v)
+		}
+	case *redis.ZWithKeyCmd:
+		var v *redis.ZWithKey
+		if v, err = toZWithKey(val); err == nil {
+			cmd.SetVal(v)
+		}
+	default:
+		err = errors.New("unsupported target")
+	}
+	if err != nil {
+		return &ConversionError{Cmd: dst.Name(), Target: fmt.Sprintf("%T", dst), Value: val, Err: unwrapShape(err)}
+	}
+	return nil
+}
+
+// errShape 回复的结构和目标类型不匹配, ConversionError 中不再重复
+var errShape = errors.New("unexpected reply shape")
+
+func unwrapShape(err error) error {
+	if errors.Is(err, errShape) {
+		return nil
+	}
+	return err
+}
+
+func toAny(v any) (any, error) {
+	return v, nil
+}
+
+func toString(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case *big.Int:
+		return v.String(), nil
+	}
+	return "", errShape
+}
+
+func toInt64(v any) (int64, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case *big.Int:
+		if !v.IsInt64() {
+			return 0, fmt.Errorf("bigInt(%s) value out of range", v)
+		}
+		return v.Int64(), nil
+	}
+	return 0, errShape
+}
+
+func toFloat64(v any) (float64, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, errShape
+}
+
+// toBool 与 go-redis 的 ReadBool 一致, OK/1/true 为 true
+func toBool(v any) (bool, error) {
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	s, err := toString(v)
+	if err != nil {
+		return false, err
+	}
+	return s == "OK" || s == "1" || s == "true", nil
+}
+
+func toSlice(v any) ([]any, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		return v, nil
+	}
+	return nil, errShape
+}
+
+func convertSlice[T any](v any, conv func(any) (T, error)) ([]T, error) {
+	arr, err := toSlice(v)
+	if err != nil || arr == nil {
+		return nil, err
+	}
+	out := make([]T, len(arr))
+	for i, e := range arr {
+		if out[i], err = conv(e); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// toPairs 把 RESP3 的 map、RESP2 的扁平数组 [k1, v1, k2, v2] 或者嵌套数组 [[k1, v1], [k2, v2]] 统一成键值对
+func toPairs(v any) ([][2]any, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case map[any]any:
+		pairs := make([][2]any, 0, len(v))
+		for k, e := range v {
+			pairs = append(pairs, [2]any{k, e})
+		}
+		return pairs, nil
+	case []any:
+		if len(v) > 0 {
+			if _, nested := v[0].([]any); nested {
+				pairs := make([][2]any, len(v))
+				for i, e := range v {
+					pair, ok := e.([]any)
+					if !ok || len(pair) != 2 {
+						return nil, errShape
+					}
+					pairs[i] = [2]any{pair[0], pair[1]}
+				}
+				return pairs, nil
+			}
+		}
+		if len(v)%2 != 0 {
+			return nil, errShape
+		}
+		pairs := make([][2]any, len(v)/2)
+		for i := range pairs {
+			pairs[i] = [2]any{v[2*i], v[2*i+1]}
+		}
+		return pairs, nil
+	}
+	return nil, errShape
+}
+
+func convertMap[T any](v any, conv func(any) (T, error)) (map[string]T, error) {
+	pairs, err := toPairs(v)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]T, len(pairs))
+	for _, p := range pairs {
+		k, ok := p[0].(string)
+		if !ok {
+			return nil, errShape
+		}
+		if m[k], err = conv(p[1]); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func mergeMaps(v any) (map[string]any, error) {
+	if arr, ok := v.([]any); ok {
+		m := map[string]any{}
+		for _, e := range arr {
+			sub, err := convertMap(e, toAny)
+			if err != nil {
+				return nil, err
+			}
+			for k, val := range sub {
+				m[k] = val
+			}
+		}
+		return m, nil
+	}
+	return convertMap(v, toAny)
+}
+
+func toZSlice(v any) ([]redis.Z, error) {
+	pairs, err := toPairs(v)
+	if err != nil {
+		return nil, err
+	}
+	zs := make([]redis.Z, len(pairs))
+	for i, p := range pairs {
+		member, err := toString(p[0])
+		if err != nil {
+			return nil, err
+		}
+		if zs[i].Score, err = toFloat64(p[1]); err != nil {
+			return nil, err
+		}
+		zs[i].Member = member
+	}
+	return zs, nil
+}
+
+func toZSliceWithKey(v any) (string, []redis.Z, error) {
+	arr, err := toSlice(v)
+	if err != nil || arr == nil {
+		return "", nil, err
+	}
+	if len(arr) != 2 {
+		return "", nil, errShape
+	}
+	key, err := toString(arr[0])
+	if err != nil {
+		return "", nil, err
+	}
+	zs, err := toZSlice(arr[1])
+	return key, zs, err
+}
+
+func toZWithKey(v any) (*redis.ZWithKey, error) {
+	arr, err := toSlice(v)
+	if err != nil || arr == nil {
+		return nil, err
+	}
+	if len(arr) != 3 {
+		return nil, errShape
+	}
+	z := &redis.ZWithKey{}
+	if z.Key, err = toString(arr[0]); err != nil {
+		return nil, err
+	}
+	member, err := toString(arr[1])
+	if err != nil {
+		return nil, err
+	}
+	z.Member = member
+	if z.Score, err = toFloat64(arr[2]); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
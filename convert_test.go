@@ -0,0 +1,80 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func Test_convertReply(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		dst  redis.Cmder
+		val  any
+		want any
+	}{
+		{redis.NewStringCmd(ctx, "GET"), "v", "v"},
+		{redis.NewStringCmd(ctx, "INCR"), int64(5), "5"},
+		{redis.NewStringCmd(ctx, "GET"), nil, ""},
+		{redis.NewStatusCmd(ctx, "SET"), "OK", "OK"},
+		{redis.NewIntCmd(ctx, "GET"), "42", int64(42)},
+		{redis.NewFloatCmd(ctx, "ZSCORE"), "1.5", 1.5},
+		{redis.NewFloatCmd(ctx, "ZSCORE"), 1.5, 1.5},
+		{redis.NewBoolCmd(ctx, "SET"), "OK", true},
+		{redis.NewBoolCmd(ctx, "EXPIRE"), int64(0), false},
+		{redis.NewStringSliceCmd(ctx, "LRANGE"), []any{"a", int64(1), nil}, []string{"a", "1", ""}},
+		{redis.NewIntSliceCmd(ctx, "SMISMEMBER"), []any{int64(1), int64(0)}, []int64{1, 0}},
+		{redis.NewBoolSliceCmd(ctx, "SMISMEMBER"), []any{int64(1), int64(0)}, []bool{true, false}},
+		{redis.NewMapStringStringCmd(ctx, "HGETALL"), []any{"f", "v"}, map[string]string{"f": "v"}},
+		{redis.NewMapStringStringCmd(ctx, "HGETALL"), map[any]any{"f": "v"}, map[string]string{"f": "v"}},
+		{redis.NewMapStringIntCmd(ctx, "HGETALL"), []any{"f", "3"}, map[string]int64{"f": 3}},
+		{redis.NewZSliceCmd(ctx, "ZRANGE"), []any{"a", "1", "b", "2.5"}, []redis.Z{{Member: "a", Score: 1}, {Member: "b", Score: 2.5}}},
+		{redis.NewZSliceCmd(ctx, "ZRANGE"), []any{[]any{"a", 1.0}}, []redis.Z{{Member: "a", Score: 1}}},
+		{redis.NewKeyValueSliceCmd(ctx, "X"), []any{"k", "v"}, []redis.KeyValue{{Key: "k", Value: "v"}}},
+		{redis.NewMapStringInterfaceSliceCmd(ctx, "X"), []any{[]any{"a", int64(1)}, map[any]any{"b": "2"}}, []map[string]any{{"a": int64(1)}, {"b": "2"}}},
+		{redis.NewMapStringSliceInterfaceCmd(ctx, "X"), map[any]any{"k": []any{"v"}}, map[string][]any{"k": {"v"}}},
+		{redis.NewMapMapStringInterfaceCmd(ctx, "X"), []any{[]any{"a", int64(1)}, []any{"b", int64(2)}}, map[string]any{"a": int64(1), "b": int64(2)}},
+		{redis.NewZWithKeyCmd(ctx, "BZPOPMIN"), []any{"k", "m", "3"}, &redis.ZWithKey{Key: "k", Z: redis.Z{Member: "m", Score: 3}}},
+	}
+	for _, tt := range tests {
+		if err := convertReply(tt.dst, tt.val); err != nil {
+			t.Errorf("%T %v: %v", tt.dst, tt.val, err)
+			continue
+		}
+		got := reflect.ValueOf(tt.dst).MethodByName("Val").Call(nil)[0].Interface()
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%T %v: got %#v, want %#v", tt.dst, tt.val, got, tt.want)
+		}
+	}
+
+	zs := redis.NewZSliceWithKeyCmd(ctx, "ZMPOP")
+	if err := convertReply(zs, []any{"k", []any{[]any{"m", "1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if key, val := zs.Val(); key != "k" || !reflect.DeepEqual(val, []redis.Z{{Member: "m", Score: 1}}) {
+		t.Errorf("unexpected ZSliceWithKey %s %v", key, val)
+	}
+}
+
+func Test_convertReply_Error(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		dst redis.Cmder
+		val any
+	}{
+		{redis.NewIntCmd(ctx, "GET"), "abc"},
+		{redis.NewIntCmd(ctx, "HGETALL"), []any{"f", "v"}},
+		{redis.NewMapStringStringCmd(ctx, "LRANGE"), []any{"a", "b", "c"}},
+		{redis.NewZWithKeyCmd(ctx, "GET"), "v"},
+	}
+	for _, tt := range tests {
+		err := convertReply(tt.dst, tt.val)
+		var convErr *ConversionError
+		if !errors.As(err, &convErr) || convErr.Target != reflect.TypeOf(tt.dst).String() {
+			t.Errorf("%T %v: expected ConversionError, got %v", tt.dst, tt.val, err)
+		}
+	}
+}
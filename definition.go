@@ -0,0 +1,538 @@
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 从 yaml/json 文件加载 RdCmd 和 LuaScript 定义, json 是 yaml 的子集, 统一用 yaml 解析
+// 子命令的名字不区分大小写, 必须是已知的命令; 自定义的名字需要用 cmdName 指定真正的命令
+// 文件格式:
+//
+//	cmds:
+//	  UserWealth:
+//	    key: "user:{{userId}}:wealth"
+//	    hashTag: userId            # 可选
+//	    checkSlot: false           # 可选
+//	    cmd:
+//	      HSET:
+//	        params: "{{field}} {{value}}"
+//	        ttl: 30s
+//	        ttlCond: NX            # 可选, NX/XX/GT/LT
+//	        ttlJitter: 5s          # 可选, 随机抖动
+//	        ttlTarget: dest        # 可选, dest/all, 过期时间设置在目标 key 或者所有 key 上
+//	        atomicTtl: true        # 可选, 命令和过期时间原子执行
+//	        strictTtl: true        # 可选, 过期时间设置失败作为命令的错误
+//	        timeout: 200ms         # 可选, 直接执行的超时时间
+//	      expireLong:
+//	        cmdName: EXPIRE
+//	        params: "{{expireTime}}"
+//	        defaultParams: {expireTime: 176400}
+//	        returnNilError: false
+//	        noUseKey: false
+//	luas:
+//	  SetUserList:
+//	    script: "return redis.call('GET', KEYS[1])"
+//	    keys: [paramsKey]
+//	    args: [size]
+//	    default: {size: 30}
+//	    checkSlot: false
+//	    timeout: 1s                # 可选
+
+// DefinitionError 定义文件中的错误, 带有文件名和行号
+type DefinitionError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *DefinitionError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *DefinitionError) Unwrap() error {
+	return e.Err
+}
+
+type subCmdDefinition struct {
+	CmdName        string         `yaml:"cmdName"`
+	Params         string         `yaml:"params"`
+	TTL            string         `yaml:"ttl"`
+	TTLCond        string         `yaml:"ttlCond"`
+	TTLJitter      string         `yaml:"ttlJitter"`
+	TTLTarget      string         `yaml:"ttlTarget"`
+	AtomicTTL      bool           `yaml:"atomicTtl"`
+	StrictTTL      bool           `yaml:"strictTtl"`
+	DefaultParams  map[string]any `yaml:"defaultParams"`
+	NoUseKey       bool           `yaml:"noUseKey"`
+	ReturnNilError bool           `yaml:"returnNilError"`
+	Timeout        string         `yaml:"timeout"`
+}
+
+type luaDefinition struct {
+	Script    string         `yaml:"script"`
+	Keys      []string       `yaml:"keys"`
+	Args      []string       `yaml:"args"`
+	Default   map[string]any `yaml:"default"`
+	CheckSlot bool           `yaml:"checkSlot"`
+	Timeout   string         `yaml:"timeout"`
+}
+
+var (
+	fileFields   = []string{"cmds", "luas"}
+	cmdFields    = []string{"key", "hashTag", "checkSlot", "cmd"}
+	subCmdFields = []string{"cmdName", "params", "ttl", "ttlCond", "ttlJitter", "ttlTarget", "atomicTtl", "strictTtl", "defaultParams", "noUseKey", "returnNilError", "timeout"}
+	luaFields    = []string{"script", "keys", "args", "default", "checkSlot", "timeout"}
+)
+
+// definitionLoader 解析单个文件, 收集所有错误
+type definitionLoader struct {
+	file string
+	cmds map[string]RdCmd
+	luas map[string]LuaScript
+	line map[string]int // 定义名对应的行号, 用于报告重复定义
+	errs []error
+}
+
+func (l *definitionLoader) errorf(line int, format string, args ...any) {
+	l.errs = append(l.errs, &DefinitionError{File: l.file, Line: line, Err: fmt.Errorf(format, args...)})
+}
+
+// Load 解析 yaml/json 内容并注册到 Registry, file 只用于错误信息
+// 文件中有任何错误都不会注册其中的定义, 返回的错误包含所有问题
+func (r *Registry) Load(file string, data []byte) error {
+	l, err := parseDefinitions(file, data)
+	if err != nil {
+		return err
+	}
+	return r.register(l)
+}
+
+// parseDefinitions 解析并校验一个文件, 不修改 Registry
+func parseDefinitions(file string, data []byte) (*definitionLoader, error) {
+	l := &definitionLoader{
+		file: file,
+		cmds: map[string]RdCmd{},
+		luas: map[string]LuaScript{},
+		line: map[string]int{},
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, &DefinitionError{File: file, Err: err}
+	}
+	if len(root.Content) == 0 {
+		return l, nil
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, &DefinitionError{File: file, Line: doc.Line, Err: errors.New("top level must be a mapping")}
+	}
+	l.checkFields(doc, fileFields)
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		k, v := doc.Content[i], doc.Content[i+1]
+		switch k.Value {
+		case "cmds":
+			l.eachEntry(v, l.parseCmd)
+		case "luas":
+			l.eachEntry(v, l.parseLua)
+		}
+	}
+	if len(l.errs) > 0 {
+		return nil, errors.Join(l.errs...)
+	}
+	return l, nil
+}
+
+// register 一次性注册多个文件的定义, 和 Registry 中已有的或者文件之间有重复的名字时都不注册
+func (r *Registry) register(loaders ...*definitionLoader) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	cmdFile, luaFile := map[string]string{}, map[string]string{}
+	for _, l := range loaders {
+		for name := range l.cmds {
+			if _, ok := r.cmds[name]; ok {
+				l.errorf(l.line["cmd:"+name], "cmd %s already registered", name)
+			} else if other, ok := cmdFile[name]; ok {
+				l.errorf(l.line["cmd:"+name], "cmd %s already defined in %s", name, other)
+			}
+			cmdFile[name] = l.file
+		}
+		for name := range l.luas {
+			if _, ok := r.luas[name]; ok {
+				l.errorf(l.line["lua:"+name], "lua %s already registered", name)
+			} else if other, ok := luaFile[name]; ok {
+				l.errorf(l.line["lua:"+name], "lua %s already defined in %s", name, other)
+			}
+			luaFile[name] = l.file
+		}
+		errs = append(errs, l.errs...)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	for _, l := range loaders {
+		for name, cmd := range l.cmds {
+			r.cmds[name] = cmd
+		}
+		for name, lua := range l.luas {
+			r.luas[name] = lua
+		}
+	}
+	return nil
+}
+
+// LoadFile 从文件加载定义
+func (r *Registry) LoadFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return r.Load(file, data)
+}
+
+// LoadFS 加载 fsys 中 dir 目录下(包含子目录)所有 .yaml .yml .json 文件, 可以直接传入 embed.FS
+// 先解析校验所有文件再一起注册, 任何一个文件有错误都不会注册任何定义
+func (r *Registry) LoadFS(fsys fs.FS, dir string) error {
+	var errs []error
+	var loaders []*definitionLoader
+	err := fs.WalkDir(fsys, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(path.Ext(p)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		l, err := parseDefinitions(p, data)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			loaders = append(loaders, l)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return r.register(loaders...)
+}
+
+func (l *definitionLoader) checkFields(n *yaml.Node, allowed []string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k := n.Content[i]
+		known := false
+		for _, f := range allowed {
+			if k.Value == f {
+				known = true
+				break
+			}
+		}
+		if !known {
+			l.errorf(k.Line, "unknown field %q", k.Value)
+		}
+	}
+}
+
+func (l *definitionLoader) eachEntry(n *yaml.Node, parse func(name string, k, v *yaml.Node)) {
+	if n.Kind != yaml.MappingNode {
+		l.errorf(n.Line, "expected a mapping of definitions")
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Value == "" {
+			l.errorf(k.Line, "definition name is empty")
+			continue
+		}
+		if v.Kind != yaml.MappingNode {
+			l.errorf(v.Line, "%s: expected a mapping", k.Value)
+			continue
+		}
+		parse(k.Value, k, v)
+	}
+}
+
+func (l *definitionLoader) parseCmd(name string, k, v *yaml.Node) {
+	if _, ok := l.cmds[name]; ok {
+		l.errorf(k.Line, "cmd %s defined twice", name)
+		return
+	}
+	l.checkFields(v, cmdFields)
+	cmd := RdCmd{CMD: map[Command]RdSubCmd{}}
+	var subCmds *yaml.Node
+	for i := 0; i+1 < len(v.Content); i += 2 {
+		fk, fv := v.Content[i], v.Content[i+1]
+		var err error
+		switch fk.Value {
+		case "key":
+			err = fv.Decode(&cmd.Key)
+		case "hashTag":
+			err = fv.Decode(&cmd.HashTag)
+		case "checkSlot":
+			err = fv.Decode(&cmd.CheckSlot)
+		case "cmd":
+			subCmds = fv
+		}
+		if err != nil {
+			l.errorf(fv.Line, "%s.%s: %v", name, fk.Value, err)
+		}
+	}
+	if err := validateCmdKey(cmd); err != nil {
+		l.errorf(k.Line, "%s: %v", name, err)
+	}
+	if subCmds == nil || subCmds.Kind != yaml.MappingNode || len(subCmds.Content) == 0 {
+		l.errorf(k.Line, "%s: cmd must define at least one sub command", name)
+	} else {
+		for i := 0; i+1 < len(subCmds.Content); i += 2 {
+			sk, sv := subCmds.Content[i], subCmds.Content[i+1]
+			sub, ok := l.parseSubCmd(name, sk, sv)
+			if !ok {
+				continue
+			}
+			// 子命令本身就是命令名的时候统一用大写, 设置了 cmdName 的是自定义的名字, 保持原样
+			subName := Command(sk.Value)
+			if sub.CmdName == "" {
+				subName = Command(strings.ToUpper(sk.Value))
+			}
+			if _, ok := cmd.CMD[subName]; ok {
+				l.errorf(sk.Line, "%s.%s defined twice", name, sk.Value)
+				continue
+			}
+			cmd.CMD[subName] = sub
+		}
+	}
+	l.cmds[name] = cmd
+	l.line["cmd:"+name] = k.Line
+}
+
+func (l *definitionLoader) parseSubCmd(name string, k, v *yaml.Node) (RdSubCmd, bool) {
+	var def subCmdDefinition
+	// HGET: {} 或者 HGET: 都表示没有额外配置
+	if v.Kind == yaml.MappingNode {
+		l.checkFields(v, subCmdFields)
+		if err := v.Decode(&def); err != nil {
+			l.errorf(v.Line, "%s.%s: %v", name, k.Value, err)
+			return RdSubCmd{}, false
+		}
+	} else if v.Tag != "!!null" {
+		l.errorf(v.Line, "%s.%s: expected a mapping", name, k.Value)
+		return RdSubCmd{}, false
+	}
+	sub := RdSubCmd{
+		CmdName:        strings.ToUpper(def.CmdName),
+		Params:         def.Params,
+		DefaultParams:  normalizeDefaults(def.DefaultParams),
+		NoUseKey:       def.NoUseKey,
+		ReturnNilError: def.ReturnNilError,
+		AtomicExpire:   def.AtomicTTL,
+		ExpireStrict:   def.StrictTTL,
+	}
+	if def.TTL != "" {
+		ttl, err := time.ParseDuration(def.TTL)
+		if err != nil || ttl <= 0 {
+			l.errorf(fieldLine(v, "ttl"), "%s.%s: invalid ttl %q", name, k.Value, def.TTL)
+			return RdSubCmd{}, false
+		}
+		policy := ExpireIn(ttl)
+		switch cond := ExpireCond(strings.ToUpper(def.TTLCond)); cond {
+		case ExpireAlways, ExpireNX, ExpireXX, ExpireGT, ExpireLT:
+			policy = policy.WithCond(cond)
+		default:
+			l.errorf(fieldLine(v, "ttlCond"), "%s.%s: invalid ttlCond %q", name, k.Value, def.TTLCond)
+			return RdSubCmd{}, false
+		}
+		if def.TTLJitter != "" {
+			jitter, err := time.ParseDuration(def.TTLJitter)
+			if err != nil || jitter < 0 {
+				l.errorf(fieldLine(v, "ttlJitter"), "%s.%s: invalid ttlJitter %q", name, k.Value, def.TTLJitter)
+				return RdSubCmd{}, false
+			}
+			policy = policy.WithJitter(jitter)
+		}
+		sub.Expire = policy
+		switch target := ExpireTarget(def.TTLTarget); target {
+		case ExpireTargetKey, ExpireTargetDest, ExpireTargetAll:
+			sub.ExpireTarget = target
+		default:
+			l.errorf(fieldLine(v, "ttlTarget"), "%s.%s: invalid ttlTarget %q", name, k.Value, def.TTLTarget)
+			return RdSubCmd{}, false
+		}
+	} else if def.TTLCond != "" || def.TTLJitter != "" || def.TTLTarget != "" || def.AtomicTTL || def.StrictTTL {
+		l.errorf(k.Line, "%s.%s: ttlCond, ttlJitter, ttlTarget, atomicTtl and strictTtl require ttl", name, k.Value)
+		return RdSubCmd{}, false
+	}
+	if def.Timeout != "" {
+		timeout, err := time.ParseDuration(def.Timeout)
+		if err != nil || timeout <= 0 {
+			l.errorf(fieldLine(v, "timeout"), "%s.%s: invalid timeout %q", name, k.Value, def.Timeout)
+			return RdSubCmd{}, false
+		}
+		sub.Timeout = timeout
+	}
+	if err := validateSubCmd(Command(k.Value), sub); err != nil {
+		l.errorf(k.Line, "%s.%s: %v", name, k.Value, err)
+		return RdSubCmd{}, false
+	}
+	realName, line := sub.CmdName, fieldLine(v, "cmdName")
+	if realName == "" {
+		realName, line = strings.ToUpper(k.Value), k.Line
+	}
+	if !knownCommands[Command(realName)] {
+		l.errorf(line, "%s.%s: unknown command %s", name, k.Value, realName)
+		return RdSubCmd{}, false
+	}
+	return sub, true
+}
+
+func (l *definitionLoader) parseLua(name string, k, v *yaml.Node) {
+	if _, ok := l.luas[name]; ok {
+		l.errorf(k.Line, "lua %s defined twice", name)
+		return
+	}
+	l.checkFields(v, luaFields)
+	var def luaDefinition
+	if err := v.Decode(&def); err != nil {
+		l.errorf(v.Line, "%s: %v", name, err)
+		return
+	}
+	lua := LuaScript{
+		Script:    def.Script,
+		Keys:      def.Keys,
+		Args:      def.Args,
+		Default:   normalizeDefaults(def.Default),
+		CheckSlot: def.CheckSlot,
+	}
+	if def.Timeout != "" {
+		timeout, err := time.ParseDuration(def.Timeout)
+		if err != nil || timeout <= 0 {
+			l.errorf(fieldLine(v, "timeout"), "%s: invalid timeout %q", name, def.Timeout)
+			return
+		}
+		lua.Timeout = timeout
+	}
+	if err := validateLua(lua); err != nil {
+		l.errorf(k.Line, "%s: %v", name, err)
+		return
+	}
+	l.luas[name] = lua
+	l.line["lua:"+name] = k.Line
+}
+
+// fieldLine 返回 mapping 中某个字段的行号, 找不到的时候返回 mapping 本身的行号
+func fieldLine(n *yaml.Node, field string) int {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == field {
+			return n.Content[i].Line
+		}
+	}
+	return n.Line
+}
+
+// normalizeDefaults yaml 中的列表会解析成 []any, 转成 highPerfReplace 支持的切片类型
+func normalizeDefaults(data map[string]any) map[string]any {
+	for k, v := range data {
+		list, ok := v.([]any)
+		if !ok || len(list) == 0 {
+			continue
+		}
+		switch list[0].(type) {
+		case string:
+			data[k] = convertList[string](list, v)
+		case int:
+			data[k] = convertList[int](list, v)
+		case float64:
+			data[k] = convertList[float64](list, v)
+		}
+	}
+	return data
+}
+
+func convertList[T any](list []any, fallback any) any {
+	result := make([]T, 0, len(list))
+	for _, item := range list {
+		t, ok := item.(T)
+		if !ok {
+			return fallback
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// validateCmdKey 校验 key 模板
+func validateCmdKey(cmd RdCmd) error {
+	names, err := Placeholders(cmd.Key)
+	if err != nil {
+		return err
+	}
+	if err := validateFilters(cmd.Key); err != nil {
+		return err
+	}
+	if cmd.HashTag != "" {
+		for _, n := range names {
+			if n == cmd.HashTag {
+				return nil
+			}
+		}
+		return fmt.Errorf("hashTag %s not found in key %q", cmd.HashTag, cmd.Key)
+	}
+	return nil
+}
+
+// validateSubCmd 校验子命令
+func validateSubCmd(name Command, sub RdSubCmd) error {
+	if strings.ContainsAny(string(name), " \t") || strings.ContainsAny(sub.CmdName, " \t") {
+		return errors.New("command name must not contain spaces")
+	}
+	if err := validateFilters(sub.Params); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateLua 校验 lua 脚本定义
+func validateLua(lua LuaScript) error {
+	if strings.TrimSpace(lua.Script) == "" {
+		return errors.New("script is empty")
+	}
+	seen := map[string]bool{}
+	for _, k := range append(append([]string{}, lua.Keys...), lua.Args...) {
+		if k == "" {
+			return errors.New("keys and args must not contain empty names")
+		}
+		if seen[k] {
+			return fmt.Errorf("name %s used twice in keys/args", k)
+		}
+		seen[k] = true
+	}
+	for _, k := range lua.Keys {
+		if dv, ok := lua.Default[k]; ok {
+			if _, isStr := dv.(string); !isStr {
+				return fmt.Errorf("default for key %s must be a string", k)
+			}
+		}
+	}
+	return nil
+}
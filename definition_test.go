@@ -0,0 +1,172 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const userDefinitions = `
+cmds:
+  UserWealth:
+    key: "user:{{userId}}:wealth"
+    cmd:
+      HSET:
+        params: "{{field}} {{value}}"
+        ttl: 30s
+        ttlCond: nx
+      HGET:
+        timeout: 200ms
+      expireLong:
+        cmdName: EXPIRE
+        params: "{{expireTime}}"
+        defaultParams: {expireTime: 176400}
+      ZRANK:
+        returnNilError: true
+luas:
+  GetUser:
+    script: "return redis.call('GET', KEYS[1])"
+    keys: [userKey]
+    args: [size]
+    default: {size: 30}
+    timeout: 1s
+`
+
+func TestRegistry_Load(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Load("user.yaml", []byte(userDefinitions)); err != nil {
+		t.Fatal(err)
+	}
+	cmd := r.MustCmd("UserWealth")
+	if args := cmd.CMD[HSET].Expire.Args("k"); !reflect.DeepEqual(args, []any{"EXPIRE", "k", "30", "NX"}) {
+		t.Errorf("ttl not loaded: %v", args)
+	}
+	if !cmd.CMD[ZRANK].ReturnNilError {
+		t.Error("returnNilError not loaded")
+	}
+	if cmd.CMD[HGET].Timeout != 200*time.Millisecond || r.MustLua("GetUser").Timeout != time.Second {
+		t.Error("timeout not loaded")
+	}
+	cmdArgs, _, _ := Build(context.Background(), cmd, "expireLong", map[string]any{"userId": 1})
+	if !reflect.DeepEqual(cmdArgs, []any{"EXPIRE", "user:1:wealth", "176400"}) {
+		t.Errorf("unexpected args %v", cmdArgs)
+	}
+	lua := r.MustLua("GetUser")
+	if !reflect.DeepEqual(lua.Keys, []string{"userKey"}) || lua.Default["size"] != 30 {
+		t.Errorf("unexpected lua %+v", lua)
+	}
+}
+
+func TestRegistry_LoadJSON(t *testing.T) {
+	r := NewRegistry()
+	err := r.Load("user.json", []byte(`{"cmds": {"Counter": {"key": "counter:{{id}}", "cmd": {"INCR": {"ttl": "1h"}}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Cmd("Counter"); !ok {
+		t.Error("Counter not registered")
+	}
+}
+
+func TestRegistry_LoadErrors(t *testing.T) {
+	data := `
+cmds:
+  Bad:
+    key: "user:{{userId"
+    cmd:
+      GET:
+        ttl: soon
+        paramz: x
+      HGETT:
+        params: name
+      custom:
+        params: x
+        cmdName: incrby2
+`
+	r := NewRegistry()
+	err := r.Load("bad.yaml", []byte(data))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	var defErr *DefinitionError
+	if !errors.As(err, &defErr) || defErr.File != "bad.yaml" {
+		t.Errorf("expected DefinitionError, got %v", err)
+	}
+	for _, want := range []string{"bad.yaml:3:", "bad.yaml:7:", "bad.yaml:8:", "bad.yaml:9: Bad.HGETT: unknown command HGETT", "bad.yaml:13: Bad.custom: unknown command INCRBY2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should contain %q", err, want)
+		}
+	}
+	if len(r.CmdNames()) != 0 {
+		t.Error("nothing should be registered from a broken file")
+	}
+}
+
+func TestRegistry_LoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"rdb/user.yaml":    {Data: []byte(userDefinitions)},
+		"rdb/counter.json": {Data: []byte(`{"cmds": {"Counter": {"key": "counter", "cmd": {"INCR": {}}}}}`)},
+		"rdb/readme.md":    {Data: []byte("ignored")},
+	}
+	r := NewRegistry()
+	if err := r.LoadFS(fsys, "rdb"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.CmdNames(), []string{"Counter", "UserWealth"}) {
+		t.Errorf("unexpected names %v", r.CmdNames())
+	}
+	if err := r.LoadFS(fsys, "rdb"); err == nil {
+		t.Error("loading twice should report duplicates")
+	}
+
+	// 任何一个文件有错误都不注册, 包括文件之间重复的名字
+	for name, extra := range map[string]string{
+		"broken":    `{"cmds": {"Broken": {"key": "b", "cmd": {"GETT": {}}}}}`,
+		"duplicate": `{"cmds": {"Counter": {"key": "c2", "cmd": {"GET": {}}}}}`,
+	} {
+		fsys["rdb/z.json"] = &fstest.MapFile{Data: []byte(extra)}
+		r = NewRegistry()
+		err := r.LoadFS(fsys, "rdb")
+		var defErr *DefinitionError
+		if !errors.As(err, &defErr) || defErr.File != "rdb/z.json" {
+			t.Errorf("%s: expected DefinitionError for rdb/z.json, got %v", name, err)
+		}
+		if names := r.CmdNames(); len(names) != 0 {
+			t.Errorf("%s: nothing should be registered, got %v", name, names)
+		}
+	}
+}
+
+func TestRegistry_LoadCommandCase(t *testing.T) {
+	r := NewRegistry()
+	err := r.Load("case.yaml", []byte(`
+cmds:
+  Counter:
+    key: "counter:{{id}}"
+    cmd:
+      incr: {}
+      addSome:
+        cmdName: incrby
+        params: "{{by}}"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := r.MustCmd("Counter")
+	if _, ok := cmd.CMD[INCR]; !ok {
+		t.Errorf("sub command should be upper case, got %v", cmd.CMD)
+	}
+	cmdArgs, _, _ := Build(context.Background(), cmd, "addSome", map[string]any{"id": 1, "by": 2})
+	if !reflect.DeepEqual(cmdArgs, []any{"INCRBY", "counter:1", "2"}) {
+		t.Errorf("unexpected args %v", cmdArgs)
+	}
+
+	err = r.Load("dup.yaml", []byte(`{"cmds": {"Dup": {"key": "d", "cmd": {"get": {}, "GET": {}}}}}`))
+	if err == nil || !strings.Contains(err.Error(), "Dup.GET defined twice") {
+		t.Errorf("expected duplicate sub command error, got %v", err)
+	}
+}
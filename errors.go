@@ -0,0 +1,108 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// rdb 的错误都可以用 errors.Is/errors.As 判断, 方便映射成 HTTP 状态码等:
+//
+//	构建命令 (BuildE、BuildCmd、Explain 返回, 执行的时候作为命令的错误): ErrUnknownCommand, ErrMissingParam (*MissingParamError), ErrFilter, ErrCrossSlot
+//	执行控制: ErrUnbound, ErrBoundElsewhere, ErrCircuitOpen, ErrRateLimited, ErrExpireFailed
+//	redis 回复: ErrWrongType, ErrNoScript, ErrReadOnly, ErrUnavailable
+//	连接: ErrClosed, ErrTimeout
+//	其它: ErrKeyNotMatch, *ConversionError, *DefinitionError
+//
+// redis 回复和连接的错误由 ClassifyError 分类, 分类之后仍然可以用 errors.Is 匹配原始错误, redis.HasErrorPrefix 也依然有效
+var (
+	ErrUnknownCommand = errors.New("rdb: unknown command")
+	ErrMissingParam   = errors.New("rdb: missing param")
+	ErrFilter         = errors.New("rdb: placeholder filter failed") // {{name|filter}} 的过滤器返回错误或者不存在
+	ErrWrongType      = errors.New("rdb: wrong type")                // WRONGTYPE, key 的类型和命令不匹配
+	ErrNoScript       = errors.New("rdb: no script")                 // NOSCRIPT, EVALSHA 的脚本不存在
+	ErrReadOnly       = errors.New("rdb: read only replica")         // READONLY, 写命令发到了只读副本
+	ErrUnavailable    = errors.New("rdb: server unavailable")        // LOADING/BUSY/TRYAGAIN/CLUSTERDOWN/MASTERDOWN, 稍后重试可能成功
+	ErrClosed         = errors.New("rdb: client is closed")          // go-redis 的 redis.ErrClosed
+	ErrTimeout        = errors.New("rdb: timeout")                   // ctx 超时或者网络读写超时
+)
+
+// MissingParamError 缺少参数, 并且没有默认值
+type MissingParamError struct {
+	Name string
+}
+
+func (e *MissingParamError) Error() string {
+	return fmt.Sprintf("rdb: missing param %s", e.Name)
+}
+
+func (e *MissingParamError) Is(target error) bool {
+	return target == ErrMissingParam
+}
+
+// Error 分类之后的错误, errors.Is 可以匹配分类 Kind 也可以匹配原始错误 Err
+type Error struct {
+	Kind error // ErrWrongType、ErrTimeout 等
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// serverErrorKinds redis 错误回复的前缀对应的分类
+var serverErrorKinds = []struct {
+	prefix string
+	kind   error
+}{
+	{"WRONGTYPE", ErrWrongType},
+	{"NOSCRIPT", ErrNoScript},
+	{"READONLY", ErrReadOnly},
+	{"LOADING", ErrUnavailable},
+	{"BUSY ", ErrUnavailable}, // 不包括 BUSYGROUP、BUSYKEY
+	{"TRYAGAIN", ErrUnavailable},
+	{"CLUSTERDOWN", ErrUnavailable},
+	{"MASTERDOWN", ErrUnavailable},
+}
+
+// ClassifyError 给 redis 回复和连接的错误加上分类, 不认识的错误、redis.Nil 和已经分类过的错误原样返回
+// rdb 执行的命令已经分类过了, 直接使用 go-redis 的时候可以用它处理错误
+func ClassifyError(err error) error {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return err
+	}
+	var classified *Error
+	if errors.As(err, &classified) {
+		return err
+	}
+	if kind := errorKind(err); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	for _, k := range serverErrorKinds {
+		if redis.HasErrorPrefix(err, k.prefix) {
+			return k.kind
+		}
+	}
+	if errors.Is(err, redis.ErrClosed) {
+		return ErrClosed
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTimeout
+	}
+	return nil
+}
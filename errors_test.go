@@ -0,0 +1,94 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{serverErr("WRONGTYPE Operation against a key holding the wrong kind of value"), ErrWrongType},
+		{serverErr("NOSCRIPT No matching script. Please use EVAL."), ErrNoScript},
+		{serverErr("READONLY You can't write against a read only replica."), ErrReadOnly},
+		{serverErr("LOADING Redis is loading the dataset in memory"), ErrUnavailable},
+		{serverErr("BUSY Redis is busy running a script"), ErrUnavailable},
+		{redis.ErrClosed, ErrClosed},
+		{context.DeadlineExceeded, ErrTimeout},
+		{fmt.Errorf("dial: %w", context.DeadlineExceeded), ErrTimeout},
+	}
+	for _, tt := range tests {
+		err := ClassifyError(tt.err)
+		if !errors.Is(err, tt.kind) || !errors.Is(err, tt.err) {
+			t.Errorf("ClassifyError(%v) should match %v and the original error", tt.err, tt.kind)
+		}
+		if err.Error() != tt.err.Error() {
+			t.Errorf("message changed: %q", err)
+		}
+		if ClassifyError(err) != err {
+			t.Errorf("classifying twice should return the same error")
+		}
+	}
+	if err := ClassifyError(serverErr("WRONGTYPE x")); !redis.HasErrorPrefix(err, "WRONGTYPE") {
+		t.Error("redis.HasErrorPrefix should still work")
+	}
+	for _, err := range []error{nil, redis.Nil, serverErr("BUSYGROUP Consumer Group name already exists"), ErrCrossSlot} {
+		if ClassifyError(err) != err {
+			t.Errorf("%v should be returned unchanged", err)
+		}
+	}
+}
+
+func TestErrors_Execution(t *testing.T) {
+	client, hook := newReplyClient(func(args []any) (any, error) {
+		return nil, serverErr("WRONGTYPE Operation against a key holding the wrong kind of value")
+	})
+	str := RdCmd{Key: "s:{{id}}", CMD: map[Command]RdSubCmd{GET: {}}}
+	ctx := context.Background()
+
+	if err := client.Handler(ctx, str, GET, map[string]any{"id": 1}).String().Err(); !errors.Is(err, ErrWrongType) {
+		t.Errorf("expected ErrWrongType, got %v", err)
+	}
+	if err := ExecuteCmd[*redis.StringCmd](client, ctx, str, GET, map[string]any{"id": 1}).Err(); !errors.Is(err, ErrWrongType) {
+		t.Errorf("expected ErrWrongType from ExecuteCmd, got %v", err)
+	}
+	pipe := client.PipeLine()
+	queued := pipe.Handler(ctx, str, GET, map[string]any{"id": 1}).String()
+	if _, err := pipe.Exec(ctx); !errors.Is(err, ErrWrongType) || !errors.Is(queued.Err(), ErrWrongType) {
+		t.Errorf("expected ErrWrongType from pipeline, got %v %v", err, queued.Err())
+	}
+
+	// 没有定义的子命令和缺少的参数不发送到 redis
+	hook.calls = nil
+	if err := client.Handler(ctx, str, HGET, nil).Err(); !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("expected ErrUnknownCommand, got %v", err)
+	}
+	lua := LuaScript{Script: "return 1", Keys: []string{"userKey"}}
+	err := client.ExecScript(ctx, lua, nil, nil).Err()
+	var missing *MissingParamError
+	if !errors.Is(err, ErrMissingParam) || !errors.As(err, &missing) || missing.Name != "userKey" {
+		t.Errorf("expected MissingParamError for userKey, got %v", err)
+	}
+	// builder 的 key 和参数里缺少的占位符, 直接执行和 pipeline 中都不发送
+	user := RdCmd{Key: "user:{{id}}", CMD: map[Command]RdSubCmd{SET: {Params: "{{v}}"}}}
+	if err := client.Set(ctx, user, map[string]any{"v": "x"}).Err(); !errors.As(err, &missing) || missing.Name != "id" {
+		t.Errorf("expected MissingParamError for id, got %v", err)
+	}
+	pipe = client.PipeLine()
+	set := pipe.Set(ctx, user, map[string]any{"id": 1})
+	if _, err := pipe.Exec(ctx); err != nil || !errors.Is(set.Err(), ErrMissingParam) {
+		t.Errorf("expected ErrMissingParam in pipeline, got %v %v", err, set.Err())
+	}
+	if e := client.Explain(ctx, user, SET, map[string]any{"v": "x"}); !errors.Is(e.Err, ErrMissingParam) {
+		t.Errorf("Explain should report the same error, got %v", e.Err)
+	}
+	if len(hook.calls) != 0 {
+		t.Errorf("nothing should be sent: %v", hook.calls)
+	}
+}
@@ -0,0 +1,431 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// replyHook 不连接 redis, 按照 reply 返回的结果填充命令, 用于离线测试执行流程
+type replyHook struct {
+	mu        sync.Mutex
+	calls     []string
+	pipelines int
+	deadline  time.Time // 最近一次 pipeline 的 ctx deadline
+	reply     func(args []any) (any, error)
+}
+
+func (h *replyHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *replyHook) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		h.handle(cmd)
+		return cmd.Err()
+	}
+}
+
+func (h *replyHook) ProcessPipelineHook(redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.mu.Lock()
+		h.pipelines++
+		h.deadline, _ = ctx.Deadline()
+		h.mu.Unlock()
+		var first error
+		for _, cmd := range cmds {
+			h.handle(cmd)
+			if err := cmd.Err(); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+}
+
+func (h *replyHook) handle(cmd redis.Cmder) {
+	h.mu.Lock()
+	h.calls = append(h.calls, cmdLine(cmd.Args()))
+	h.mu.Unlock()
+	switch strings.ToUpper(cmd.Name()) {
+	case "MULTI", "EXEC":
+		return
+	}
+	val, err := h.reply(cmd.Args())
+	if err != nil {
+		cmd.SetErr(err)
+		return
+	}
+	if err := convertReply(cmd, val); err != nil {
+		cmd.SetErr(err)
+	}
+}
+
+func cmdLine(args []any) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = argString(arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+func newReplyClient(reply func(args []any) (any, error)) (*RedisClient, *replyHook) {
+	hook := &replyHook{reply: reply}
+	c := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	c.AddHook(hook)
+	client := &RedisClient{Client: c}
+	client.setup()
+	return client, hook
+}
+
+func TestCommandBuilder_ExecOnce(t *testing.T) {
+	client, hook := newReplyClient(func(args []any) (any, error) { return int64(5), nil })
+	counter := RdCmd{Key: "counter:{{id}}", CMD: map[Command]RdSubCmd{INCR: {}}}
+	cb := client.Handler(context.Background(), counter, INCR, map[string]any{"id": 1})
+
+	if err := cb.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v := cb.Int().Val(); v != 5 {
+		t.Errorf("unexpected Int %d", v)
+	}
+	if v := cb.String().Val(); v != "5" {
+		t.Errorf("unexpected String %s", v)
+	}
+	if cb.Int() != cb.Int() {
+		t.Error("same type should return the same cmder")
+	}
+	var convErr *ConversionError
+	if err := cb.StringSlice().Err(); !errors.As(err, &convErr) {
+		t.Errorf("expected ConversionError, got %v", err)
+	}
+	if len(hook.calls) != 1 || hook.calls[0] != "INCR counter:1" {
+		t.Errorf("command should be executed once, got %v", hook.calls)
+	}
+}
+
+func TestCommandBuilder_ReturnNilError(t *testing.T) {
+	client, _ := newReplyClient(func(args []any) (any, error) { return nil, redis.Nil })
+	str := RdCmd{Key: "s:{{id}}", CMD: map[Command]RdSubCmd{GET: {}, HGET: {Params: "{{f}}", ReturnNilError: true}}}
+	if err := client.Handler(context.Background(), str, GET, map[string]any{"id": 1}).String().Err(); err != nil {
+		t.Errorf("nil reply should be ignored, got %v", err)
+	}
+	if err := client.Handler(context.Background(), str, HGET, map[string]any{"id": 1, "f": "a"}).String().Err(); !errors.Is(err, redis.Nil) {
+		t.Errorf("expected redis.Nil, got %v", err)
+	}
+}
+
+func TestCommandBuilder_PipelineConvert(t *testing.T) {
+	client, hook := newReplyClient(func(args []any) (any, error) {
+		switch argString(args[0]) {
+		case "ZRANGE":
+			return []any{"a", "1", "b", "2"}, nil
+		case "EXPIRE":
+			return nil, errors.New("READONLY")
+		}
+		return int64(1), nil
+	})
+	var hooked []string
+	client.OnExpireError = func(_ context.Context, cmdName Command, key string, err error) {
+		hooked = append(hooked, key)
+	}
+	rank := RdCmd{Key: "rank:{{id}}", CMD: map[Command]RdSubCmd{
+		ZRANGE: {Params: "0 -1 WITHSCORES"},
+		ZADD:   {Params: "{{score}} {{member}}", Exp: func() time.Duration { return time.Minute }, ExpireStrict: true},
+	}}
+	ctx := context.Background()
+	pip := client.PipeLine()
+	zrange := pip.Handler(ctx, rank, ZRANGE, map[string]any{"id": 1})
+	zs := zrange.ZSlice()
+	zadd := pip.Handler(ctx, rank, ZADD, map[string]any{"id": 1, "score": 1, "member": "a"})
+	added := zadd.Int()
+	if zs.Val() != nil {
+		t.Error("result should be empty before Exec")
+	}
+
+	// pipeline 的错误是第一个失败的命令, 这里是 EXPIRE 本身
+	if _, err := pip.Exec(ctx); err == nil {
+		t.Error("expected error from Exec")
+	}
+	if len(zs.Val()) != 2 || zs.Val()[1].Score != 2 {
+		t.Errorf("unexpected ZSlice %v", zs.Val())
+	}
+	if !errors.Is(added.Err(), ErrExpireFailed) || zadd.ExpireErr() == nil || zadd.ExpireApplied() {
+		t.Errorf("strict expire failure should be set on the command, got %v", added.Err())
+	}
+	if len(hooked) != 1 || hooked[0] != "rank:1" {
+		t.Errorf("unexpected hook calls %v", hooked)
+	}
+	// Exec 之后再获取其他类型直接从缓存转换
+	if v := zrange.StringSlice().Val(); len(v) != 4 {
+		t.Errorf("unexpected StringSlice %v", v)
+	}
+	if len(hook.calls) != 3 {
+		t.Errorf("unexpected calls %v", hook.calls)
+	}
+}
+
+func TestRedisPipeline_ClientExec(t *testing.T) {
+	client, _ := newReplyClient(func(args []any) (any, error) {
+		if argString(args[0]) == "EXPIRE" {
+			return nil, errors.New("READONLY")
+		}
+		return int64(3), nil
+	})
+	counter := RdCmd{Key: "c:{{id}}", CMD: map[Command]RdSubCmd{
+		INCR: {},
+		DECR: {Exp: func() time.Duration { return time.Minute }, ExpireStrict: true},
+	}}
+	ctx := context.Background()
+	pip := client.PipeLine()
+	incr := pip.Handler(ctx, counter, INCR, map[string]any{"id": 1}).Int()
+	decr := pip.Handler(ctx, counter, DECR, map[string]any{"id": 1}).Int()
+
+	// 直接调用 go-redis 的 Exec 也会转换结果和检查过期时间
+	if _, err := pip.Client.Exec(ctx); err == nil {
+		t.Error("expected error from pip.Client.Exec")
+	}
+	if incr.Val() != 3 || incr.Err() != nil {
+		t.Errorf("typed result should be filled by pip.Client.Exec, got %d %v", incr.Val(), incr.Err())
+	}
+	if !errors.Is(decr.Err(), ErrExpireFailed) {
+		t.Errorf("strict expire failure should be set by pip.Client.Exec, got %v", decr.Err())
+	}
+
+	pip = client.PipeLine()
+	pending := pip.Handler(ctx, counter, INCR, map[string]any{"id": 2}).Int()
+	pip.Client.Discard()
+	if _, err := pip.Exec(ctx); err != nil || pending.Val() != 0 {
+		t.Errorf("discarded command should stay empty, got %d %v", pending.Val(), err)
+	}
+}
+
+func TestCommandBuilder_PipelineAtomicExpireFailed(t *testing.T) {
+	client, _ := newReplyClient(func(args []any) (any, error) {
+		return nil, serverErr("EXPIREFAILED rank:1 ERR invalid expire time")
+	})
+	var hooked []string
+	client.OnExpireError = func(_ context.Context, cmdName Command, key string, err error) {
+		hooked = append(hooked, string(cmdName)+" "+key+" "+err.Error())
+	}
+	rank := RdCmd{Key: "rank:{{id}}", CMD: map[Command]RdSubCmd{
+		ZADD: {Params: "{{score}} {{member}}", Exp: func() time.Duration { return time.Minute }, AtomicExpire: true},
+	}}
+	ctx := context.Background()
+	pip := client.PipeLine()
+	zadd := pip.Handler(ctx, rank, ZADD, map[string]any{"id": 1, "score": 1, "member": "a"})
+	added := zadd.Int()
+	_, _ = pip.Exec(ctx)
+
+	// lua 包装中过期命令失败, 主命令的回复被丢弃, 错误是 ErrExpireFailed
+	if !errors.Is(added.Err(), ErrExpireFailed) || !errors.Is(zadd.ExpireErr(), ErrExpireFailed) || zadd.ExpireApplied() {
+		t.Errorf("expire failure inside the lua wrap should be reported, got %v", added.Err())
+	}
+	if len(hooked) != 1 || hooked[0] != "ZADD rank:1 ERR invalid expire time" {
+		t.Errorf("unexpected hook calls %v", hooked)
+	}
+}
+
+func TestCommandBuilder_ExplicitExec(t *testing.T) {
+	client, hook := newReplyClient(func(args []any) (any, error) { return "OK", nil })
+	client.Config.KeyPrefix = "app:"
+	str := RdCmd{Key: "s:{{id}}", CMD: map[Command]RdSubCmd{SET: {Params: "{{v}}"}}}
+	ctx := context.Background()
+
+	cb := NewCommandBuilder(nil, ctx, str, SET, map[string]any{"id": 1, "v": "x"})
+	if cb.IsExecuted() || cmdLine(cb.Args()) != "SET s:1 x" || len(hook.calls) != 0 {
+		t.Fatal("Args should not execute the command")
+	}
+	if err := cb.Do().Err(); !errors.Is(err, ErrUnbound) {
+		t.Errorf("expected ErrUnbound, got %v", err)
+	}
+
+	bound := NewCommandBuilder(nil, ctx, str, SET, map[string]any{"id": 1, "v": "x"}).BindClient(client)
+	res := bound.Exec(ctx)
+	if !res.Done() || !bound.IsExecuted() || res.Bool().Val() != true {
+		t.Errorf("unexpected result %v", res.Val())
+	}
+	bound.Exec(ctx)
+	if len(hook.calls) != 1 || hook.calls[0] != "SET app:s:1 x" {
+		t.Errorf("unexpected calls %v", hook.calls)
+	}
+
+	for _, pipe := range []*RedisPipeline{client.PipeLine(), client.TxPipeLine()} {
+		hook.calls = nil
+		res = bound.Bind(pipe).Exec(ctx)
+		if !res.IsExecuted() || res.Done() {
+			t.Error("command should be queued but not done")
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if !res.Done() || res.String().Val() != "OK" {
+			t.Errorf("unexpected result %v", res.Val())
+		}
+		if !strings.Contains(strings.Join(hook.calls, ","), "SET app:s:1 x") {
+			t.Errorf("unexpected calls %v", hook.calls)
+		}
+	}
+}
+
+func TestRedisClient_Batch(t *testing.T) {
+	client, hook := newReplyClient(func(args []any) (any, error) {
+		switch argString(args[0]) {
+		case "HGET":
+			if argString(args[2]) == "missing" {
+				return nil, redis.Nil
+			}
+			return "tom", nil
+		case "INCR":
+			return int64(3), nil
+		}
+		return true, nil
+	})
+	user := RdCmd{Key: "u:{{id}}", CMD: map[Command]RdSubCmd{
+		HGET: {Params: "{{f}}"},
+		INCR: {Expire: ExpireIn(time.Minute)},
+	}}
+	strict := RdCmd{Key: "s:{{id}}", CMD: map[Command]RdSubCmd{HGET: {Params: "{{f}}", ReturnNilError: true}}}
+	ctx := context.Background()
+
+	name := client.Handler(ctx, user, HGET, map[string]any{"id": 1, "f": "name"})
+	missing := client.Handler(ctx, user, HGET, map[string]any{"id": 1, "f": "missing"})
+	visits := client.Handler(ctx, user, INCR, map[string]any{"id": 1})
+	if err := client.Batch(ctx, name, missing, visits, nil); err != nil {
+		t.Fatal(err)
+	}
+	if hook.pipelines != 1 || len(hook.calls) != 4 {
+		t.Errorf("expected one round trip, got %d pipelines, calls %v", hook.pipelines, hook.calls)
+	}
+	if !name.IsExecuted() || name.String().Val() != "tom" || visits.Int().Val() != 3 {
+		t.Errorf("unexpected results %v %v", name.Val(), visits.Val())
+	}
+	if err := missing.String().Err(); err != nil {
+		t.Errorf("redis.Nil should be ignored, got %v", err)
+	}
+	if !strings.Contains(strings.Join(hook.calls, ","), "EXPIRE u:1 60") {
+		t.Errorf("expire not applied: %v", hook.calls)
+	}
+
+	// 已经执行过的跳过, ReturnNilError 的 redis.Nil 作为返回值
+	hook.calls = nil
+	nilCmd := client.Handler(ctx, strict, HGET, map[string]any{"id": 1, "f": "missing"})
+	if err := client.Batch(ctx, name, nilCmd); !errors.Is(err, redis.Nil) {
+		t.Errorf("expected redis.Nil, got %v", err)
+	}
+	if len(hook.calls) != 1 || !errors.Is(nilCmd.Err(), redis.Nil) {
+		t.Errorf("unexpected calls %v", hook.calls)
+	}
+	if nilCmd.pipeliner != nil || nilCmd.tracker != nil {
+		t.Error("batched builder should not keep the executed pipeline")
+	}
+
+	// 绑定到别的 pipeline 或者 client 的不接管, 所有命令都不发送
+	hook.calls = nil
+	other, _ := newReplyClient(func(args []any) (any, error) { return nil, nil })
+	free := client.Handler(ctx, user, HGET, map[string]any{"id": 2, "f": "name"})
+	for _, bound := range []*CommandBuilder{
+		free.Bind(client.PipeLine()),
+		free.BindClient(other),
+	} {
+		if err := client.Batch(ctx, free, bound); !errors.Is(err, ErrBoundElsewhere) {
+			t.Errorf("expected ErrBoundElsewhere, got %v", err)
+		}
+		if free.IsExecuted() || bound.IsExecuted() || len(hook.calls) != 0 {
+			t.Errorf("nothing should be sent, calls %v", hook.calls)
+		}
+	}
+	if err := client.Batch(ctx, free.BindClient(client)); err != nil {
+		t.Errorf("builder bound to the same client should be batched, got %v", err)
+	}
+
+	// pipeline 使用 RdSubCmd.Timeout 得到的 deadline
+	timed := RdCmd{Key: "t:{{id}}", CMD: map[Command]RdSubCmd{GET: {Timeout: time.Minute}}}
+	start := time.Now()
+	_ = client.Batch(ctx, client.Handler(ctx, timed, GET, map[string]any{"id": 1}), client.Handler(ctx, user, INCR, map[string]any{"id": 2}))
+	if d := hook.deadline.Sub(start); d <= 0 || d > time.Minute+time.Second {
+		t.Errorf("batch should run under the command timeout, deadline in %v", d)
+	}
+}
+
+func TestRedisClient_AutoPipeline(t *testing.T) {
+	client, hook := newReplyClient(func(args []any) (any, error) { return argString(args[1]), nil })
+	client.EnableAutoPipeline(AutoPipelineOptions{Window: time.Second, MaxBatch: 4})
+	str := RdCmd{Key: "s:{{id}}", CMD: map[Command]RdSubCmd{GET: {}}}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	vals := make([]string, 4)
+	for i := range vals {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vals[i] = client.Get(ctx, str, map[string]any{"id": i}).String().Val()
+		}(i)
+	}
+	wg.Wait()
+	for i, v := range vals {
+		if v != fmt.Sprintf("s:%d", i) {
+			t.Errorf("unexpected value %d: %s", i, v)
+		}
+	}
+	if hook.pipelines != 1 {
+		t.Errorf("expected one pipeline, got %d", hook.pipelines)
+	}
+
+	// 没有攒够的在窗口到期之后发送
+	client.EnableAutoPipeline(AutoPipelineOptions{Window: time.Millisecond, MaxBatch: 4})
+	if v := client.Get(ctx, str, map[string]any{"id": 9}).String().Val(); v != "s:9" {
+		t.Errorf("unexpected value %s", v)
+	}
+	stats := client.AutoPipelineStats()
+	if stats.Batches != 1 || stats.Commands != 1 || stats.Full != 0 || hook.pipelines != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	client.DisableAutoPipeline()
+	client.Get(ctx, str, map[string]any{"id": 1}).String()
+	if hook.pipelines != 2 || client.AutoPipelineStats() != (AutoPipelineStats{}) {
+		t.Error("auto pipeline should be disabled")
+	}
+}
+
+func TestRedisClient_AutoPipelineContext(t *testing.T) {
+	client, hook := newReplyClient(func(args []any) (any, error) {
+		if argString(args[1]) == "s:slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return "ok", nil
+	})
+	str := RdCmd{Key: "s:{{id}}", CMD: map[Command]RdSubCmd{GET: {}, SET: {Params: "{{v}}", Timeout: 20 * time.Millisecond}}}
+	defer client.DisableAutoPipeline()
+
+	// 还在等待窗口中的命令, ctx 到期之后直接返回并且不再发送
+	client.EnableAutoPipeline(AutoPipelineOptions{Window: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := client.Get(ctx, str, map[string]any{"id": 1}).Err(); !errors.Is(err, ErrTimeout) || time.Since(start) > 200*time.Millisecond {
+		t.Errorf("expected ErrTimeout after the ctx deadline, got %v after %v", err, time.Since(start))
+	}
+	if err := client.Set(context.Background(), str, map[string]any{"id": 2, "v": "x"}).Err(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("RdSubCmd.Timeout should apply to queued commands, got %v", err)
+	}
+	client.DisableAutoPipeline()
+	if len(hook.calls) != 0 {
+		t.Errorf("expired commands should not be sent, got %v", hook.calls)
+	}
+
+	// 已经发送的批次, 调用方也不会等到回复
+	client.EnableAutoPipeline(AutoPipelineOptions{Window: time.Millisecond})
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := client.Get(ctx, str, map[string]any{"id": "slow"}).Err(); !errors.Is(err, ErrTimeout) || time.Since(start) > 200*time.Millisecond {
+		t.Errorf("expected ErrTimeout while the batch is in flight, got %v after %v", err, time.Since(start))
+	}
+}
@@ -0,0 +1,44 @@
+package rdb
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Executor 可以执行 rdb 命令和 lua 脚本的对象, 业务代码接收 Executor 就可以同时支持直接执行、pipeline 和事务
+// RedisClient、RedisPipeline (PipeLine 和 TxPipeLine 返回的) 都实现了它
+//
+//	func saveUser(ctx context.Context, e rdb.Executor, ...) {
+//		rdb.NewOps(e).HSet(ctx, UserCmd, args)
+//	}
+type Executor interface {
+	Handler(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) *CommandBuilder
+	ExecScript(ctx context.Context, lua LuaScript, keyInfo map[string]string, valueInfo map[string]any) *redis.Cmd
+}
+
+var (
+	_ Executor = RedisClient{}
+	_ Executor = RedisPipeline{}
+)
+
+// Ops Executor 上的全部命令方法 (HSet、Get、ZAdd 等), 和 RedisClient、RedisPipeline 上的一样
+// 新的后端只需要实现 Executor, 不需要重复 api_*.go 中的方法
+type Ops struct {
+	builder
+	lua
+}
+
+func NewOps(e Executor) Ops {
+	return Ops{builder: e.Handler, lua: e.ExecScript}
+}
+
+// ExecScript 执行 lua 脚本
+func (o Ops) ExecScript(ctx context.Context, lua LuaScript, keyInfo map[string]string, valueInfo map[string]any) *redis.Cmd {
+	return o.lua(ctx, lua, keyInfo, valueInfo)
+}
+
+// Handler 执行任意定义的子命令, 和 Executor.Handler 一样
+func (o Ops) Handler(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) *CommandBuilder {
+	return o.builder(ctx, cmd, cmdName, args, includeArgs...)
+}
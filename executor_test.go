@@ -0,0 +1,52 @@
+package rdb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// countingExecutor 自定义的后端, 只实现 Executor 就可以使用全部命令方法
+type countingExecutor struct {
+	Executor
+	handled int
+}
+
+func (e *countingExecutor) Handler(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) *CommandBuilder {
+	e.handled++
+	return e.Executor.Handler(ctx, cmd, cmdName, args, includeArgs...)
+}
+
+func TestExecutor(t *testing.T) {
+	client, hook := newReplyClient(func(args []any) (any, error) { return "v", nil })
+	user := RdCmd{Key: "user:{{id}}", CMD: map[Command]RdSubCmd{HGET: {Params: "{{f}}"}}}
+	lua := LuaScript{Script: "return 1", Keys: []string{"k"}}
+	ctx := context.Background()
+
+	// 业务代码只依赖 Executor
+	load := func(e Executor) (*CommandBuilder, *redis.Cmd) {
+		ops := NewOps(e)
+		return ops.HGet(ctx, user, map[string]any{"id": 1, "f": "name"}), ops.ExecScript(ctx, lua, map[string]string{"k": "user:1"}, nil)
+	}
+
+	cb, script := load(client)
+	if cb.String().Val() != "v" || script.Err() != nil {
+		t.Errorf("client: %v %v", cb.Val(), script.Err())
+	}
+	for _, pipe := range []*RedisPipeline{client.PipeLine(), client.TxPipeLine()} {
+		cb, script := load(pipe)
+		cb.Exec(ctx)
+		if _, err := pipe.Exec(ctx); err != nil || cb.String().Val() != "v" || script.Err() != nil {
+			t.Errorf("pipeline: %v %v %v", err, cb.Val(), script.Err())
+		}
+	}
+	custom := &countingExecutor{Executor: client}
+	if cb, _ := load(custom); cb.String().Val() != "v" || custom.handled != 1 {
+		t.Errorf("custom executor not used: %d", custom.handled)
+	}
+	if n := strings.Count(strings.ToUpper(strings.Join(hook.calls, ",")), "EVALSHA"); n != 4 {
+		t.Errorf("expected 4 scripts, got %v", hook.calls)
+	}
+}
@@ -0,0 +1,488 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ExpireCond redis 7 的 EXPIRE 条件
+type ExpireCond string
+
+const (
+	ExpireAlways ExpireCond = ""
+	ExpireNX     ExpireCond = "NX" // 只在 key 没有过期时间的时候设置, 也就是只在第一次设置
+	ExpireXX     ExpireCond = "XX" // 只在 key 已经有过期时间的时候设置
+	ExpireGT     ExpireCond = "GT" // 新的过期时间大于当前的才设置
+	ExpireLT     ExpireCond = "LT" // 新的过期时间小于当前的才设置
+)
+
+// ExpirePolicy 子命令执行之后 key 的过期策略
+// 相对时间使用 EXPIRE/PEXPIRE, 绝对时间使用 EXPIREAT/PEXPIREAT, 可以叠加条件和随机抖动:
+//
+//	ExpireIn(time.Hour).WithJitter(5 * time.Minute)
+//	ExpireAt(EndOfDay(time.Local)).OnlyIfNew()
+//	ExpireIn(1500 * time.Millisecond)          // 非整秒自动使用 PEXPIRE
+//
+// 命令参数中带有 KEEPTTL 的时候(例如 SET ... KEEPTTL)不会再设置过期时间
+type ExpirePolicy struct {
+	In     func() time.Duration // 相对过期时间
+	At     func() time.Time     // 绝对过期时间, 设置了 At 时 In 不生效
+	Millis bool                 // 使用毫秒精度的 PEXPIRE/PEXPIREAT
+	Cond   ExpireCond
+	Jitter time.Duration // 在过期时间上随机增加 [0, Jitter), 避免大量 key 同时过期
+	fixed  time.Duration // ExpireIn 设置的固定时间, 导出 catalog 的时候使用, 不需要调用 In
+}
+
+// ExpireIn 固定的相对过期时间
+func ExpireIn(d time.Duration) *ExpirePolicy {
+	return &ExpirePolicy{In: func() time.Duration { return d }, fixed: d}
+}
+
+// ExpireInFunc 每次执行时计算的相对过期时间, 与 RdSubCmd.Exp 相同
+func ExpireInFunc(f func() time.Duration) *ExpirePolicy {
+	return &ExpirePolicy{In: f}
+}
+
+// ExpireAt 绝对过期时间, 每次执行时计算
+func ExpireAt(f func() time.Time) *ExpirePolicy {
+	return &ExpirePolicy{At: f}
+}
+
+// EndOfDay 返回当天结束的时间点, 配合 ExpireAt 使用
+func EndOfDay(loc *time.Location) func() time.Time {
+	return func() time.Time {
+		now := time.Now().In(loc)
+		return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	}
+}
+
+// clone 链式调用的时候不修改原对象, 这样同一个策略可以被多个子命令复用
+func (p *ExpirePolicy) clone() *ExpirePolicy {
+	c := *p
+	return &c
+}
+
+// WithMillis 使用毫秒精度
+func (p *ExpirePolicy) WithMillis() *ExpirePolicy {
+	c := p.clone()
+	c.Millis = true
+	return c
+}
+
+// WithJitter 随机抖动
+func (p *ExpirePolicy) WithJitter(d time.Duration) *ExpirePolicy {
+	c := p.clone()
+	c.Jitter = d
+	return c
+}
+
+// WithCond 设置 NX/XX/GT/LT 条件, 需要 redis 7
+func (p *ExpirePolicy) WithCond(cond ExpireCond) *ExpirePolicy {
+	c := p.clone()
+	c.Cond = cond
+	return c
+}
+
+// OnlyIfNew 只在 key 还没有过期时间的时候设置 (NX)
+func (p *ExpirePolicy) OnlyIfNew() *ExpirePolicy { return p.WithCond(ExpireNX) }
+
+// OnlyIfExists 只在 key 已经有过期时间的时候设置 (XX)
+func (p *ExpirePolicy) OnlyIfExists() *ExpirePolicy { return p.WithCond(ExpireXX) }
+
+// OnlyIfGreater 只延长过期时间 (GT)
+func (p *ExpirePolicy) OnlyIfGreater() *ExpirePolicy { return p.WithCond(ExpireGT) }
+
+// OnlyIfLess 只缩短过期时间 (LT)
+func (p *ExpirePolicy) OnlyIfLess() *ExpirePolicy { return p.WithCond(ExpireLT) }
+
+// Args 生成设置过期时间的命令参数, 策略无效的时候返回 nil
+func (p *ExpirePolicy) Args(key string) []any {
+	if p == nil || (p.In == nil && p.At == nil) {
+		return nil
+	}
+	var jitter time.Duration
+	if p.Jitter > 0 {
+		jitter = rand.N(p.Jitter)
+	}
+	var args []any
+	if p.At != nil {
+		at := p.At().Add(jitter)
+		if p.Millis || at.UnixMilli()%1000 != 0 {
+			args = []any{string(PEXPIREAT), key, strconv.FormatInt(at.UnixMilli(), 10)}
+		} else {
+			args = []any{string(EXPIREAT), key, strconv.FormatInt(at.Unix(), 10)}
+		}
+	} else {
+		d := p.In() + jitter
+		if d <= 0 {
+			return nil
+		}
+		// 非整秒或者不足 1 秒的时候使用毫秒精度, 避免 EXPIRE 0 直接删除 key
+		if p.Millis || d%time.Second != 0 {
+			args = []any{string(PEXPIRE), key, strconv.FormatInt(d.Milliseconds(), 10)}
+		} else {
+			args = []any{string(EXPIRE), key, strconv.FormatInt(int64(d/time.Second), 10)}
+		}
+	}
+	if p.Cond != ExpireAlways {
+		args = append(args, string(p.Cond))
+	}
+	return args
+}
+
+// expirePolicy 获取子命令的过期策略, 没有设置 Expire 的时候兼容 Exp
+func (subCmd RdSubCmd) expirePolicy() *ExpirePolicy {
+	if subCmd.Expire != nil {
+		return subCmd.Expire
+	}
+	if subCmd.Exp != nil {
+		return ExpireInFunc(subCmd.Exp)
+	}
+	return nil
+}
+
+// hasExpire 子命令是否需要设置过期时间
+func (subCmd RdSubCmd) hasExpire() bool {
+	return subCmd.Expire != nil || subCmd.Exp != nil
+}
+
+// ExpireTarget 过期时间设置在命令的哪些 key 上
+type ExpireTarget string
+
+const (
+	ExpireTargetKey  ExpireTarget = ""     // 默认, 外层的 key, 也就是命令的第一个参数
+	ExpireTargetDest ExpireTarget = "dest" // 写入的目标 key, 例如 RPOPLPUSH/SMOVE 的第二个 key, *STORE 的第一个 key
+	ExpireTargetAll  ExpireTarget = "all"  // 命令中所有的 key, 例如 MSET/MSETNX 写入的每个 key
+)
+
+// destKeyIndexes 目标 key 在命令参数中的位置 (args[0] 为命令名), 没有列出的命令目标 key 是第一个参数
+// SUNIONSTORE/ZINTERSTORE/PFMERGE 等的目标 key 就是第一个参数, 不需要列出
+var destKeyIndexes = map[Command]int{
+	RPOPLPUSH:  2,
+	BRPOPLPUSH: 2,
+	LMOVE:      2,
+	BLMOVE:     2,
+	SMOVE:      2,
+	COPY:       2,
+	RENAME:     2,
+	RENAMENX:   2,
+	BITOP:      2,
+}
+
+// expireKeys 根据 ExpireTarget 找出需要设置过期时间的 key, 去重并保持顺序
+func expireKeys(target ExpireTarget, key string, cmdArgs []any) []string {
+	cmdName := Command(strings.ToUpper(argString(cmdArgs[0])))
+	switch target {
+	case ExpireTargetDest:
+		i, ok := destKeyIndexes[cmdName]
+		if !ok {
+			i = 1
+		}
+		if i < len(cmdArgs) {
+			return []string{argString(cmdArgs[i])}
+		}
+		return nil
+	case ExpireTargetAll:
+		var keys []string
+		seen := map[string]bool{}
+		for _, i := range keyIndexes(cmdName, cmdArgs) {
+			if k := argString(cmdArgs[i]); !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+		return keys
+	}
+	if key == "" {
+		return nil
+	}
+	return []string{key}
+}
+
+// newExpireCmds 根据子命令的过期策略生成设置过期时间的命令, 每个目标 key 一条, 不需要设置的时候返回 nil
+// cmdArgs 中带有 KEEPTTL 的时候表示保留原来的过期时间, 也返回 nil
+func newExpireCmds(ctx context.Context, subCmd RdSubCmd, key string, cmdArgs []any) []*redis.BoolCmd {
+	if !subCmd.hasExpire() || len(cmdArgs) < 2 {
+		return nil
+	}
+	for _, arg := range cmdArgs[1:] {
+		if s, ok := arg.(string); ok && strings.EqualFold(s, "KEEPTTL") {
+			return nil
+		}
+	}
+	policy := subCmd.expirePolicy()
+	var cmds []*redis.BoolCmd
+	for _, k := range expireKeys(subCmd.ExpireTarget, key, cmdArgs) {
+		if args := policy.Args(k); args != nil {
+			cmds = append(cmds, redis.NewBoolCmd(ctx, args...))
+		}
+	}
+	return cmds
+}
+
+// ExpireWrapScript 在 pipeline 中原子设置过期时间使用的 lua 包装, rdbtest 等测试替身用它识别这个脚本
+// ARGV[1] 为原命令参数个数, 之后是原命令参数, 再之后每条过期命令都是参数个数加上参数; 原命令出错的时候不设置过期时间
+// 过期命令出错的时候返回 ExpireFailedReply 开头的错误, 原命令的回复丢弃, 所以不论是否 strict 命令都会失败
+// KEYS 只用于集群路由, 脚本中不使用
+const ExpireWrapScript = `local n = tonumber(ARGV[1])
+local r = redis.pcall(unpack(ARGV, 2, n + 1))
+if type(r) == 'table' and r.err then
+	return r
+end
+local i = n + 2
+while i <= #ARGV do
+	local m = tonumber(ARGV[i])
+	local e = redis.pcall(unpack(ARGV, i + 1, i + m))
+	if type(e) == 'table' and e.err then
+		return redis.error_reply('EXPIREFAILED ' .. ARGV[i + 2] .. ' ' .. e.err)
+	end
+	i = i + m + 1
+end
+return r`
+
+// ExpireFailedReply ExpireWrapScript 中过期命令出错时错误回复的前缀, 之后是 key 和原始的错误
+const ExpireFailedReply = "EXPIREFAILED"
+
+// ErrExpireFailed 设置过期时间失败, 只有开启 RdSubCmd.ExpireStrict 的时候才会作为命令的错误返回
+var ErrExpireFailed = errors.New("rdb: set expire failed")
+
+// ExpireErrorHook 设置过期时间失败的回调, 可以用来打点或者报警
+type ExpireErrorHook func(ctx context.Context, cmdName Command, key string, err error)
+
+// expirePlan 命令和过期时间的发送方式, 同时记录过期时间的执行结果
+type expirePlan struct {
+	cmdArgs    []any            // 实际发送的命令参数, 原生改写或者 lua 包装之后和 Build 的结果不同
+	expireCmds []*redis.BoolCmd // 需要单独发送的过期命令, 每个目标 key 一条
+	tx         bool             // expireCmds 需要和命令放在同一个 MULTI/EXEC 中
+	inline     bool             // 过期时间已经合并到 cmdArgs 中
+	cmdName    Command
+	strict     bool
+	cmder      redis.Cmder // 主命令, 执行之后设置
+}
+
+// planExpire 决定命令和过期时间怎么发送
+// 没有开启 AtomicExpire 的时候和之前一样, 命令之后再单独发送过期命令
+// 开启之后优先改写成原生带过期时间的命令 (SET ... EX, GETEX), 不能改写时直接执行用 MULTI/EXEC, pipeline 中用 lua 包装
+func planExpire(ctx context.Context, subCmd RdSubCmd, key string, cmdArgs []any, pipeline bool) *expirePlan {
+	plan := &expirePlan{cmdArgs: cmdArgs, strict: subCmd.ExpireStrict}
+	if len(cmdArgs) > 0 {
+		plan.cmdName = Command(argString(cmdArgs[0]))
+	}
+	plan.expireCmds = newExpireCmds(ctx, subCmd, key, cmdArgs)
+	if len(plan.expireCmds) == 0 || !subCmd.AtomicExpire {
+		return plan
+	}
+	if len(plan.expireCmds) == 1 {
+		if args, ok := inlineExpire(cmdArgs, plan.expireCmds[0].Args()); ok {
+			plan.cmdArgs, plan.expireCmds, plan.inline = args, nil, true
+			return plan
+		}
+	}
+	if !pipeline {
+		plan.tx = true
+	} else {
+		plan.cmdArgs, plan.expireCmds, plan.inline = wrapExpire(cmdArgs, plan.expireCmds), nil, true
+	}
+	return plan
+}
+
+// err 过期命令的错误, 有多条的时候返回第一个, pipeline 中要在 Exec 之后才有结果
+// 合并到命令中执行的时候过期时间和命令一起成功或者失败, 只有 lua 包装中过期命令出错的时候返回主命令的错误
+func (p *expirePlan) err() error {
+	if p == nil {
+		return nil
+	}
+	if p.inline && p.cmder != nil && errors.Is(p.cmder.Err(), ErrExpireFailed) {
+		return p.cmder.Err()
+	}
+	for _, cmd := range p.expireCmds {
+		if err := cmd.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applied 过期时间是否设置成功
+func (p *expirePlan) applied() bool {
+	if p == nil || p.cmder == nil {
+		return false
+	}
+	if p.inline {
+		return p.cmder.Err() == nil
+	}
+	for _, cmd := range p.expireCmds {
+		if cmd.Err() != nil || !cmd.Val() {
+			return false
+		}
+	}
+	return len(p.expireCmds) > 0
+}
+
+// failed 检查过期命令的结果, 失败的时候执行回调, 开启 strict 并且主命令成功的时候返回包装之后的错误
+func (p *expirePlan) failed(ctx context.Context, hook ExpireErrorHook) error {
+	if p.inline {
+		p.wrapFailed(ctx, hook)
+		return nil
+	}
+	var first error
+	for _, cmd := range p.expireCmds {
+		err := cmd.Err()
+		if err == nil {
+			continue
+		}
+		key := argString(cmd.Args()[1])
+		if hook != nil {
+			hook(ctx, p.cmdName, key, err)
+		} else {
+			slog.Warn("redis set expire failed", "cmd", p.cmdName, "key", key, "error", err.Error())
+		}
+		if first == nil {
+			first = fmt.Errorf("%w: %s %s: %w", ErrExpireFailed, p.cmdName, key, err)
+		}
+	}
+	if !p.strict || (p.cmder != nil && p.cmder.Err() != nil) {
+		return nil
+	}
+	return first
+}
+
+// wrapFailed lua 包装中过期命令出错的时候, 执行回调并把主命令的错误包装成 ErrExpireFailed
+func (p *expirePlan) wrapFailed(ctx context.Context, hook ExpireErrorHook) {
+	if p.cmder == nil {
+		return
+	}
+	var redisErr redis.Error
+	if !errors.As(p.cmder.Err(), &redisErr) || !redis.HasErrorPrefix(redisErr, ExpireFailedReply) {
+		return
+	}
+	key, reason, _ := strings.Cut(strings.TrimPrefix(redisErr.Error(), ExpireFailedReply+" "), " ")
+	err := errors.New(reason)
+	if hook != nil {
+		hook(ctx, p.cmdName, key, err)
+	} else {
+		slog.Warn("redis set expire failed", "cmd", p.cmdName, "key", key, "error", reason)
+	}
+	p.cmder.SetErr(fmt.Errorf("%w: %s %s: %w", ErrExpireFailed, p.cmdName, key, redisErr))
+}
+
+// inlineExpire 把过期时间改写到命令本身的参数中, 只处理不带条件的 SET 和 GET
+// SET 带 NX/XX 的时候原命令可能不写入, 和单独 EXPIRE 的语义不同, 不改写
+func inlineExpire(cmdArgs []any, expireArgs []any) ([]any, bool) {
+	if len(expireArgs) != 3 || len(cmdArgs) < 2 || argString(cmdArgs[1]) != argString(expireArgs[1]) {
+		return nil, false
+	}
+	var opt string
+	switch expireArgs[0] {
+	case string(EXPIRE):
+		opt = "EX"
+	case string(PEXPIRE):
+		opt = "PX"
+	case string(EXPIREAT):
+		opt = "EXAT"
+	case string(PEXPIREAT):
+		opt = "PXAT"
+	default:
+		return nil, false
+	}
+	switch strings.ToUpper(argString(cmdArgs[0])) {
+	case string(SET):
+		if len(cmdArgs) < 3 {
+			return nil, false
+		}
+		for _, arg := range cmdArgs[3:] {
+			switch strings.ToUpper(argString(arg)) {
+			case "NX", "XX", "EX", "PX", "EXAT", "PXAT", "KEEPTTL":
+				return nil, false
+			}
+		}
+		args := append(cmdArgs[:len(cmdArgs):len(cmdArgs)], opt, expireArgs[2])
+		return args, true
+	case string(GET):
+		if len(cmdArgs) != 2 {
+			return nil, false
+		}
+		return []any{"GETEX", cmdArgs[1], opt, expireArgs[2]}, true
+	}
+	return nil, false
+}
+
+// wrapExpire 生成 EVAL 参数, 把命令和过期命令放在同一个脚本中执行
+func wrapExpire(cmdArgs []any, expireCmds []*redis.BoolCmd) []any {
+	var keys []string
+	seen := map[string]bool{}
+	addKey := func(k string) {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	for _, cmd := range expireCmds {
+		addKey(argString(cmd.Args()[1]))
+	}
+	for _, i := range keyIndexes(Command(argString(cmdArgs[0])), cmdArgs) {
+		addKey(argString(cmdArgs[i]))
+	}
+	args := make([]any, 0, 4+len(keys)+len(cmdArgs)+4*len(expireCmds))
+	args = append(args, "EVAL", ExpireWrapScript, len(keys))
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	args = append(args, len(cmdArgs))
+	args = append(args, cmdArgs...)
+	for _, cmd := range expireCmds {
+		args = append(args, len(cmd.Args()))
+		args = append(args, cmd.Args()...)
+	}
+	return args
+}
+
+// processWithExpire 直接执行命令和过期命令, 返回执行的次数和命令本身的执行错误
+// 过期时间设置失败不影响命令, 除非开启了 ExpireStrict; 重试的时候过期命令一起重新执行, 只检查最后一次的结果
+func processWithExpire(ctx context.Context, rdm *RedisClient, cmder redis.Cmder, plan *expirePlan, retry *RetryPolicy) (int, error) {
+	plan.cmder = cmder
+	attempts, err := retry.do(ctx, func() error {
+		// 重试的时候清掉上一次的错误
+		cmder.SetErr(nil)
+		for _, expireCmd := range plan.expireCmds {
+			expireCmd.SetErr(nil)
+		}
+		if plan.tx {
+			// 整个事务的错误以各个命令自己的错误为准
+			_, _ = rdm.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				_ = pipe.Process(ctx, cmder)
+				for _, expireCmd := range plan.expireCmds {
+					_ = pipe.Process(ctx, expireCmd)
+				}
+				return nil
+			})
+			return cmder.Err()
+		}
+		err := rdm.Client.Process(ctx, cmder)
+		for _, expireCmd := range plan.expireCmds {
+			_ = rdm.Client.Process(ctx, expireCmd)
+		}
+		return err
+	})
+	if expireErr := plan.failed(ctx, rdm.OnExpireError); expireErr != nil && err == nil {
+		err = expireErr
+	}
+	return attempts, err
+}
+
+// processWithExpireInPipeline 把命令和过期命令加入 pipeline, 过期时间的结果在 RedisPipeline.Exec 中检查
+func processWithExpireInPipeline(ctx context.Context, pipeliner redis.Pipeliner, cmder redis.Cmder, plan *expirePlan) {
+	plan.cmder = cmder
+	_ = pipeliner.Process(ctx, cmder)
+	for _, expireCmd := range plan.expireCmds {
+		_ = pipeliner.Process(ctx, expireCmd)
+	}
+}
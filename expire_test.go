@@ -0,0 +1,149 @@
+package rdb
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestExpirePolicy_Args(t *testing.T) {
+	at := time.Unix(1800000000, 0)
+	tests := []struct {
+		policy *ExpirePolicy
+		want   []any
+	}{
+		{ExpireIn(time.Minute), []any{"EXPIRE", "k", "60"}},
+		{ExpireIn(1500 * time.Millisecond), []any{"PEXPIRE", "k", "1500"}},
+		{ExpireIn(time.Minute).WithMillis(), []any{"PEXPIRE", "k", "60000"}},
+		{ExpireIn(time.Minute).OnlyIfNew(), []any{"EXPIRE", "k", "60", "NX"}},
+		{ExpireAt(func() time.Time { return at }), []any{"EXPIREAT", "k", "1800000000"}},
+		{ExpireAt(func() time.Time { return at.Add(250 * time.Millisecond) }).OnlyIfGreater(), []any{"PEXPIREAT", "k", "1800000000250", "GT"}},
+		{ExpireIn(0), nil},
+		{nil, nil},
+	}
+	for i, tt := range tests {
+		if got := tt.policy.Args("k"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d: got %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestExpirePolicy_Jitter(t *testing.T) {
+	base := ExpireIn(time.Minute)
+	p := base.WithJitter(10 * time.Second)
+	if base.Jitter != 0 {
+		t.Fatal("WithJitter should not modify the original policy")
+	}
+	for i := 0; i < 100; i++ {
+		args := p.Args("k")
+		ms, _ := strconv.ParseInt(args[2].(string), 10, 64)
+		if args[0] == "EXPIRE" {
+			ms *= 1000
+		}
+		if ms < 60000 || ms >= 70000 {
+			t.Fatalf("ttl out of range: %v", args)
+		}
+	}
+}
+
+func Test_newExpireCmds(t *testing.T) {
+	ctx := context.Background()
+	argsOf := func(cmds []*redis.BoolCmd) [][]any {
+		var args [][]any
+		for _, cmd := range cmds {
+			args = append(args, cmd.Args())
+		}
+		return args
+	}
+	subCmd := RdSubCmd{Exp: func() time.Duration { return time.Hour }}
+	cmds := newExpireCmds(ctx, subCmd, "k", []any{"SET", "k", "v"})
+	if !reflect.DeepEqual(argsOf(cmds), [][]any{{"EXPIRE", "k", "3600"}}) {
+		t.Fatalf("unexpected expire cmds %v", argsOf(cmds))
+	}
+	subCmd.Expire = ExpireIn(time.Minute).OnlyIfExists()
+	if cmds = newExpireCmds(ctx, subCmd, "k", []any{"SET", "k", "v"}); !reflect.DeepEqual(argsOf(cmds), [][]any{{"EXPIRE", "k", "60", "XX"}}) {
+		t.Errorf("Expire should take precedence over Exp, got %v", argsOf(cmds))
+	}
+	if cmds = newExpireCmds(ctx, subCmd, "k", []any{"SET", "k", "v", "KEEPTTL"}); cmds != nil {
+		t.Errorf("KEEPTTL should skip expire, got %v", argsOf(cmds))
+	}
+	if cmds = newExpireCmds(ctx, RdSubCmd{}, "k", []any{"SET", "k", "v"}); cmds != nil {
+		t.Errorf("no policy should return nil, got %v", argsOf(cmds))
+	}
+
+	exp := ExpireIn(time.Minute)
+	tests := []struct {
+		target  ExpireTarget
+		cmdArgs []any
+		want    [][]any
+	}{
+		{ExpireTargetDest, []any{"RPOPLPUSH", "src", "dst"}, [][]any{{"EXPIRE", "dst", "60"}}},
+		{ExpireTargetDest, []any{"SMOVE", "src", "dst", "m"}, [][]any{{"EXPIRE", "dst", "60"}}},
+		{ExpireTargetDest, []any{"ZUNIONSTORE", "dst", "2", "a", "b"}, [][]any{{"EXPIRE", "dst", "60"}}},
+		{ExpireTargetDest, []any{"SUNIONSTORE", "dst", "a", "b"}, [][]any{{"EXPIRE", "dst", "60"}}},
+		{ExpireTargetAll, []any{"MSET", "a", "1", "b", "2", "a", "3"}, [][]any{{"EXPIRE", "a", "60"}, {"EXPIRE", "b", "60"}}},
+	}
+	for _, tt := range tests {
+		cmds = newExpireCmds(ctx, RdSubCmd{Expire: exp, ExpireTarget: tt.target}, argString(tt.cmdArgs[1]), tt.cmdArgs)
+		if !reflect.DeepEqual(argsOf(cmds), tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.cmdArgs, argsOf(cmds), tt.want)
+		}
+	}
+}
+
+func Test_planExpire(t *testing.T) {
+	ctx := context.Background()
+	exp := func() time.Duration { return time.Minute }
+
+	plan := planExpire(ctx, RdSubCmd{Exp: exp}, "k", []any{"SET", "k", "v"}, false)
+	if plan.tx || len(plan.expireCmds) != 1 || !reflect.DeepEqual(plan.cmdArgs, []any{"SET", "k", "v"}) {
+		t.Errorf("non atomic mode should keep a separate expire, got %+v", plan)
+	}
+
+	atomic := RdSubCmd{Exp: exp, AtomicExpire: true}
+	tests := []struct {
+		cmdArgs []any
+		want    []any
+	}{
+		{[]any{"SET", "k", "v"}, []any{"SET", "k", "v", "EX", "60"}},
+		{[]any{"set", "k", "v", "GET"}, []any{"set", "k", "v", "GET", "EX", "60"}},
+		{[]any{"GET", "k"}, []any{"GETEX", "k", "EX", "60"}},
+	}
+	for _, tt := range tests {
+		plan = planExpire(ctx, atomic, "k", tt.cmdArgs, true)
+		if plan.expireCmds != nil || !reflect.DeepEqual(plan.cmdArgs, tt.want) {
+			t.Errorf("%v: got %+v, want %v", tt.cmdArgs, plan, tt.want)
+		}
+	}
+
+	// SET NX 不能改写, 直接执行使用 MULTI/EXEC
+	plan = planExpire(ctx, atomic, "k", []any{"SET", "k", "v", "NX"}, false)
+	if !plan.tx || len(plan.expireCmds) != 1 {
+		t.Errorf("expected MULTI/EXEC plan, got %+v", plan)
+	}
+
+	// pipeline 中使用 lua 包装
+	plan = planExpire(ctx, atomic, "k", []any{"HSET", "k", "f", "v"}, true)
+	want := []any{"EVAL", ExpireWrapScript, 1, "k", 4, "HSET", "k", "f", "v", 3, "EXPIRE", "k", "60"}
+	if plan.expireCmds != nil || !reflect.DeepEqual(plan.cmdArgs, want) {
+		t.Errorf("unexpected lua plan %v", plan.cmdArgs)
+	}
+
+	// 多个 key 的过期时间不能改写
+	all := RdSubCmd{Exp: exp, AtomicExpire: true, ExpireTarget: ExpireTargetAll}
+	plan = planExpire(ctx, all, "a", []any{"MSET", "a", "1", "b", "2"}, true)
+	want = []any{"EVAL", ExpireWrapScript, 2, "a", "b", 5, "MSET", "a", "1", "b", "2", 3, "EXPIRE", "a", "60", 3, "EXPIRE", "b", "60"}
+	if !reflect.DeepEqual(plan.cmdArgs, want) {
+		t.Errorf("unexpected lua plan %v", plan.cmdArgs)
+	}
+
+	// 带条件的过期时间不能改写成 SET EX
+	cond := RdSubCmd{Expire: ExpireIn(time.Minute).OnlyIfNew(), AtomicExpire: true}
+	if plan = planExpire(ctx, cond, "k", []any{"SET", "k", "v"}, false); !plan.tx {
+		t.Errorf("conditional expire should not be inlined, got %+v", plan)
+	}
+}
@@ -0,0 +1,278 @@
+package rdb
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultRedactParams 默认需要隐藏值的参数名, 参数名(忽略大小写)包含其中任意一个就会被替换成 ***
+// 可以用 Config.RedactParams 覆盖
+var DefaultRedactParams = []string{"password", "passwd", "secret", "token", "credential"}
+
+const redacted = "***"
+
+// Explanation 命令的渲染结果, 不会发送到 redis
+type Explanation struct {
+	Command    string            // 完整的命令行, 例如 HSET app:user:1 name tom
+	Args       []string          // 命令行按参数拆开
+	Key        string            // 加上前缀之后的 key
+	Defaults   map[string]string // 使用了 DefaultParams 的参数
+	TTL        string            // 过期策略, 格式同 Catalog, 例如 "30s NX atomic"
+	Expire     []string          // 会单独执行的过期命令; 合并到命令中 (SET ... EX、EVAL) 的时候为空, 见 Command
+	Tx         bool              // 命令和过期命令在 MULTI/EXEC 中执行
+	Unresolved []string          // 没有值的占位符, 执行的时候命令返回 *MissingParamError, 不会发送到 redis
+	Err        error             // 构建错误, 例如 ErrUnknownCommand、ErrMissingParam、ErrCrossSlot
+}
+
+func (e Explanation) String() string {
+	var b strings.Builder
+	b.WriteString(e.Command)
+	if e.Key != "" {
+		fmt.Fprintf(&b, "\nkey: %s", e.Key)
+	}
+	if len(e.Defaults) > 0 {
+		fmt.Fprintf(&b, "\ndefaults: %s", formatDefaults(e.Defaults))
+	}
+	if e.TTL != "" {
+		fmt.Fprintf(&b, "\nttl: %s", e.TTL)
+		for _, line := range e.Expire {
+			fmt.Fprintf(&b, "\n  %s", line)
+		}
+		if e.Tx {
+			b.WriteString("\n  (MULTI/EXEC)")
+		}
+	}
+	if len(e.Unresolved) > 0 {
+		fmt.Fprintf(&b, "\nunresolved: %s", strings.Join(e.Unresolved, ", "))
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, "\nerror: %v", e.Err)
+	}
+	return b.String()
+}
+
+// ScriptExplanation lua 脚本的渲染结果
+type ScriptExplanation struct {
+	SHA        string            // 脚本的 sha1, EVALSHA 使用
+	Keys       []string          // KEYS, 已经加上前缀
+	Argv       []string          // ARGV
+	Defaults   map[string]string // 使用了 Default 的 key/arg
+	Unresolved []string          // 没有值也没有默认值的 key/arg 名字, 执行的时候会返回 ErrMissingParam
+	Err        error             // 构建错误, 例如 ErrCrossSlot
+}
+
+func (e ScriptExplanation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "EVALSHA %s %d", e.SHA, len(e.Keys))
+	for _, arg := range append(append([]string{}, e.Keys...), e.Argv...) {
+		b.WriteString(" " + quoteArg(arg))
+	}
+	for i, k := range e.Keys {
+		fmt.Fprintf(&b, "\nKEYS[%d]: %s", i+1, k)
+	}
+	for i, v := range e.Argv {
+		fmt.Fprintf(&b, "\nARGV[%d]: %s", i+1, v)
+	}
+	if len(e.Defaults) > 0 {
+		fmt.Fprintf(&b, "\ndefaults: %s", formatDefaults(e.Defaults))
+	}
+	if len(e.Unresolved) > 0 {
+		fmt.Fprintf(&b, "\nunresolved: %s", strings.Join(e.Unresolved, ", "))
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, "\nerror: %v", e.Err)
+	}
+	return b.String()
+}
+
+// Explain 渲染命令但不执行, 用于调试模板
+func (rdm RedisClient) Explain(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) Explanation {
+	ctx = withDefaultKeyPrefix(ctx, rdm.Config.KeyPrefix)
+	return explain(ctx, cmd, cmdName, args, includeArgs, rdm.Config.redactParams(), false)
+}
+
+// Explain 渲染命令但不执行, 已经执行过的也按照当时的参数重新渲染
+func (cb *CommandBuilder) Explain() Explanation {
+	redact := DefaultRedactParams
+	if cb.client != nil {
+		redact = cb.client.Config.redactParams()
+	} else if cb.redact != nil {
+		redact = cb.redact
+	}
+	return explain(cb.ctx, cb.cmd, cb.cmdName, cb.args, cb.includeArgs, redact, cb.pipeliner != nil)
+}
+
+// ExplainScript 渲染 lua 脚本的 KEYS/ARGV 但不执行
+func (rdm RedisClient) ExplainScript(ctx context.Context, lua LuaScript, keyInfo map[string]string, valueInfo map[string]any) ScriptExplanation {
+	ctx = withDefaultKeyPrefix(ctx, rdm.Config.KeyPrefix)
+	redact := rdm.Config.redactParams()
+	sum := sha1.Sum([]byte(lua.Script))
+	e := ScriptExplanation{SHA: hex.EncodeToString(sum[:]), Defaults: map[string]string{}}
+	defaultData := map[string]any{}
+	if len(lua.Default) > 0 {
+		defaultData = handlerDefaultValue(lua.Default)
+	}
+	resolve := func(name string, val any, ok bool) string {
+		if !ok {
+			if val, ok = defaultData[name]; ok {
+				e.Defaults[name] = redactValue(name, formatValue(val), redact)
+			}
+		}
+		if !ok {
+			e.Unresolved = append(e.Unresolved, name)
+			return "{{" + name + "}}"
+		}
+		return formatValue(val)
+	}
+	var realKeys []string
+	for _, name := range lua.Keys {
+		v, ok := keyInfo[name]
+		realKeys = append(realKeys, resolve(name, v, ok))
+		e.Keys = append(e.Keys, redactValue(name, realKeys[len(realKeys)-1], redact))
+	}
+	for _, name := range lua.Args {
+		v, ok := valueInfo[name]
+		e.Argv = append(e.Argv, redactValue(name, resolve(name, v, ok), redact))
+	}
+	realKeys = prefixKeys(ctx, realKeys)
+	e.Keys = prefixKeys(ctx, e.Keys)
+	if lua.CheckSlot && len(e.Unresolved) == 0 {
+		e.Err = checkSlots(realKeys)
+	}
+	if len(e.Defaults) == 0 {
+		e.Defaults = nil
+	}
+	return e
+}
+
+// explain 用真实的参数检查占位符和构建错误, 用隐藏了敏感值的参数渲染命令行
+// pipeline 中的命令和执行的时候一样, AtomicExpire 使用 lua 包装而不是 MULTI/EXEC
+func explain(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs []any, redact []string, pipeline bool) Explanation {
+	var e Explanation
+	subCmd, ok := cmd.CMD[cmdName]
+	if !ok {
+		e.Command = string(cmdName)
+		e.Err = fmt.Errorf("%w: %s", ErrUnknownCommand, cmdName)
+		return e
+	}
+	// 复制一份, build 会把默认参数写进 args
+	merged := make(map[string]any, len(args)+len(subCmd.DefaultParams))
+	for k, v := range args {
+		merged[k] = v
+	}
+	for k, v := range subCmd.DefaultParams {
+		if _, ok := merged[k]; !ok {
+			merged[k] = v
+			if e.Defaults == nil {
+				e.Defaults = map[string]string{}
+			}
+			e.Defaults[k] = redactValue(k, formatValue(v), redact)
+		}
+	}
+	templates := []string{subCmd.Params}
+	if !subCmd.NoUseKey {
+		templates = append(templates, hashTagTemplate(cmd))
+	}
+	e.Unresolved = unresolvedPlaceholders(templates, merged)
+
+	_, _, _, e.Err = build(ctx, cmd, cmdName, merged, includeArgs...)
+	shown := make(map[string]any, len(merged))
+	for k, v := range merged {
+		if isRedacted(k, redact) {
+			v = redacted
+		}
+		shown[k] = v
+	}
+	cmdList, key, _, _ := build(ctx, cmd, cmdName, shown, includeArgs...)
+	e.Key = key
+	e.TTL = describeExpire(subCmd)
+	plan := planExpire(ctx, subCmd, key, cmdList, pipeline)
+	e.Args = make([]string, len(plan.cmdArgs))
+	for i, arg := range plan.cmdArgs {
+		e.Args[i] = argString(arg)
+	}
+	e.Command = commandLine(plan.cmdArgs)
+	for _, expireCmd := range plan.expireCmds {
+		e.Expire = append(e.Expire, commandLine(expireCmd.Args()))
+	}
+	e.Tx = plan.tx
+	return e
+}
+
+// unresolvedPlaceholders 模板中没有值或者值不能渲染的占位符, 去重并排序
+func unresolvedPlaceholders(templates []string, args map[string]any) []string {
+	seen := map[string]bool{}
+	for _, template := range templates {
+		specs, _ := placeholderSpecs(template)
+		for _, spec := range specs {
+			name, filterSpec, hasFilter := strings.Cut(spec, "|")
+			name = strings.TrimSpace(name)
+			val, found := args[name]
+			if found && hasFilter {
+				var err error
+				val, err = applyFilters(val, filterSpec)
+				found = err == nil
+			}
+			if found {
+				_, found = appendValue(nil, val)
+			}
+			if !found {
+				seen[name] = true
+			}
+		}
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c Config) redactParams() []string {
+	if c.RedactParams != nil {
+		return c.RedactParams
+	}
+	return DefaultRedactParams
+}
+
+func isRedacted(name string, redact []string) bool {
+	name = strings.ToLower(name)
+	for _, r := range redact {
+		if r != "" && strings.Contains(name, strings.ToLower(r)) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactValue(name, value string, redact []string) string {
+	if isRedacted(name, redact) {
+		return redacted
+	}
+	return value
+}
+
+// commandLine 把参数拼成一行, 空字符串和带空白的参数加引号
+func commandLine(args []any) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = quoteArg(argString(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+func quoteArg(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedisClient_Explain(t *testing.T) {
+	client, hook := newReplyClient(func(args []any) (any, error) { return "OK", nil })
+	client.Config.KeyPrefix = "app:"
+	user := RdCmd{Key: "user:{{userId}}", CMD: map[Command]RdSubCmd{
+		HSET:  {Params: "{{field}} {{value}} token {{apiToken}}", Expire: ExpireIn(30 * time.Second).WithCond(ExpireNX)},
+		SET:   {Params: "{{value}}", Expire: ExpireIn(time.Minute), AtomicExpire: true},
+		HMSET: {Params: "{{field}} {{size}}", DefaultParams: map[string]any{"size": 30}},
+	}}
+	ctx := context.Background()
+
+	e := client.Explain(ctx, user, HSET, map[string]any{"userId": 1, "field": "name", "apiToken": "s3cr3t"})
+	if e.Command != "HSET app:user:1 name {{value}} token ***" || e.Key != "app:user:1" {
+		t.Errorf("unexpected command %q key %q", e.Command, e.Key)
+	}
+	if !reflect.DeepEqual(e.Unresolved, []string{"value"}) {
+		t.Errorf("unexpected unresolved %v", e.Unresolved)
+	}
+	if e.TTL != "30s NX" || !reflect.DeepEqual(e.Expire, []string{"EXPIRE app:user:1 30 NX"}) {
+		t.Errorf("unexpected ttl %q %v", e.TTL, e.Expire)
+	}
+	if strings.Contains(e.String(), "s3cr3t") {
+		t.Errorf("secret leaked: %s", e)
+	}
+
+	e = client.Explain(ctx, user, SET, map[string]any{"userId": 1, "value": "hello world"})
+	if e.Command != `SET app:user:1 "hello world" EX 60` || len(e.Expire) != 0 {
+		t.Errorf("expire should be inlined: %q %v", e.Command, e.Expire)
+	}
+
+	args := map[string]any{"userId": 1, "field": "f"}
+	cb := client.Handler(ctx, user, HMSET, args)
+	e = cb.Explain()
+	if e.Command != "HMSET app:user:1 f 30" || !reflect.DeepEqual(e.Defaults, map[string]string{"size": "30"}) {
+		t.Errorf("unexpected %q %v", e.Command, e.Defaults)
+	}
+	if _, ok := args["size"]; ok || cb.IsExecuted() || len(hook.calls) != 0 {
+		t.Error("Explain should not modify args or execute the command")
+	}
+
+	// pipeline 中的 AtomicExpire 使用 lua 包装, 直接执行的时候使用 MULTI/EXEC
+	counter := RdCmd{Key: "c:{{id}}", CMD: map[Command]RdSubCmd{INCR: {Expire: ExpireIn(time.Minute), AtomicExpire: true}}}
+	if e := client.Explain(ctx, counter, INCR, map[string]any{"id": 1}); !e.Tx || e.Command != "INCR app:c:1" {
+		t.Errorf("direct atomic expire should use MULTI/EXEC, got %q tx %v", e.Command, e.Tx)
+	}
+	e = client.PipeLine().Handler(ctx, counter, INCR, map[string]any{"id": 1}).Explain()
+	if e.Tx || !strings.HasPrefix(e.Command, "EVAL ") || !strings.HasSuffix(e.Command, "2 INCR app:c:1 3 EXPIRE app:c:1 60") {
+		t.Errorf("pipeline atomic expire should use the lua wrap, got %q tx %v", e.Command, e.Tx)
+	}
+
+	client.Config.RedactParams = []string{"field"}
+	if e := client.Explain(ctx, user, HMSET, args); e.Command != "HMSET app:user:1 *** 30" {
+		t.Errorf("RedactParams not applied: %q", e.Command)
+	}
+	if e := client.Explain(ctx, user, GET, nil); !errors.Is(e.Err, ErrUnknownCommand) {
+		t.Errorf("expected ErrUnknownCommand, got %v", e.Err)
+	}
+}
+
+func TestRedisClient_ExplainScript(t *testing.T) {
+	client, _ := newReplyClient(func(args []any) (any, error) { return nil, nil })
+	client.Config.KeyPrefix = "app:"
+	lua := LuaScript{
+		Script:  "return redis.call('SET', KEYS[1], ARGV[1])",
+		Keys:    []string{"userKey", "otherKey"},
+		Args:    []string{"password", "size"},
+		Default: map[string]any{"size": "30"},
+	}
+	e := client.ExplainScript(context.Background(), lua, map[string]string{"userKey": "user:1"}, map[string]any{"password": "pw"})
+	if !reflect.DeepEqual(e.Keys, []string{"app:user:1", "app:{{otherKey}}"}) || !reflect.DeepEqual(e.Argv, []string{"***", "30"}) {
+		t.Errorf("unexpected keys %v argv %v", e.Keys, e.Argv)
+	}
+	if !reflect.DeepEqual(e.Unresolved, []string{"otherKey"}) || e.Defaults["size"] != "30" || len(e.SHA) != 40 {
+		t.Errorf("unexpected %+v", e)
+	}
+	if !strings.HasPrefix(e.String(), "EVALSHA "+e.SHA+" 2 app:user:1") {
+		t.Errorf("unexpected string %s", e)
+	}
+}
@@ -0,0 +1,136 @@
+package rdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 占位符过滤器, 写法为 {{name|filter:arg|filter2}}, 依次作用在参数值上, key 和 Params 中都可以使用
+// 内置过滤器:
+//
+//	{{ts|date:20060102}}  time.Time 或者秒级时间戳按 layout 格式化
+//	{{score|%.2f}}        以 % 开头的按 fmt.Sprintf 格式化
+//	{{id|pad:10}}         左侧补 0 到指定长度, 用于 ZRANGEBYLEX 等按字典序排序的场景
+//	{{name|lower}}        转小写, upper 转大写
+//
+// 注意 Params 是按空格拆分的, 过滤器参数里不能包含空格
+
+// FilterFunc 过滤器, arg 是冒号后面的内容, 没有的时候为空字符串
+type FilterFunc func(value any, arg string) (any, error)
+
+var (
+	filtersMu sync.RWMutex
+	filters   = map[string]FilterFunc{
+		"date":  dateFilter,
+		"pad":   padFilter,
+		"lower": func(v any, _ string) (any, error) { return strings.ToLower(formatValue(v)), nil },
+		"upper": func(v any, _ string) (any, error) { return strings.ToUpper(formatValue(v)), nil },
+	}
+)
+
+// RegisterFilter 注册自定义过滤器, 同名会覆盖内置的过滤器
+func RegisterFilter(name string, fn FilterFunc) {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+	filters[name] = fn
+}
+
+func lookupFilter(name string) (FilterFunc, bool) {
+	filtersMu.RLock()
+	defer filtersMu.RUnlock()
+	fn, ok := filters[name]
+	return fn, ok
+}
+
+// applyFilters 依次执行过滤器, spec 为 | 之后的部分
+func applyFilters(value any, spec string) (any, error) {
+	for _, f := range strings.Split(spec, "|") {
+		f = strings.TrimSpace(f)
+		if strings.HasPrefix(f, "%") {
+			value = fmt.Sprintf(f, value)
+			continue
+		}
+		name, arg, _ := strings.Cut(f, ":")
+		fn, ok := lookupFilter(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown filter %q", name)
+		}
+		var err error
+		if value, err = fn(value, arg); err != nil {
+			return nil, fmt.Errorf("filter %s: %w", name, err)
+		}
+	}
+	return value, nil
+}
+
+func dateFilter(value any, layout string) (any, error) {
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(layout), nil
+	case int64:
+		return time.Unix(v, 0).Format(layout), nil
+	case int:
+		return time.Unix(int64(v), 0).Format(layout), nil
+	case int32:
+		return time.Unix(int64(v), 0).Format(layout), nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
+
+func padFilter(value any, arg string) (any, error) {
+	width, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid width %q", arg)
+	}
+	s := formatValue(value)
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	if len(s) < width {
+		s = strings.Repeat("0", width-len(s)) + s
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s, nil
+}
+
+// validateFilters 校验模板中用到的过滤器都已经注册
+func validateFilters(template string) error {
+	specs, err := placeholderSpecs(template)
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		_, filterSpec, ok := strings.Cut(spec, "|")
+		if !ok {
+			continue
+		}
+		for _, f := range strings.Split(filterSpec, "|") {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "%") {
+				continue
+			}
+			name, _, _ := strings.Cut(f, ":")
+			if _, ok := lookupFilter(name); !ok {
+				return fmt.Errorf("unknown filter %q in %q", name, template)
+			}
+		}
+	}
+	return nil
+}
+
+// formatValue 按 highPerfReplace 的规则把值转成字符串, 不支持的类型使用 fmt.Sprint
+func formatValue(value any) string {
+	if b, ok := appendValue(nil, value); ok {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,91 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_highPerfReplace_Filters(t *testing.T) {
+	ts := time.Date(2026, 10, 18, 8, 0, 0, 0, time.Local)
+	args := map[string]any{
+		"ts":    ts,
+		"unix":  ts.Unix(),
+		"score": 3.14159,
+		"id":    42,
+		"neg":   -7,
+		"name":  "Alice",
+	}
+	tests := map[string]string{
+		"rank:{{ts|date:20060102}}":   "rank:20261018",
+		"rank:{{unix|date:20060102}}": "rank:20261018",
+		"{{score|%.2f}}":              "3.14",
+		"{{id|pad:10}}":               "0000000042",
+		"{{neg|pad:4}}":               "-0007",
+		"{{name|lower}}:{{name}}":     "alice:Alice",
+		"{{name|lower|upper}}":        "ALICE",
+		"{{id|%05d|pad:8}}":           "00000042",
+		"{{missing|lower}}":           "{{missing|lower}}",
+	}
+	for template, want := range tests {
+		got, err := highPerfReplace([]byte(template), args)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %s (%v), want %s", template, got, err, want)
+		}
+	}
+	// 过滤器出错的时候占位符原样保留并返回 ErrFilter
+	for _, template := range []string{"{{name|nope}}", "{{ts|pad:x}}", "a:{{{name|nope}}}"} {
+		got, err := highPerfReplace([]byte(template), args)
+		if !errors.Is(err, ErrFilter) || !strings.Contains(string(got), "{{name|nope}}") && !strings.Contains(string(got), "{{ts|pad:x}}") {
+			t.Errorf("%s: expected ErrFilter with placeholder kept, got %s (%v)", template, got, err)
+		}
+	}
+}
+
+func TestRegisterFilter(t *testing.T) {
+	RegisterFilter("reverse", func(v any, _ string) (any, error) {
+		s := []rune(formatValue(v))
+		for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+			s[i], s[j] = s[j], s[i]
+		}
+		return string(s), nil
+	})
+	RegisterFilter("fail", func(v any, _ string) (any, error) { return nil, errors.New("boom") })
+
+	cmd := RdCmd{
+		Key: "user:{{id|reverse}}",
+		CMD: map[Command]RdSubCmd{ZRANGEBYLEX: {Params: "[{{from|pad:6}} +"}},
+	}
+	cmdArgs, _, _ := Build(context.Background(), cmd, ZRANGEBYLEX, map[string]any{"id": 123, "from": 7})
+	if !reflect.DeepEqual(cmdArgs, []any{"ZRANGEBYLEX", "user:321", "[000007", "+"}) {
+		t.Errorf("unexpected args %v", cmdArgs)
+	}
+	// 过滤器出错的命令不发送, 错误里带着原始的错误
+	_, _, _, err := build(context.Background(), RdCmd{Key: "user:{{id|fail}}", CMD: map[Command]RdSubCmd{GET: {}}}, GET, map[string]any{"id": 1})
+	if !errors.Is(err, ErrFilter) || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected ErrFilter from build, got %v", err)
+	}
+	client, hook := newReplyClient(func(args []any) (any, error) { return "x", nil })
+	if err := client.Get(context.Background(), RdCmd{Key: "user:{{id|fail}}", CMD: map[Command]RdSubCmd{GET: {}}}, map[string]any{"id": 1}).Err(); !errors.Is(err, ErrFilter) {
+		t.Errorf("expected builder to fail with ErrFilter, got %v", err)
+	}
+	if len(hook.calls) != 0 {
+		t.Errorf("failed command should not be sent, got %v", hook.calls)
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	if err := validateFilters("{{a|date:20060102}}:{{b|%.2f}}:{{c}}"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := validateFilters("{{a|unknownFilter}}"); err == nil || !strings.Contains(err.Error(), "unknownFilter") {
+		t.Errorf("expected unknown filter error, got %v", err)
+	}
+	names, _ := Placeholders("{{ts|date:20060102}}:{{{uid}}}")
+	if !reflect.DeepEqual(names, []string{"ts", "uid"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+}
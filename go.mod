@@ -2,7 +2,10 @@ module github.com/preceeder/rdb
 
 go 1.24.2
 
-require github.com/redis/go-redis/v9 v9.8.0
+require (
+	github.com/redis/go-redis/v9 v9.8.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
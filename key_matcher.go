@@ -0,0 +1,237 @@
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrKeyNotMatch 具体的 key 和模板不匹配
+var ErrKeyNotMatch = errors.New("rdb: key does not match template")
+
+// KeyMatcher 把 RdCmd.Key 模板编译成解析器, 用于把 SCAN 或者 keyspace 通知拿到的具体 key 反解析成占位符的值
+//
+//	m, _ := NewKeyMatcher("user:{{userId}}:wallet")
+//	m.Match("user:42:wallet") // map[userId:42], true
+//	m.Glob()                  // user:*:wallet
+//
+// 带过滤器的占位符返回的是过滤之后的字符串, 例如 {{id|pad:10}} 得到 0000000042
+type KeyMatcher struct {
+	template string
+	re       *regexp.Regexp
+	names    []string // 按出现顺序, 与正则的分组一一对应
+	segments []keySegment
+}
+
+type keySegment struct {
+	literal string
+	name    string // 不为空表示占位符
+}
+
+// NewKeyMatcher 编译 key 模板
+func NewKeyMatcher(template string) (*KeyMatcher, error) {
+	m := &KeyMatcher{template: template}
+	rest := template
+	for rest != "" {
+		start := strings.Index(rest, "{{")
+		if start == -1 {
+			m.segments = append(m.segments, keySegment{literal: rest})
+			break
+		}
+		open, closeTag, tag := 2, "}}", false
+		if strings.HasPrefix(rest[start:], "{{{") && strings.Contains(rest[start:], "}}}") {
+			open, closeTag, tag = 3, "}}}", true
+		}
+		end := strings.Index(rest[start+open:], closeTag)
+		if end == -1 {
+			return nil, fmt.Errorf("rdb: unclosed placeholder in %q", template)
+		}
+		name, _, _ := strings.Cut(rest[start+open:start+open+end], "|")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("rdb: empty placeholder in %q", template)
+		}
+		literal := rest[:start]
+		if tag {
+			literal += "{"
+		}
+		if literal != "" {
+			m.segments = append(m.segments, keySegment{literal: literal})
+		}
+		m.segments = append(m.segments, keySegment{name: name})
+		if tag {
+			m.segments = append(m.segments, keySegment{literal: "}"})
+		}
+		rest = rest[start+open+end+len(closeTag):]
+	}
+	m.compile()
+	return m, nil
+}
+
+// KeyMatcher 编译 RdCmd 的 key 模板, HashTag 的处理与 Build 一致
+func (cmd RdCmd) KeyMatcher() (*KeyMatcher, error) {
+	return NewKeyMatcher(hashTagTemplate(cmd))
+}
+
+func (m *KeyMatcher) compile() {
+	var b strings.Builder
+	b.WriteString("^")
+	m.names = m.names[:0]
+	for _, seg := range m.segments {
+		if seg.name != "" {
+			b.WriteString("(.+?)")
+			m.names = append(m.names, seg.name)
+		} else {
+			b.WriteString(regexp.QuoteMeta(seg.literal))
+		}
+	}
+	b.WriteString("$")
+	m.re = regexp.MustCompile(b.String())
+}
+
+// WithPrefix 返回匹配带前缀 key 的解析器, 与 Config.KeyPrefix / WithKeyPrefix 配合使用
+func (m *KeyMatcher) WithPrefix(prefix string) *KeyMatcher {
+	if prefix == "" {
+		return m
+	}
+	p := &KeyMatcher{template: prefix + m.template}
+	p.segments = append([]keySegment{{literal: prefix}}, m.segments...)
+	p.compile()
+	return p
+}
+
+// Names 返回模板中的占位符名, 按出现顺序去重
+func (m *KeyMatcher) Names() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, n := range m.names {
+		if !seen[n] {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// Match 解析具体的 key, 同一个占位符出现多次时值必须一致
+func (m *KeyMatcher) Match(key string) (map[string]string, bool) {
+	groups := m.re.FindStringSubmatch(key)
+	if groups == nil {
+		return nil, false
+	}
+	values := make(map[string]string, len(m.names))
+	for i, name := range m.names {
+		v := groups[i+1]
+		if old, ok := values[name]; ok && old != v {
+			return nil, false
+		}
+		values[name] = v
+	}
+	return values, true
+}
+
+// Scan 解析 key 并填充到结构体指针 dst 中
+// 字段通过 `rdb:"userId"` 标签匹配, 没有标签的时候按字段名忽略大小写匹配
+func (m *KeyMatcher) Scan(key string, dst any) error {
+	values, ok := m.Match(key)
+	if !ok {
+		return fmt.Errorf("%w: %q %q", ErrKeyNotMatch, key, m.template)
+	}
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("rdb: Scan dst must be a pointer to struct, got %T", dst)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("rdb")
+		if name == "-" {
+			continue
+		}
+		var value string
+		var found bool
+		if name != "" {
+			value, found = values[name]
+		} else {
+			for k, v := range values {
+				if strings.EqualFold(k, field.Name) {
+					value, found = v, true
+					break
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+		if err := setField(rv.Field(i), value); err != nil {
+			return fmt.Errorf("rdb: field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func setField(f reflect.Value, value string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported kind %s", f.Kind())
+	}
+	return nil
+}
+
+// Glob 生成 SCAN MATCH 使用的 glob, 占位符替换成 *, 字面量中的 glob 特殊字符会被转义
+func (m *KeyMatcher) Glob() string {
+	var b strings.Builder
+	lastStar := false
+	for _, seg := range m.segments {
+		if seg.name != "" {
+			if !lastStar {
+				b.WriteByte('*')
+			}
+			lastStar = true
+			continue
+		}
+		for i := 0; i < len(seg.literal); i++ {
+			c := seg.literal[i]
+			switch c {
+			case '*', '?', '[', ']', '\\':
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		}
+		lastStar = false
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package rdb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestKeyMatcher_Match(t *testing.T) {
+	m, err := NewKeyMatcher("user:{{userId}}:wallet:{{coin|lower}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, ok := m.Match("user:42:wallet:gold")
+	if !ok || !reflect.DeepEqual(values, map[string]string{"userId": "42", "coin": "gold"}) {
+		t.Errorf("unexpected match %v %v", values, ok)
+	}
+	if _, ok := m.Match("user:42:bag:gold"); ok {
+		t.Error("should not match a different layout")
+	}
+	if got := m.Glob(); got != "user:*:wallet:*" {
+		t.Errorf("unexpected glob %s", got)
+	}
+	if !reflect.DeepEqual(m.Names(), []string{"userId", "coin"}) {
+		t.Errorf("unexpected names %v", m.Names())
+	}
+}
+
+func TestKeyMatcher_HashTagAndPrefix(t *testing.T) {
+	cmd := RdCmd{Key: "rank:{{season}}:[{{userId}}]", HashTag: "season"}
+	m, err := cmd.KeyMatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = m.WithPrefix("staging:")
+	values, ok := m.Match("staging:rank:{s1}:[7]")
+	if !ok || values["season"] != "s1" || values["userId"] != "7" {
+		t.Errorf("unexpected match %v %v", values, ok)
+	}
+	if got := m.Glob(); got != `staging:rank:{*}:\[*\]` {
+		t.Errorf("unexpected glob %s", got)
+	}
+}
+
+func TestKeyMatcher_Repeated(t *testing.T) {
+	m, _ := NewKeyMatcher("{{a}}:{{a}}")
+	if _, ok := m.Match("x:x"); !ok {
+		t.Error("same values should match")
+	}
+	if _, ok := m.Match("x:y"); ok {
+		t.Error("different values for the same placeholder should not match")
+	}
+}
+
+func TestKeyMatcher_Scan(t *testing.T) {
+	type walletKey struct {
+		UserID int64 `rdb:"userId"`
+		Coin   string
+		Level  uint8
+		Skip   string `rdb:"-"`
+	}
+	m, _ := NewKeyMatcher("user:{{userId}}:wallet:{{coin}}:{{level}}")
+	var k walletKey
+	if err := m.Scan("user:42:wallet:gold:3", &k); err != nil {
+		t.Fatal(err)
+	}
+	if k != (walletKey{UserID: 42, Coin: "gold", Level: 3}) {
+		t.Errorf("unexpected scan %+v", k)
+	}
+	if err := m.Scan("other:42", &k); !errors.Is(err, ErrKeyNotMatch) {
+		t.Errorf("expected ErrKeyNotMatch, got %v", err)
+	}
+	if err := m.Scan("user:abc:wallet:gold:3", &k); err == nil {
+		t.Error("expected parse error")
+	}
+}
@@ -0,0 +1,69 @@
+package rdb
+
+import (
+	"context"
+	"fmt"
+)
+
+type keyPrefixCtxKey struct{}
+
+// WithKeyPrefix 给 ctx 设置 key 前缀, 优先级高于 Config.KeyPrefix
+// 用于按租户等维度临时切换命名空间, 传入空字符串表示这次调用不加前缀
+func WithKeyPrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, keyPrefixCtxKey{}, prefix)
+}
+
+// KeyPrefixFromContext 获取 ctx 上的 key 前缀
+func KeyPrefixFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	prefix, ok := ctx.Value(keyPrefixCtxKey{}).(string)
+	return prefix, ok
+}
+
+// withDefaultKeyPrefix ctx 上没有设置前缀的时候使用客户端配置的前缀
+func withDefaultKeyPrefix(ctx context.Context, prefix string) context.Context {
+	if prefix == "" {
+		return ctx
+	}
+	if _, ok := KeyPrefixFromContext(ctx); ok {
+		return ctx
+	}
+	return WithKeyPrefix(ctx, prefix)
+}
+
+// applyKeyPrefix 给参数列表中所有 key 位置加上前缀, 非 key 的参数不做处理
+func applyKeyPrefix(ctx context.Context, cmdName Command, cmdArgs []any) {
+	prefix, _ := KeyPrefixFromContext(ctx)
+	if prefix == "" {
+		return
+	}
+	for _, i := range keyIndexes(cmdName, cmdArgs) {
+		cmdArgs[i] = prefixKey(prefix, cmdArgs[i])
+	}
+}
+
+// prefixKeys 给 lua 脚本的 KEYS 加前缀
+func prefixKeys(ctx context.Context, keys []string) []string {
+	prefix, _ := KeyPrefixFromContext(ctx)
+	if prefix == "" || len(keys) == 0 {
+		return keys
+	}
+	result := make([]string, len(keys))
+	for i, k := range keys {
+		result[i] = prefix + k
+	}
+	return result
+}
+
+func prefixKey(prefix string, key any) any {
+	switch k := key.(type) {
+	case string:
+		return prefix + k
+	case []byte:
+		return append([]byte(prefix), k...)
+	default:
+		return prefix + fmt.Sprint(k)
+	}
+}
@@ -0,0 +1,99 @@
+package rdb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+var prefixCmd = RdCmd{
+	Key: "user:{{userId}}",
+	CMD: map[Command]RdSubCmd{
+		HSET:        {Params: "{{field}} {{value}}"},
+		MSET:        {Params: "{{value}}"},
+		SUNIONSTORE: {Params: "{{src1}} {{src2}}"},
+		ZINTERSTORE: {Params: "2 {{src1}} {{src2}} WEIGHTS 1 2"},
+		SORT:        {Params: "LIMIT 0 10 STORE {{src1}}"},
+		"MOVE_TO":   {CmdName: "LMOVE", Params: "{{src1}} LEFT RIGHT"},
+	},
+}
+
+func TestBuild_KeyPrefix(t *testing.T) {
+	ctx := WithKeyPrefix(context.Background(), "staging:")
+	args := map[string]any{"userId": 42, "field": "name", "value": "bob", "src1": "a", "src2": "b"}
+
+	tests := []struct {
+		name    Command
+		include []any
+		want    []any
+	}{
+		{HSET, nil, []any{"HSET", "staging:user:42", "name", "bob"}},
+		{MSET, []any{"user:43", "alice"}, []any{"MSET", "staging:user:42", "bob", "staging:user:43", "alice"}},
+		{SUNIONSTORE, nil, []any{"SUNIONSTORE", "staging:user:42", "staging:a", "staging:b"}},
+		{ZINTERSTORE, nil, []any{"ZINTERSTORE", "staging:user:42", "2", "staging:a", "staging:b", "WEIGHTS", "1", "2"}},
+		{SORT, nil, []any{"SORT", "staging:user:42", "LIMIT", "0", "10", "STORE", "staging:a"}},
+		// CmdName 的 key 位置按真正的命令名计算
+		{"MOVE_TO", nil, []any{"LMOVE", "staging:user:42", "staging:a", "LEFT", "RIGHT"}},
+	}
+	for _, tt := range tests {
+		cmdArgs, key, _ := Build(ctx, prefixCmd, tt.name, args, tt.include...)
+		if !reflect.DeepEqual(cmdArgs, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, cmdArgs, tt.want)
+		}
+		if key != "staging:user:42" {
+			t.Errorf("%s: key got %s", tt.name, key)
+		}
+	}
+}
+
+func TestBuild_KeyPrefixOverride(t *testing.T) {
+	ctx := withDefaultKeyPrefix(WithKeyPrefix(context.Background(), "tenant1:"), "staging:")
+	cmdArgs, _, _ := Build(ctx, prefixCmd, HSET, map[string]any{"userId": 1, "field": "f", "value": "v"})
+	if cmdArgs[1] != "tenant1:user:1" {
+		t.Errorf("override prefix not applied: %v", cmdArgs)
+	}
+
+	ctx = withDefaultKeyPrefix(context.Background(), "")
+	cmdArgs, _, _ = Build(ctx, prefixCmd, HSET, map[string]any{"userId": 1, "field": "f", "value": "v"})
+	if cmdArgs[1] != "user:1" {
+		t.Errorf("empty prefix should keep key: %v", cmdArgs)
+	}
+}
+
+func TestKeyIndexes(t *testing.T) {
+	tests := []struct {
+		name Command
+		args []any
+		want []int
+	}{
+		{GET, []any{"GET", "k"}, []int{1}},
+		{"get", []any{"get", "k"}, []int{1}},
+		{BLPOP, []any{"BLPOP", "a", "b", "0"}, []int{1, 2}},
+		{EVAL, []any{"EVAL", "script", "2", "a", "b", "x"}, []int{3, 4}},
+		{BITOP, []any{"BITOP", "AND", "d", "a", "b"}, []int{2, 3, 4}},
+		{XREAD, []any{"XREAD", "COUNT", "2", "STREAMS", "s1", "s2", "0", "0"}, []int{4, 5}},
+		{LMOVE, []any{"LMOVE", "a", "b", "LEFT", "RIGHT"}, []int{1, 2}},
+		{COPY, []any{"COPY", "a", "b", "REPLACE"}, []int{1, 2}},
+		{BLMPOP, []any{"BLMPOP", "0", "2", "a", "b", "LEFT"}, []int{3, 4}},
+		{BZMPOP, []any{"BZMPOP", "0", "1", "a", "MIN"}, []int{3}},
+		{ZINTERCARD, []any{"ZINTERCARD", "2", "a", "b", "LIMIT", "1"}, []int{2, 3}},
+		{ZRANGESTORE, []any{"ZRANGESTORE", "d", "a", "0", "-1"}, []int{1, 2}},
+		{BZPOPMIN, []any{"BZPOPMIN", "a", "b", "0"}, []int{1, 2}},
+		{SORT, []any{"SORT", "a", "STORE", "d"}, []int{1, 3}},
+		{GEORADIUS, []any{"GEORADIUS", "g", "0", "0", "1", "km", "STORE", "d", "STOREDIST", "e"}, []int{1, 7, 9}},
+		{PING, []any{"PING"}, nil},
+	}
+	for _, tt := range tests {
+		if got := keyIndexes(tt.name, tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixKeys(t *testing.T) {
+	ctx := WithKeyPrefix(context.Background(), "p:")
+	got := prefixKeys(ctx, []string{"a", "b"})
+	if !reflect.DeepEqual(got, []string{"p:a", "p:b"}) {
+		t.Errorf("got %v", got)
+	}
+}
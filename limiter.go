@@ -0,0 +1,243 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited 超过了客户端的限流并且设置了 Reject
+var ErrRateLimited = errors.New("rdb: rate limited")
+
+// Limit 客户端限流, RPS 和 Concurrency 可以同时设置
+type Limit struct {
+	RPS         float64 `json:"rps" yaml:"rps"`                 // 每秒的请求数, 0 不限制
+	Burst       int     `json:"burst" yaml:"burst"`             // 允许的突发请求数, 默认 max(1, RPS)
+	Concurrency int     `json:"concurrency" yaml:"concurrency"` // 同时执行的命令数, 0 不限制
+	Reject      bool    `json:"reject" yaml:"reject"`           // 超过限制直接返回 ErrRateLimited, 默认等待到可以执行或者 ctx 结束
+}
+
+// limiter 单个限流规则的状态, RPS 使用令牌桶, Concurrency 使用信号量
+type limiter struct {
+	name  string
+	limit Limit
+	sem   chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(name string, limit Limit) *limiter {
+	l := &limiter{name: name, limit: limit}
+	if limit.Burst <= 0 {
+		l.limit.Burst = max(1, int(limit.RPS))
+	}
+	l.tokens = float64(l.limit.Burst)
+	if limit.Concurrency > 0 {
+		l.sem = make(chan struct{}, limit.Concurrency)
+	}
+	return l
+}
+
+// acquire 拿到执行的许可, 返回释放并发数的函数
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if l.limit.RPS > 0 {
+		if err := l.take(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return l.acquireSem(ctx)
+}
+
+// acquireSem 占用一个并发数, 没有设置 Concurrency 的时候直接返回
+func (l *limiter) acquireSem(ctx context.Context) (func(), error) {
+	if l.sem == nil {
+		return func() {}, nil
+	}
+	if l.limit.Reject {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			return nil, fmt.Errorf("%w: %s concurrency %d", ErrRateLimited, l.name, l.limit.Concurrency)
+		}
+	} else {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { <-l.sem }, nil
+}
+
+// take 从令牌桶中取一个令牌
+func (l *limiter) take(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if !l.last.IsZero() {
+			l.tokens = min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limit.RPS)
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.limit.RPS * float64(time.Second))
+		l.mu.Unlock()
+		if l.limit.Reject {
+			return fmt.Errorf("%w: %s rps %g", ErrRateLimited, l.name, l.limit.RPS)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// limiterSet client 上所有的限流规则
+// Config.CmdLimits 按命令名, Config.KeyLimits 按 RdCmd.Key 模板, RdSubCmd.Limit 按 key 模板和子命令, LuaScript.Limit 按脚本, 命中的规则都要满足
+type limiterSet struct {
+	cmds map[string]*limiter
+	keys map[string]*limiter
+
+	mu   sync.Mutex
+	subs map[string]*limiter
+}
+
+func newLimiterSet(config Config) *limiterSet {
+	s := &limiterSet{cmds: map[string]*limiter{}, keys: map[string]*limiter{}, subs: map[string]*limiter{}}
+	for name, limit := range config.CmdLimits {
+		name = strings.ToUpper(name)
+		s.cmds[name] = newLimiter("cmd "+name, limit)
+	}
+	for key, limit := range config.KeyLimits {
+		s.keys[key] = newLimiter("key "+key, limit)
+	}
+	return s
+}
+
+// acquire 依次拿到命中的所有规则的许可, 失败的时候释放已经拿到的
+// 没有设置限流 (包括 s 为 nil) 的时候直接返回
+func (s *limiterSet) acquire(ctx context.Context, cmd RdCmd, cmdName Command) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	return acquireAll(ctx, s.hits(cmd, cmdName))
+}
+
+// acquireScript 脚本按 Config.CmdLimits 中的 EVALSHA/EVAL 和 LuaScript.Limit 限流
+func (s *limiterSet) acquireScript(ctx context.Context, lua LuaScript) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	var hits []*limiter
+	for _, name := range []string{string(EVALSHA), string(EVAL)} {
+		if l, ok := s.cmds[name]; ok {
+			hits = append(hits, l)
+		}
+	}
+	if lua.Limit != nil {
+		hits = append(hits, s.sub("lua "+lua.Script, *lua.Limit))
+	}
+	return acquireAll(ctx, hits)
+}
+
+// acquireBatch Batch 中的命令各自消耗 RPS 的令牌; 并发数按 pipeline 计算, 同一个规则只占用一个, pipeline 执行完之后释放
+// 返回的 errs 和 builders 一一对应, 拿不到许可的命令不发送
+func (s *limiterSet) acquireBatch(ctx context.Context, builders []*CommandBuilder) (func(), []error) {
+	errs := make([]error, len(builders))
+	if s == nil {
+		return func() {}, errs
+	}
+	var held []*limiter
+	var releases []func()
+	for i, cb := range builders {
+		hits := s.hits(cb.cmd, cb.cmdName)
+		for _, l := range hits {
+			if l.limit.RPS > 0 {
+				if errs[i] = l.take(ctx); errs[i] != nil {
+					break
+				}
+			}
+		}
+		for _, l := range hits {
+			if errs[i] != nil {
+				break
+			}
+			if l.sem == nil || slices.Contains(held, l) {
+				continue
+			}
+			var r func()
+			if r, errs[i] = l.acquireSem(ctx); errs[i] == nil {
+				held = append(held, l)
+				releases = append(releases, r)
+			}
+		}
+	}
+	return func() {
+		for _, r := range releases {
+			r()
+		}
+	}, errs
+}
+
+// hits 命令命中的所有规则
+func (s *limiterSet) hits(cmd RdCmd, cmdName Command) []*limiter {
+	subCmd := cmd.CMD[cmdName]
+	realName := string(cmdName)
+	if subCmd.CmdName != "" {
+		realName = subCmd.CmdName
+	}
+	var hits []*limiter
+	if l, ok := s.cmds[strings.ToUpper(realName)]; ok {
+		hits = append(hits, l)
+	}
+	if l, ok := s.keys[cmd.Key]; ok {
+		hits = append(hits, l)
+	}
+	if subCmd.Limit != nil {
+		hits = append(hits, s.sub(cmd.Key+" "+string(cmdName), *subCmd.Limit))
+	}
+	return hits
+}
+
+// sub RdSubCmd.Limit 和 LuaScript.Limit 的规则, 第一次使用的时候创建
+func (s *limiterSet) sub(name string, limit Limit) *limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.subs[name]
+	if !ok {
+		l = newLimiter(name, limit)
+		s.subs[name] = l
+	}
+	return l
+}
+
+// acquireAll 依次拿到所有规则的许可, 失败的时候释放已经拿到的
+func acquireAll(ctx context.Context, hits []*limiter) (func(), error) {
+	releases := make([]func(), 0, len(hits))
+	release := func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+	for _, l := range hits {
+		r, err := l.acquire(ctx)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return release, nil
+}
@@ -0,0 +1,133 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Concurrency(t *testing.T) {
+	l := newLimiter("test", Limit{Concurrency: 1})
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected to wait until ctx done, got %v", err)
+	}
+	reject := newLimiter("test", Limit{Concurrency: 1, Reject: true})
+	r, _ := reject.acquire(context.Background())
+	if _, err := reject.acquire(context.Background()); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited, got %v", err)
+	}
+	r()
+	release()
+	if _, err := l.acquire(context.Background()); err != nil {
+		t.Errorf("released slot should be available, got %v", err)
+	}
+}
+
+func TestLimiter_RPS(t *testing.T) {
+	l := newLimiter("test", Limit{RPS: 100, Burst: 2})
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := l.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 2 个突发之后每 10ms 一个
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("expected to wait for tokens, took %v", elapsed)
+	}
+}
+
+func TestRedisClient_Limits(t *testing.T) {
+	client, hook := newReplyClient(func(args []any) (any, error) { return "OK", nil })
+	client.Config.CmdLimits = map[string]Limit{"keys": {RPS: 0.001, Reject: true}}
+	client.setup()
+	scan := RdCmd{Key: "user:*", CMD: map[Command]RdSubCmd{
+		KEYS: {},
+		GET:  {Limit: &Limit{RPS: 0.001, Burst: 2, Reject: true}},
+	}}
+	ctx := context.Background()
+
+	if err := client.Handler(ctx, scan, KEYS, nil).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Handler(ctx, scan, KEYS, nil).Err(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.Handler(ctx, scan, GET, nil).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Handler(ctx, scan, GET, nil).Err(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited from sub command limit, got %v", err)
+	}
+	if len(hook.calls) != 3 {
+		t.Errorf("limited commands should not be sent: %v", hook.calls)
+	}
+
+	// 显式的 pipeline 不受限制
+	pipe := client.PipeLine()
+	pipe.Handler(ctx, scan, KEYS, nil).Exec(ctx)
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Errorf("pipeline should not be limited, got %v", err)
+	}
+
+	// Batch 中每个命令消耗各自的令牌, 并发数按 pipeline 计算, 超过的命令不发送
+	client.Config.KeyLimits = map[string]Limit{"item:{{id}}": {RPS: 0.001, Burst: 2, Concurrency: 1, Reject: true}}
+	client.setup()
+	hook.calls = nil
+	item := RdCmd{Key: "item:{{id}}", CMD: map[Command]RdSubCmd{GET: {}}}
+	items := make([]*CommandBuilder, 3)
+	for i := range items {
+		items[i] = client.Handler(ctx, item, GET, map[string]any{"id": i})
+	}
+	if err := client.Batch(ctx, items...); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited from batch, got %v", err)
+	}
+	if len(hook.calls) != 2 || items[1].Err() != nil || !errors.Is(items[2].Err(), ErrRateLimited) {
+		t.Errorf("only two commands should be sent, calls %v, errors %v %v", hook.calls, items[1].Err(), items[2].Err())
+	}
+
+	// 自动 pipeline 中的命令同样受限制
+	client.setup()
+	client.EnableAutoPipeline(AutoPipelineOptions{})
+	for i := 0; i < 2; i++ {
+		if err := client.Handler(ctx, item, GET, map[string]any{"id": i}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Handler(ctx, item, GET, map[string]any{"id": 3}).Err(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited from auto pipeline, got %v", err)
+	}
+	client.DisableAutoPipeline()
+
+	// 脚本按 EVALSHA 和 LuaScript.Limit 限流
+	client.Config.CmdLimits = map[string]Limit{"evalsha": {RPS: 0.001, Reject: true}}
+	client.setup()
+	lua := LuaScript{Script: "return 1"}
+	if err := client.ExecScript(ctx, lua, nil, nil).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ExecScript(ctx, lua, nil, nil).Err(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited from EVALSHA limit, got %v", err)
+	}
+	client.Config.CmdLimits = nil
+	client.setup()
+	lua.Limit = &Limit{RPS: 0.001, Reject: true}
+	if err := client.ExecScript(ctx, lua, nil, nil).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ExecScript(ctx, lua, nil, nil).Err(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited from script limit, got %v", err)
+	}
+	if err := client.ExecScript(ctx, LuaScript{Script: "return 2"}, nil, nil).Err(); err != nil {
+		t.Errorf("other scripts should not be limited, got %v", err)
+	}
+}
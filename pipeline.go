@@ -2,31 +2,133 @@ package rdb
 
 import (
 	"context"
+	"errors"
+	"sync"
+
 	"github.com/redis/go-redis/v9"
 )
 
 type RedisPipeline struct {
 	lua
 	builder
-	Client redis.Pipeliner
+	Client    redis.Pipeliner
+	keyPrefix string
+	// OnExpireError 设置过期时间失败的回调, 默认继承 RedisClient.OnExpireError
+	OnExpireError ExpireErrorHook
+	tracker       *pipelineTracker
+	redact        []string // Config.RedactParams
 }
 
 func newPipeline(client RedisClient) *RedisPipeline {
-	pip := RedisPipeline{
-		Client: client.Client.Pipeline(),
+	return newPipelineWith(client, client.Client.Pipeline())
+}
+
+// newTxPipeline 事务, Exec 的时候用 MULTI/EXEC 包起来执行
+func newTxPipeline(client RedisClient) *RedisPipeline {
+	return newPipelineWith(client, client.Client.TxPipeline())
+}
+
+func newPipelineWith(client RedisClient, pipeliner redis.Pipeliner) *RedisPipeline {
+	pip := &RedisPipeline{
+		keyPrefix: client.Config.KeyPrefix,
+
+		OnExpireError: client.OnExpireError,
+		tracker:       &pipelineTracker{},
+		redact:        client.Config.redactParams(),
 	}
+	pip.Client = trackedPipeliner{Pipeliner: pipeliner, pip: pip}
 	pip.builder = pip.Handler
 	pip.lua = pip.ExecScript
-	return &pip
+	return pip
+}
+
+// trackedPipeliner 包装 go-redis 的 pipeline, 直接调用 pip.Client.Exec 和 RedisPipeline.Exec 的效果一样
+type trackedPipeliner struct {
+	redis.Pipeliner
+	pip *RedisPipeline
+}
+
+func (p trackedPipeliner) Exec(ctx context.Context) ([]redis.Cmder, error) {
+	cmds, err := p.Pipeliner.Exec(ctx)
+	if expireErr := p.pip.tracker.done(ctx, p.pip.OnExpireError); expireErr != nil && err == nil {
+		err = expireErr
+	}
+	return cmds, ClassifyError(err)
+}
+
+// Discard 丢弃的命令不会再有结果, 同时不再跟踪对应的 CommandBuilder
+func (p trackedPipeliner) Discard() {
+	p.Pipeliner.Discard()
+	p.pip.tracker.reset()
 }
 
 func (pip RedisPipeline) Handler(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) *CommandBuilder {
 	// 返回 CommandBuilder，支持链式调用
 	// Pipeline 中的命令会在 Exec() 时执行
-	return NewPipelineCommandBuilder(pip.Client, ctx, cmd, cmdName, args, includeArgs...)
+	ctx = withDefaultKeyPrefix(ctx, pip.keyPrefix)
+	cb := NewPipelineCommandBuilder(pip.Client, ctx, cmd, cmdName, args, includeArgs...)
+	cb.tracker = pip.tracker
+	cb.redact = pip.redact
+	return cb
 }
 
 // 这一步才是真正的执行命令， 之前的所有步骤都是在往数组中添加命令， 实际没有发送到redis中
+// 执行之后会检查子命令的过期时间是否设置成功, 开启 ExpireStrict 的失败会设置到对应的命令上并作为 Exec 的错误返回
+// 同时把回复转换到 CommandBuilder 在 Exec 之前返回的 Int()/StringSlice() 等结果上; 直接调用 pip.Client.Exec 也是一样
 func (pip RedisPipeline) Exec(ctx context.Context) ([]redis.Cmder, error) {
 	return pip.Client.Exec(ctx)
 }
+
+// pipelineTracker 记录 pipeline 中已经加入的 CommandBuilder, Exec 之后统一处理结果
+type pipelineTracker struct {
+	mu       sync.Mutex
+	builders []*CommandBuilder
+	batch    bool // RedisClient.Batch 使用, 和单独执行一样按 ReturnNilError 忽略 redis.Nil
+}
+
+func (t *pipelineTracker) reset() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.builders = nil
+	t.mu.Unlock()
+}
+
+func (t *pipelineTracker) add(cb *CommandBuilder) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.builders = append(t.builders, cb)
+	t.mu.Unlock()
+}
+
+// done Exec 之后先检查过期命令, strict 的失败会设置到主命令上, 再把回复转换到各个类型的结果上
+// 返回第一个 strict 的过期错误
+func (t *pipelineTracker) done(ctx context.Context, hook ExpireErrorHook) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	builders := t.builders
+	t.builders = nil
+	t.mu.Unlock()
+	var first error
+	for _, cb := range builders {
+		if cb.expire != nil {
+			if err := cb.expire.failed(ctx, hook); err != nil {
+				cb.cmder.SetErr(err)
+				if first == nil {
+					first = err
+				}
+			}
+		}
+		if t.batch && !cb.returnNil && errors.Is(cb.cmder.Err(), redis.Nil) {
+			cb.cmder.SetErr(nil)
+		}
+		cb.cmder.SetErr(ClassifyError(cb.cmder.Err()))
+		cb.finish()
+	}
+	return first
+}
@@ -0,0 +1,295 @@
+package rdbtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Interaction 一条命令和它的回复, Args 是 Build 之后实际发送的参数
+type Interaction struct {
+	Args  []string
+	Reply any    // 和 *redis.Cmd.Val() 的格式一致: nil、int64、string、float64、bool、[]any、map[any]any
+	Err   string // 错误信息, 为空表示成功
+	// ErrKind 错误的种类: "nil" 为 redis.Nil, "redis" 为 redis 的错误回复, 为空的是连接、超时这类错误
+	ErrKind string
+}
+
+func (in Interaction) String() string {
+	return strings.Join(in.Args, " ")
+}
+
+// Cassette 录制的命令序列, 用 JSON 文件保存
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// LoadCassette 读取 Save 保存的文件
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("rdbtest: load cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// interactionJSON 文件中的格式, 字符串、整数、数组直接保存, 其他类型带上标记以便还原
+type interactionJSON struct {
+	Args    []string `json:"args"`
+	Reply   any      `json:"reply,omitempty"`
+	Err     string   `json:"err,omitempty"`
+	ErrKind string   `json:"errKind,omitempty"`
+}
+
+func (in Interaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(interactionJSON{Args: in.Args, Reply: encodeValue(in.Reply), Err: in.Err, ErrKind: in.ErrKind})
+}
+
+func (in *Interaction) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Args    []string        `json:"args"`
+		Reply   json.RawMessage `json:"reply"`
+		Err     string          `json:"err"`
+		ErrKind string          `json:"errKind"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*in = Interaction{Args: raw.Args, Err: raw.Err, ErrKind: raw.ErrKind}
+	if len(raw.Reply) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(strings.NewReader(string(raw.Reply)))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	var err error
+	in.Reply, err = decodeValue(v)
+	return err
+}
+
+// encodeValue float64 保存为 {"float": "1.5"}, bool 为 {"bool": true}, map 为 {"map": [[k, v], ...]}
+func encodeValue(v any) any {
+	switch v := v.(type) {
+	case nil, string, int64:
+		return v
+	case float64:
+		return map[string]any{"float": formatFloat(v)}
+	case bool:
+		return map[string]any{"bool": v}
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = encodeValue(e)
+		}
+		return out
+	case map[any]any:
+		pairs := make([][2]any, 0, len(v))
+		for k, e := range v {
+			pairs = append(pairs, [2]any{encodeValue(k), encodeValue(e)})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return fmt.Sprint(pairs[i][0]) < fmt.Sprint(pairs[j][0]) })
+		return map[string]any{"map": pairs}
+	}
+	return fmt.Sprint(v)
+}
+
+func decodeValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, string:
+		return v, nil
+	case json.Number:
+		return v.Int64()
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			var err error
+			if out[i], err = decodeValue(e); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]any:
+		if f, ok := v["float"].(string); ok {
+			return parseFloatReply(f)
+		}
+		if b, ok := v["bool"].(bool); ok {
+			return b, nil
+		}
+		if pairs, ok := v["map"].([]any); ok {
+			m := make(map[any]any, len(pairs))
+			for _, p := range pairs {
+				pair, ok := p.([]any)
+				if !ok || len(pair) != 2 {
+					return nil, errors.New("rdbtest: malformed map entry in cassette")
+				}
+				k, err := decodeValue(pair[0])
+				if err != nil {
+					return nil, err
+				}
+				if m[k], err = decodeValue(pair[1]); err != nil {
+					return nil, err
+				}
+			}
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("rdbtest: unsupported value %v in cassette", v)
+}
+
+func parseFloatReply(v string) (float64, error) {
+	switch v {
+	case "inf":
+		v = "+Inf"
+	case "-inf":
+		v = "-Inf"
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// Recorder 作为 go-redis 的 hook 记录经过 client 的命令、回复和错误
+// 需要在 Fake 这类不会调用下一个 hook 的 hook 之前添加, 录制真实的 redis 或者 Server 的时候没有这个限制
+type Recorder struct {
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// Record 在 c 上添加 Recorder, 例如 rdbtest.Record(client.Client)
+func Record(c *redis.Client) *Recorder {
+	r := &Recorder{}
+	c.AddHook(r)
+	return r
+}
+
+// Cassette 到目前为止录制的内容
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+func (r *Recorder) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (r *Recorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		// go-redis 在所有 hook 返回之后才调用 cmd.SetErr, 所以这里使用 next 返回的错误
+		err := next(ctx, cmd)
+		r.record(cmd, err)
+		return err
+	}
+}
+
+func (r *Recorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			r.record(cmd, cmd.Err())
+		}
+		return err
+	}
+}
+
+func (r *Recorder) record(cmd redis.Cmder, err error) {
+	switch strings.ToUpper(cmd.Name()) {
+	case "MULTI", "EXEC":
+		return
+	}
+	in := Interaction{Args: cmdArgs(cmd)}
+	in.Args[0] = strings.ToUpper(in.Args[0])
+	if err != nil {
+		in.Err = err.Error()
+		var redisErr redis.Error
+		switch {
+		case errors.Is(err, redis.Nil):
+			in.ErrKind = "nil"
+		case errors.As(err, &redisErr):
+			in.ErrKind = "redis"
+		}
+	} else {
+		in.Reply = rawReply(cmd)
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	r.mu.Unlock()
+}
+
+// rawReply 把各种类型的 cmder 的结果还原成 *redis.Cmd 的格式, 回放的时候用 rdb.FillReply 转换回去
+func rawReply(cmd redis.Cmder) any {
+	switch cmd := cmd.(type) {
+	case *redis.Cmd:
+		return cmd.Val()
+	case *redis.StringCmd:
+		return cmd.Val()
+	case *redis.StatusCmd:
+		return cmd.Val()
+	case *redis.IntCmd:
+		return cmd.Val()
+	case *redis.FloatCmd:
+		return cmd.Val()
+	case *redis.BoolCmd:
+		if cmd.Val() {
+			return int64(1)
+		}
+		return int64(0)
+	case *redis.SliceCmd:
+		return cmd.Val()
+	case *redis.StringSliceCmd:
+		return strSlice(cmd.Val())
+	case *redis.IntSliceCmd:
+		out := make([]any, len(cmd.Val()))
+		for i, v := range cmd.Val() {
+			out[i] = v
+		}
+		return out
+	case *redis.BoolSliceCmd:
+		out := make([]any, len(cmd.Val()))
+		for i, v := range cmd.Val() {
+			out[i] = int64(0)
+			if v {
+				out[i] = int64(1)
+			}
+		}
+		return out
+	case *redis.MapStringStringCmd:
+		m := make(map[any]any, len(cmd.Val()))
+		for k, v := range cmd.Val() {
+			m[k] = v
+		}
+		return m
+	case *redis.ZSliceCmd:
+		out := make([]any, len(cmd.Val()))
+		for i, z := range cmd.Val() {
+			out[i] = []any{fmt.Sprint(z.Member), z.Score}
+		}
+		return out
+	}
+	return fmt.Sprint(cmd)
+}
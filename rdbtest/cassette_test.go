@@ -0,0 +1,118 @@
+package rdbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/preceeder/rdb"
+)
+
+// scenario 被录制和回放的业务代码, 返回所有结果的摘要用来比较
+func scenario(client *rdb.RedisClient, name string) string {
+	ctx := context.Background()
+	var out []string
+	add := func(v any, err error) { out = append(out, fmt.Sprintf("%v|%v", v, err)) }
+
+	set := client.HSet(ctx, user, map[string]any{"id": 1, "field": "name", "value": name})
+	add(set.Int().Result())
+	add(client.HGetAll(ctx, user, map[string]any{"id": 1}).MapStringString().Result())
+	add(client.HGet(ctx, user, map[string]any{"id": 2, "field": "name"}).String().Result())
+
+	pip := client.PipeLine()
+	zadd := pip.ZAdd(ctx, rank, map[string]any{"score": 1.5, "member": name}).Int()
+	zs := pip.ZRange(ctx, rank, nil).ZSlice()
+	_, err := pip.Exec(ctx)
+	add(zadd.Val(), err)
+	add(zs.Result())
+
+	lua := rdb.LuaScript{Script: "return redis.call('ZSCORE', KEYS[1], ARGV[1])", Keys: []string{"k"}, Args: []string{"m"}}
+	add(client.ExecScript(ctx, lua, map[string]string{"k": "rank"}, map[string]any{"m": name}).Result())
+	add(client.HIncrBy(ctx, counter, map[string]any{"field": "x", "by": 1}).Int().Result())
+	return strings.Join(out, "\n")
+}
+
+// counter 和 rank 使用同一个 key, 用来得到 WRONGTYPE 错误
+var counter = rdb.RdCmd{Key: "rank", CMD: map[rdb.Command]rdb.RdSubCmd{rdb.HINCRBY: {Params: "{{field}} {{by}}"}}}
+
+func TestCassette_RecordReplay(t *testing.T) {
+	srv := NewServer(ServerOptions{})
+	defer srv.Close()
+	client := rdb.NewRedisClient(srv.Config())
+	defer client.RedisClose()
+	rec := Record(client.Client)
+	recorded := scenario(client, "tom")
+	if !strings.Contains(recorded, "WRONGTYPE") || !strings.Contains(recorded, "redis: nil") {
+		t.Fatalf("scenario should cover error replies, got\n%s", recorded)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := rec.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayClient, replayer := Replay(cassette, rdb.Config{}, ReplayOptions{})
+	if replayed := scenario(replayClient, "tom"); replayed != recorded {
+		t.Errorf("replay differs from recording\nrecorded:\n%s\nreplayed:\n%s", recorded, replayed)
+	}
+	if err := replayer.Err(); err != nil {
+		t.Error(err)
+	}
+
+	// 参数不同的时候给出两边的命令和不同的参数
+	replayClient, replayer = Replay(cassette, rdb.Config{}, ReplayOptions{})
+	scenario(replayClient, "jerry")
+	var mismatch *MismatchError
+	if err := replayer.Err(); !errors.As(err, &mismatch) {
+		t.Fatalf("expected MismatchError, got %v", err)
+	}
+	msg := mismatch.Error()
+	for _, want := range []string{"command #1", `- HSET user:1 name tom`, `+ HSET user:1 name jerry`, `arg[3]: want "tom", got "jerry"`} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("mismatch message should contain %q, got\n%s", want, msg)
+		}
+	}
+}
+
+func TestReplayer_Match(t *testing.T) {
+	cassette := &Cassette{Interactions: []Interaction{
+		{Args: []string{"SET", "a", "1"}, Reply: "OK"},
+		{Args: []string{"SET", "b", "2"}, Reply: "OK"},
+		{Args: []string{"EXPIREAT", "a", "1700000000"}, Reply: int64(1)},
+	}}
+	run := func(opts ReplayOptions) error {
+		client, replayer := Replay(cassette, rdb.Config{}, opts)
+		ctx := context.Background()
+		client.Client.Set(ctx, "b", "2", 0)
+		client.Client.Set(ctx, "a", "1", 0)
+		client.Client.Do(ctx, "EXPIREAT", "a", 1800000000)
+		return replayer.Err()
+	}
+
+	if err := run(ReplayOptions{}); err == nil {
+		t.Error("strict order should fail on reordered keys")
+	}
+	if err := run(ReplayOptions{Match: MatchPerKey}); err == nil || !strings.Contains(err.Error(), `arg[2]: want "1700000000", got "1800000000"`) {
+		t.Errorf("timestamp should not match without options, got %v", err)
+	}
+	if err := run(ReplayOptions{Match: MatchPerKey, Volatile: regexp.MustCompile(`^\d{10,13}$`)}); err != nil {
+		t.Error(err)
+	}
+	if err := run(ReplayOptions{Match: MatchPerKey, IgnoreArgs: map[string][]int{"EXPIREAT": {2}}}); err != nil {
+		t.Error(err)
+	}
+
+	client, replayer := Replay(cassette, rdb.Config{}, ReplayOptions{})
+	client.Client.Set(context.Background(), "a", "1", 0)
+	if err := replayer.Err(); !errors.Is(err, ErrUnusedInteractions) {
+		t.Errorf("expected ErrUnusedInteractions, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package rdbtest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 可控的时钟, 只有调用 Advance/Set 的时候才会走动, 用来测试过期时间
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock 从 start 开始的时钟, start 为零值的时候从当前时间开始
+func NewClock(start time.Time) *Clock {
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return &Clock{now: start}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance 时钟向前走 d, 到期的 key 在下一次访问的时候删除
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
@@ -0,0 +1,182 @@
+package rdbtest
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/preceeder/rdb"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNoDial Fake 不会建立连接, 绕过 hook 直接拨号的时候返回这个错误
+var ErrNoDial = errors.New("rdbtest: fake backend does not dial")
+
+// Fake 把 Store 作为 go-redis 的 hook 接入, 命令不会发送到网络, 直接在内存中执行
+// 回复的结构和 RESP3 一致, 例如 HGETALL 为 map, ZRANGE WITHSCORES 为嵌套数组
+type Fake struct {
+	*Store
+}
+
+// NewFake clock 为 nil 的时候使用从当前时间开始的 Clock
+func NewFake(clock *Clock) *Fake {
+	return &Fake{Store: NewStore(clock)}
+}
+
+// NewClient 返回在内存中执行的 RedisClient, builder 的所有方法、PipeLine、TxPipeLine 和 ExecScript 都可以使用
+// 通过返回的 Fake 预置数据、检查结果或者用 Fake.Clock().Advance 让 key 过期
+func NewClient(config rdb.Config) (*rdb.RedisClient, *Fake) {
+	fake := NewFake(nil)
+	return fake.Client(config), fake
+}
+
+// Client 创建接入这个 Fake 的 RedisClient, 多个 client 共享同一份数据
+func (f *Fake) Client(config rdb.Config) *rdb.RedisClient {
+	c := redis.NewClient(&redis.Options{Addr: "rdbtest.invalid:6379", DB: config.Db, Protocol: 3})
+	c.AddHook(f)
+	return rdb.NewRedisClientWith(c, config)
+}
+
+func (f *Fake) DialHook(redis.DialHook) redis.DialHook {
+	return func(context.Context, string, string) (net.Conn, error) {
+		return nil, ErrNoDial
+	}
+}
+
+func (f *Fake) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		fillCmd(cmd, f.Do(cmdArgs(cmd)...))
+		return cmd.Err()
+	}
+}
+
+// ProcessPipelineHook pipeline 和事务中的命令原子执行, MULTI/EXEC 本身不执行; 返回第一个失败的命令的错误
+func (f *Fake) ProcessPipelineHook(redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(_ context.Context, cmds []redis.Cmder) error {
+		var queued []redis.Cmder
+		var args [][]string
+		for _, cmd := range cmds {
+			switch strings.ToUpper(cmd.Name()) {
+			case "MULTI", "EXEC":
+				continue
+			}
+			queued = append(queued, cmd)
+			args = append(args, cmdArgs(cmd))
+		}
+		var first error
+		for i, reply := range f.DoMulti(args) {
+			fillCmd(queued[i], reply)
+			if err := queued[i].Err(); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+}
+
+func cmdArgs(cmd redis.Cmder) []string {
+	args := make([]string, len(cmd.Args()))
+	for i, arg := range cmd.Args() {
+		args[i] = FormatArg(arg)
+	}
+	return args
+}
+
+// FormatArg 和 go-redis 写入参数的规则一致, 把命令参数转换成字符串
+func FormatArg(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return strconv.FormatInt(v.Nanoseconds(), 10)
+	case encoding.BinaryMarshaler:
+		if b, err := v.MarshalBinary(); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// fillCmd 把 Store 的回复设置到 cmd 上, 空回复和 go-redis 一样是 redis.Nil
+func fillCmd(cmd redis.Cmder, reply any) {
+	switch reply := reply.(type) {
+	case nil:
+		cmd.SetErr(redis.Nil)
+		return
+	case Error:
+		cmd.SetErr(reply)
+		return
+	}
+	if err := rdb.FillReply(cmd, goReply(reply)); err != nil {
+		cmd.SetErr(err)
+	}
+}
+
+// goReply 转换成 *redis.Cmd 在 RESP3 下的值
+func goReply(reply any) any {
+	switch v := reply.(type) {
+	case Status:
+		return string(v)
+	case Error:
+		return v
+	case Map:
+		m := make(map[any]any, len(v)/2)
+		for i := 0; i+1 < len(v); i += 2 {
+			m[goReply(v[i])] = goReply(v[i+1])
+		}
+		return m
+	case Pairs:
+		out := make([]any, 0, len(v)/2)
+		for i := 0; i+1 < len(v); i += 2 {
+			out = append(out, []any{goReply(v[i]), goReply(v[i+1])})
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = goReply(e)
+		}
+		return out
+	}
+	return reply
+}
@@ -0,0 +1,118 @@
+package rdbtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/preceeder/rdb"
+	"github.com/redis/go-redis/v9"
+)
+
+var user = rdb.RdCmd{Key: "user:{{id}}", CMD: map[rdb.Command]rdb.RdSubCmd{
+	rdb.HSET:    {Params: "{{field}} {{value}}", Exp: func() time.Duration { return time.Minute }, AtomicExpire: true},
+	rdb.HGET:    {Params: "{{field}}", ReturnNilError: true},
+	rdb.HGETALL: {},
+	rdb.HINCRBY: {Params: "{{field}} {{by}}"},
+}}
+
+var rank = rdb.RdCmd{Key: "rank", CMD: map[rdb.Command]rdb.RdSubCmd{
+	rdb.ZADD:   {Params: "{{score}} {{member}}"},
+	rdb.ZRANGE: {Params: "0 -1 WITHSCORES"},
+	rdb.ZSCORE: {Params: "{{member}}"},
+}}
+
+func TestFake_Builder(t *testing.T) {
+	client, fake := NewClient(rdb.Config{KeyPrefix: "app:"})
+	ctx := context.Background()
+	args := map[string]any{"id": 1, "field": "name", "value": "tom"}
+
+	if n := client.HSet(ctx, user, args).Int().Val(); n != 1 {
+		t.Errorf("unexpected HSET reply %d", n)
+	}
+	if v := client.HGet(ctx, user, args).String().Val(); v != "tom" {
+		t.Errorf("unexpected HGET reply %q", v)
+	}
+	if err := client.HGet(ctx, user, map[string]any{"id": 2, "field": "name"}).Err(); !errors.Is(err, redis.Nil) {
+		t.Errorf("expected redis.Nil, got %v", err)
+	}
+	if err := client.HIncrBy(ctx, user, map[string]any{"id": 1, "field": "age", "by": 3}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	all := client.HGetAll(ctx, user, args).MapStringString().Val()
+	if all["name"] != "tom" || all["age"] != "3" {
+		t.Errorf("unexpected HGETALL reply %v", all)
+	}
+
+	for _, z := range []map[string]any{{"score": 2, "member": "b"}, {"score": 1.5, "member": "a"}} {
+		if err := client.ZAdd(ctx, rank, z).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zs := client.ZRange(ctx, rank, nil).ZSlice().Val()
+	if len(zs) != 2 || zs[0].Member != "a" || zs[0].Score != 1.5 {
+		t.Errorf("unexpected ZRANGE reply %v", zs)
+	}
+	if v := client.ZScore(ctx, rank, map[string]any{"member": "b"}).Float().Val(); v != 2 {
+		t.Errorf("unexpected ZSCORE reply %v", v)
+	}
+
+	// 过期时间和命令在同一个事务中设置, 时钟走过之后 key 被删除
+	if ttl := fake.Do("TTL", "app:user:1"); ttl != int64(60) {
+		t.Errorf("unexpected TTL %v", ttl)
+	}
+	fake.Clock().Advance(time.Minute)
+	if err := client.HGet(ctx, user, args).Err(); !errors.Is(err, redis.Nil) {
+		t.Errorf("key should be expired, got %v", err)
+	}
+}
+
+func TestFake_Pipeline(t *testing.T) {
+	client, fake := NewClient(rdb.Config{})
+	ctx := context.Background()
+	pip := client.PipeLine()
+	set := pip.HSet(ctx, user, map[string]any{"id": 1, "field": "name", "value": "tom"})
+	added := set.Int()
+	name := pip.HGet(ctx, user, map[string]any{"id": 1, "field": "name"}).String()
+	zadd := pip.ZAdd(ctx, rank, map[string]any{"score": "x", "member": "a"}).Int()
+	if _, err := pip.Exec(ctx); err == nil {
+		t.Error("expected error from invalid score")
+	}
+	// pipeline 中的 AtomicExpire 使用 rdb.ExpireWrapScript 包装
+	if added.Val() != 1 || !set.ExpireApplied() {
+		t.Errorf("unexpected HSET result %v, expire applied %v", added.Val(), set.ExpireApplied())
+	}
+	if name.Val() != "tom" {
+		t.Errorf("unexpected HGET result %q", name.Val())
+	}
+	if zadd.Err() == nil {
+		t.Error("ZADD with invalid score should fail")
+	}
+	if ttl := fake.Do("TTL", "user:1"); ttl != int64(60) {
+		t.Errorf("unexpected TTL %v", ttl)
+	}
+
+	tx := client.TxPipeLine()
+	incr := tx.HIncrBy(ctx, user, map[string]any{"id": 1, "field": "n", "by": 2}).Int()
+	if _, err := tx.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if incr.Val() != 2 {
+		t.Errorf("unexpected HINCRBY result %d", incr.Val())
+	}
+}
+
+func TestFake_ExecScript(t *testing.T) {
+	client, fake := NewClient(rdb.Config{})
+	ctx := context.Background()
+	lua := rdb.LuaScript{Script: "return redis.call('INCRBY', KEYS[1], ARGV[1])", Keys: []string{"counter"}, Args: []string{"by"}}
+	for i := 0; i < 2; i++ {
+		if err := client.ExecScript(ctx, lua, map[string]string{"counter": "counter:1"}, map[string]any{"by": 5}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v := fake.Do("GET", "counter:1"); v != "10" {
+		t.Errorf("unexpected counter %v", v)
+	}
+}
@@ -0,0 +1,242 @@
+package rdbtest
+
+import (
+	"math"
+	"sort"
+)
+
+func init() {
+	register("HSET", 3, hsetCmd(false))
+	register("HMSET", 3, hsetCmd(true))
+	register("HSETNX", 3, cmdHSetNx)
+	register("HGET", 2, cmdHGet)
+	register("HMGET", 2, cmdHMGet)
+	register("HDEL", 2, cmdHDel)
+	register("HEXISTS", 2, cmdHExists)
+	register("HLEN", 1, cmdHLen)
+	register("HSTRLEN", 2, cmdHStrlen)
+	register("HGETALL", 1, cmdHGetAll)
+	register("HKEYS", 1, hashFields(true))
+	register("HVALS", 1, hashFields(false))
+	register("HINCRBY", 3, cmdHIncrBy)
+	register("HINCRBYFLOAT", 3, cmdHIncrByFloat)
+}
+
+func getHash(s *Store, key string) (map[string]string, error) {
+	h, _, err := lookupAs[map[string]string](s, key)
+	return h, err
+}
+
+// writableHash key 不存在的时候返回新的 map, 修改之后需要 put
+func writableHash(s *Store, key string) (map[string]string, error) {
+	h, err := getHash(s, key)
+	if h == nil && err == nil {
+		h = map[string]string{}
+	}
+	return h, err
+}
+
+// sortedFields hash 的字段排序之后返回, 保证回复的顺序稳定
+func sortedFields(h map[string]string) []string {
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// hsetCmd HSET 返回新增的字段数, HMSET 返回 OK
+func hsetCmd(status bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		if len(args)%2 != 1 {
+			if status {
+				return errArgs("HMSET")
+			}
+			return errArgs("HSET")
+		}
+		h, err := writableHash(s, args[0])
+		if err != nil {
+			return err
+		}
+		var added int64
+		for i := 1; i < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				added++
+			}
+			h[args[i]] = args[i+1]
+		}
+		s.put(args[0], h)
+		if status {
+			return Status("OK")
+		}
+		return added
+	}
+}
+
+func cmdHSetNx(s *Store, args []string) any {
+	h, err := writableHash(s, args[0])
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[1]]; ok {
+		return int64(0)
+	}
+	h[args[1]] = args[2]
+	s.put(args[0], h)
+	return int64(1)
+}
+
+func cmdHGet(s *Store, args []string) any {
+	h, err := getHash(s, args[0])
+	if err != nil {
+		return err
+	}
+	if v, ok := h[args[1]]; ok {
+		return v
+	}
+	return nil
+}
+
+func cmdHMGet(s *Store, args []string) any {
+	h, err := getHash(s, args[0])
+	if err != nil {
+		return err
+	}
+	out := make([]any, len(args)-1)
+	for i, f := range args[1:] {
+		if v, ok := h[f]; ok {
+			out[i] = v
+		}
+	}
+	return out
+}
+
+func cmdHDel(s *Store, args []string) any {
+	h, err := getHash(s, args[0])
+	if err != nil || h == nil {
+		return orZero(err)
+	}
+	var n int64
+	for _, f := range args[1:] {
+		if _, ok := h[f]; ok {
+			delete(h, f)
+			n++
+		}
+	}
+	s.put(args[0], h)
+	return n
+}
+
+func cmdHExists(s *Store, args []string) any {
+	h, err := getHash(s, args[0])
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[1]]; ok {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func cmdHLen(s *Store, args []string) any {
+	h, err := getHash(s, args[0])
+	if err != nil {
+		return err
+	}
+	return int64(len(h))
+}
+
+func cmdHStrlen(s *Store, args []string) any {
+	h, err := getHash(s, args[0])
+	if err != nil {
+		return err
+	}
+	return int64(len(h[args[1]]))
+}
+
+func cmdHGetAll(s *Store, args []string) any {
+	h, err := getHash(s, args[0])
+	if err != nil {
+		return err
+	}
+	out := make(Map, 0, 2*len(h))
+	for _, f := range sortedFields(h) {
+		out = append(out, f, h[f])
+	}
+	return out
+}
+
+func hashFields(keys bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		h, err := getHash(s, args[0])
+		if err != nil {
+			return err
+		}
+		out := make([]any, 0, len(h))
+		for _, f := range sortedFields(h) {
+			if keys {
+				out = append(out, f)
+			} else {
+				out = append(out, h[f])
+			}
+		}
+		return out
+	}
+}
+
+func cmdHIncrBy(s *Store, args []string) any {
+	by, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	h, err := writableHash(s, args[0])
+	if err != nil {
+		return err
+	}
+	var n int64
+	if v, ok := h[args[1]]; ok {
+		if n, err = parseInt(v); err != nil {
+			return Error("ERR hash value is not an integer")
+		}
+	}
+	if by > 0 && n > math.MaxInt64-by || by < 0 && n < math.MinInt64-by {
+		return errOverflow
+	}
+	n += by
+	h[args[1]] = formatInt(n)
+	s.put(args[0], h)
+	return n
+}
+
+func cmdHIncrByFloat(s *Store, args []string) any {
+	by, err := parseFloat(args[2])
+	if err != nil {
+		return err
+	}
+	h, err := writableHash(s, args[0])
+	if err != nil {
+		return err
+	}
+	var f float64
+	if v, ok := h[args[1]]; ok {
+		if f, err = parseFloat(v); err != nil {
+			return Error("ERR hash value is not a float")
+		}
+	}
+	f += by
+	if math.IsInf(f, 0) {
+		return Error("ERR increment would produce NaN or Infinity")
+	}
+	h[args[1]] = formatFloat(f)
+	s.put(args[0], h)
+	return h[args[1]]
+}
+
+// orZero 类型错误返回错误, key 不存在返回 0
+func orZero(err error) any {
+	if err != nil {
+		return err
+	}
+	return int64(0)
+}
@@ -0,0 +1,163 @@
+package rdbtest
+
+import (
+	"strings"
+	"time"
+)
+
+func init() {
+	register("PING", 0, cmdPing)
+	register("ECHO", 1, func(s *Store, args []string) any { return args[0] })
+	register("SELECT", 1, func(s *Store, args []string) any { return Status("OK") })
+	register("DBSIZE", 0, func(s *Store, args []string) any { return int64(len(s.keys("*"))) })
+	register("FLUSHDB", 0, cmdFlush)
+	register("FLUSHALL", 0, cmdFlush)
+	register("DEL", 1, cmdDel)
+	register("UNLINK", 1, cmdDel)
+	register("EXISTS", 1, cmdExists)
+	register("TYPE", 1, cmdType)
+	register("KEYS", 1, func(s *Store, args []string) any { return strSlice(s.keys(args[0])) })
+	register("RENAME", 2, cmdRename)
+	register("EXPIRE", 2, expireCmd(time.Second, false))
+	register("PEXPIRE", 2, expireCmd(time.Millisecond, false))
+	register("EXPIREAT", 2, expireCmd(time.Second, true))
+	register("PEXPIREAT", 2, expireCmd(time.Millisecond, true))
+	register("TTL", 1, ttlCmd(time.Second))
+	register("PTTL", 1, ttlCmd(time.Millisecond))
+	register("PERSIST", 1, cmdPersist)
+}
+
+func cmdPing(s *Store, args []string) any {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return Status("PONG")
+}
+
+func cmdFlush(s *Store, args []string) any {
+	s.data = map[string]*entry{}
+	return Status("OK")
+}
+
+func cmdDel(s *Store, args []string) any {
+	var n int64
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			delete(s.data, key)
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(s *Store, args []string) any {
+	var n int64
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdType(s *Store, args []string) any {
+	e := s.lookup(args[0])
+	if e == nil {
+		return Status("none")
+	}
+	return Status(typeName(e.value))
+}
+
+func cmdRename(s *Store, args []string) any {
+	e := s.lookup(args[0])
+	if e == nil {
+		return errNoKey
+	}
+	delete(s.data, args[0])
+	s.data[args[1]] = e
+	return Status("OK")
+}
+
+// expireCmd EXPIRE/PEXPIRE/EXPIREAT/PEXPIREAT, 支持 NX/XX/GT/LT; 过期时间已经过去的时候直接删除 key
+func expireCmd(unit time.Duration, at bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		n, err := parseInt(args[1])
+		if err != nil {
+			return err
+		}
+		var nx, xx, gt, lt bool
+		for _, opt := range args[2:] {
+			switch strings.ToUpper(opt) {
+			case "NX":
+				nx = true
+			case "XX":
+				xx = true
+			case "GT":
+				gt = true
+			case "LT":
+				lt = true
+			default:
+				return Error("ERR Unsupported option " + opt)
+			}
+		}
+		if nx && (xx || gt || lt) || gt && lt {
+			return Error("ERR NX and XX, GT or LT options at the same time are not compatible")
+		}
+		e := s.lookup(args[0])
+		if e == nil {
+			return int64(0)
+		}
+		var when time.Time
+		if at {
+			when = time.Unix(0, 0).Add(time.Duration(n) * unit)
+		} else {
+			when = s.clock.Now().Add(time.Duration(n) * unit)
+		}
+		// 没有过期时间的 key 看作永不过期, GT 不会设置, LT 总是设置
+		switch {
+		case nx && !e.expireAt.IsZero(),
+			xx && e.expireAt.IsZero(),
+			gt && (e.expireAt.IsZero() || !when.After(e.expireAt)),
+			lt && !e.expireAt.IsZero() && !when.Before(e.expireAt):
+			return int64(0)
+		}
+		if !when.After(s.clock.Now()) {
+			delete(s.data, args[0])
+			return int64(1)
+		}
+		e.expireAt = when
+		return int64(1)
+	}
+}
+
+// ttlCmd TTL/PTTL, key 不存在返回 -2, 没有过期时间返回 -1
+func ttlCmd(unit time.Duration) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		e := s.lookup(args[0])
+		switch {
+		case e == nil:
+			return int64(-2)
+		case e.expireAt.IsZero():
+			return int64(-1)
+		}
+		left := e.expireAt.Sub(s.clock.Now())
+		return int64((left + unit/2) / unit)
+	}
+}
+
+func cmdPersist(s *Store, args []string) any {
+	e := s.lookup(args[0])
+	if e == nil || e.expireAt.IsZero() {
+		return int64(0)
+	}
+	e.expireAt = time.Time{}
+	return int64(1)
+}
+
+func strSlice(vals []string) []any {
+	out := make([]any, len(vals))
+	for i, v := range vals {
+		out[i] = v
+	}
+	return out
+}
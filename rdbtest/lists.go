@@ -0,0 +1,262 @@
+package rdbtest
+
+import (
+	"slices"
+	"strings"
+)
+
+func init() {
+	register("LPUSH", 2, pushCmd(true, false))
+	register("RPUSH", 2, pushCmd(false, false))
+	register("LPUSHX", 2, pushCmd(true, true))
+	register("RPUSHX", 2, pushCmd(false, true))
+	register("LPOP", 1, popCmd(true))
+	register("RPOP", 1, popCmd(false))
+	register("LLEN", 1, cmdLLen)
+	register("LRANGE", 3, cmdLRange)
+	register("LINDEX", 2, cmdLIndex)
+	register("LSET", 3, cmdLSet)
+	register("LREM", 3, cmdLRem)
+	register("LTRIM", 3, cmdLTrim)
+	register("LINSERT", 4, cmdLInsert)
+	register("RPOPLPUSH", 2, func(s *Store, args []string) any {
+		return cmdLMove(s, []string{args[0], args[1], "RIGHT", "LEFT"})
+	})
+	register("LMOVE", 4, cmdLMove)
+}
+
+func getList(s *Store, key string) ([]string, error) {
+	l, _, err := lookupAs[[]string](s, key)
+	return l, err
+}
+
+// pushCmd LPUSH/RPUSH, onlyExists 为 true 的是 LPUSHX/RPUSHX, key 不存在的时候不创建
+func pushCmd(left, onlyExists bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		l, err := getList(s, args[0])
+		if err != nil {
+			return err
+		}
+		if onlyExists && l == nil {
+			return int64(0)
+		}
+		for _, v := range args[1:] {
+			if left {
+				l = slices.Insert(l, 0, v)
+			} else {
+				l = append(l, v)
+			}
+		}
+		s.put(args[0], l)
+		return int64(len(l))
+	}
+}
+
+// popCmd LPOP/RPOP key [count], 带 count 的时候返回数组
+func popCmd(left bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		count, withCount := int64(1), len(args) > 1
+		if withCount {
+			var err error
+			if count, err = parseInt(args[1]); err != nil || count < 0 {
+				return Error("ERR value is out of range, must be positive")
+			}
+		}
+		l, err := getList(s, args[0])
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			return nil
+		}
+		n := min(int(count), len(l))
+		var popped []string
+		if left {
+			popped, l = l[:n], l[n:]
+		} else {
+			popped = slices.Clone(l[len(l)-n:])
+			slices.Reverse(popped)
+			l = l[:len(l)-n]
+		}
+		out := strSlice(popped)
+		s.put(args[0], slices.Clone(l))
+		if !withCount {
+			return out[0]
+		}
+		return out
+	}
+}
+
+func cmdLLen(s *Store, args []string) any {
+	l, err := getList(s, args[0])
+	if err != nil {
+		return err
+	}
+	return int64(len(l))
+}
+
+func cmdLRange(s *Store, args []string) any {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	l, err := getList(s, args[0])
+	if err != nil {
+		return err
+	}
+	i, j, ok := normRange(start, stop, len(l))
+	if !ok {
+		return []any{}
+	}
+	return strSlice(l[i : j+1])
+}
+
+// listIndex 把可以为负数的下标转换成正数, 越界的时候 ok=false
+func listIndex(arg string, n int) (int, bool, error) {
+	i, err := parseInt(arg)
+	if err != nil {
+		return 0, false, err
+	}
+	if i < 0 {
+		i += int64(n)
+	}
+	return int(i), i >= 0 && i < int64(n), nil
+}
+
+func cmdLIndex(s *Store, args []string) any {
+	l, err := getList(s, args[0])
+	if err != nil {
+		return err
+	}
+	i, ok, err := listIndex(args[1], len(l))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return l[i]
+}
+
+func cmdLSet(s *Store, args []string) any {
+	l, err := getList(s, args[0])
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return errNoKey
+	}
+	i, ok, err := listIndex(args[1], len(l))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errRange
+	}
+	l[i] = args[2]
+	return Status("OK")
+}
+
+// cmdLRem count 大于 0 从头开始删除, 小于 0 从尾部开始删除, 等于 0 删除全部
+func cmdLRem(s *Store, args []string) any {
+	count, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	l, err := getList(s, args[0])
+	if err != nil || l == nil {
+		return orZero(err)
+	}
+	reverse := count < 0
+	if reverse {
+		count = -count
+		l = slices.Clone(l)
+		slices.Reverse(l)
+	}
+	var removed int64
+	out := make([]string, 0, len(l))
+	for _, v := range l {
+		if v == args[2] && (count == 0 || removed < count) {
+			removed++
+			continue
+		}
+		out = append(out, v)
+	}
+	if reverse {
+		slices.Reverse(out)
+	}
+	s.put(args[0], out)
+	return removed
+}
+
+func cmdLTrim(s *Store, args []string) any {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	l, err := getList(s, args[0])
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return Status("OK")
+	}
+	i, j, ok := normRange(start, stop, len(l))
+	if !ok {
+		s.put(args[0], []string(nil))
+	} else {
+		s.put(args[0], slices.Clone(l[i:j+1]))
+	}
+	return Status("OK")
+}
+
+// cmdLInsert LINSERT key BEFORE|AFTER pivot value, 找不到 pivot 返回 -1
+func cmdLInsert(s *Store, args []string) any {
+	var after bool
+	switch strings.ToUpper(args[1]) {
+	case "BEFORE":
+	case "AFTER":
+		after = true
+	default:
+		return errSyntax
+	}
+	l, err := getList(s, args[0])
+	if err != nil || l == nil {
+		return orZero(err)
+	}
+	i := slices.Index(l, args[2])
+	if i < 0 {
+		return int64(-1)
+	}
+	if after {
+		i++
+	}
+	l = slices.Insert(l, i, args[3])
+	s.put(args[0], l)
+	return int64(len(l))
+}
+
+// cmdLMove LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func cmdLMove(s *Store, args []string) any {
+	from, to := strings.ToUpper(args[2]), strings.ToUpper(args[3])
+	if from != "LEFT" && from != "RIGHT" || to != "LEFT" && to != "RIGHT" {
+		return errSyntax
+	}
+	if _, err := getList(s, args[1]); err != nil {
+		return err
+	}
+	v := popCmd(from == "LEFT")(s, args[:1])
+	if _, ok := v.(string); !ok {
+		return v
+	}
+	pushCmd(to == "LEFT", false)(s, []string{args[1], v.(string)})
+	return v
+}
@@ -0,0 +1,241 @@
+package rdbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/preceeder/rdb"
+	"github.com/redis/go-redis/v9"
+)
+
+// MatchMode 回放的时候命令和录制内容的对应方式
+type MatchMode int
+
+const (
+	// MatchStrict 严格按照录制的顺序, 每条命令必须和下一条录制的命令一致
+	MatchStrict MatchMode = iota
+	// MatchPerKey 同一个 key (第一个参数) 上的命令保持录制的顺序, 不同 key 之间可以交错, 适合并发的代码
+	MatchPerKey
+)
+
+func (m MatchMode) String() string {
+	if m == MatchPerKey {
+		return "per-key order"
+	}
+	return "strict order"
+}
+
+// ReplayOptions 回放的匹配规则
+type ReplayOptions struct {
+	Match MatchMode
+	// IgnoreArgs 比较的时候忽略的参数, 命令名 -> 参数下标 (命令名本身为 0), 例如 {"EXPIREAT": {2}}
+	IgnoreArgs map[string][]int
+	// Volatile 匹配的参数比较的时候忽略, 例如时间戳 regexp.MustCompile(`^\d{10,13}$`)
+	Volatile *regexp.Regexp
+}
+
+// MismatchError 回放的命令和录制的内容对不上, Error() 给出两边的命令和不同的参数
+type MismatchError struct {
+	Seq  int          // 回放的第几条命令, 从 1 开始
+	Mode MatchMode    // 使用的匹配方式
+	Want *Interaction // 期望的录制命令, 为 nil 表示没有剩余的录制命令
+	Got  []string     // 实际的命令
+}
+
+func (e *MismatchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "rdbtest: command #%d does not match cassette (%s)\n", e.Seq, e.Mode)
+	if e.Want == nil {
+		fmt.Fprintf(&b, "+ %s\n  no recorded command left", strings.Join(e.Got, " "))
+		return b.String()
+	}
+	fmt.Fprintf(&b, "- %s\n+ %s", e.Want, strings.Join(e.Got, " "))
+	for i := 0; i < max(len(e.Want.Args), len(e.Got)); i++ {
+		want, got := argAt(e.Want.Args, i), argAt(e.Got, i)
+		if want != got {
+			fmt.Fprintf(&b, "\n  arg[%d]: want %s, got %s", i, want, got)
+		}
+	}
+	return b.String()
+}
+
+func argAt(args []string, i int) string {
+	if i < len(args) {
+		return strconv.Quote(args[i])
+	}
+	return "(missing)"
+}
+
+// ErrUnusedInteractions 回放结束的时候还有没有用到的录制命令
+var ErrUnusedInteractions = errors.New("rdbtest: cassette has unused interactions")
+
+// Replayer 作为 go-redis 的 hook 按照 Cassette 回放回复, 不会连接 redis
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	opts     ReplayOptions
+	used     []bool
+	seq      int
+	errs     []error
+}
+
+// NewReplayer 通常使用 Replay 直接得到回放的 RedisClient
+func NewReplayer(cassette *Cassette, opts ReplayOptions) *Replayer {
+	return &Replayer{cassette: cassette, opts: opts, used: make([]bool, len(cassette.Interactions))}
+}
+
+// Replay 返回按照 cassette 回放的 RedisClient, 它和真实的 client 一样实现了 rdb.Executor
+// builder 的所有方法、PipeLine 和 ExecScript 都从录制内容中得到回复, 对不上的命令返回 *MismatchError
+func Replay(cassette *Cassette, config rdb.Config, opts ReplayOptions) (*rdb.RedisClient, *Replayer) {
+	r := NewReplayer(cassette, opts)
+	c := redis.NewClient(&redis.Options{Addr: "rdbtest.invalid:6379", Protocol: 3})
+	c.AddHook(r)
+	return rdb.NewRedisClientWith(c, config), r
+}
+
+// Err 回放过程中的第一个不匹配, 以及没有用到的录制命令, 测试结束的时候检查
+func (r *Replayer) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errs) > 0 {
+		return r.errs[0]
+	}
+	var unused []string
+	for i, used := range r.used {
+		if !used {
+			unused = append(unused, "  "+r.cassette.Interactions[i].String())
+		}
+	}
+	if len(unused) > 0 {
+		return fmt.Errorf("%w:\n%s", ErrUnusedInteractions, strings.Join(unused, "\n"))
+	}
+	return nil
+}
+
+func (r *Replayer) DialHook(redis.DialHook) redis.DialHook {
+	return func(context.Context, string, string) (net.Conn, error) {
+		return nil, ErrNoDial
+	}
+}
+
+func (r *Replayer) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		r.replay(cmd)
+		return cmd.Err()
+	}
+}
+
+func (r *Replayer) ProcessPipelineHook(redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(_ context.Context, cmds []redis.Cmder) error {
+		var first error
+		for _, cmd := range cmds {
+			switch strings.ToUpper(cmd.Name()) {
+			case "MULTI", "EXEC":
+				continue
+			}
+			r.replay(cmd)
+			if err := cmd.Err(); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+}
+
+func (r *Replayer) replay(cmd redis.Cmder) {
+	args := cmdArgs(cmd)
+	args[0] = strings.ToUpper(args[0])
+	in, err := r.next(args)
+	if err != nil {
+		cmd.SetErr(err)
+		return
+	}
+	switch {
+	case in.ErrKind == "nil":
+		cmd.SetErr(redis.Nil)
+	case in.ErrKind == "redis":
+		cmd.SetErr(Error(in.Err))
+	case in.Err != "":
+		cmd.SetErr(errors.New(in.Err))
+	default:
+		if err := rdb.FillReply(cmd, in.Reply); err != nil {
+			cmd.SetErr(err)
+		}
+	}
+}
+
+// next 找到和 args 对应的录制命令并标记为已使用
+func (r *Replayer) next(args []string) (*Interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	i := r.candidate(args)
+	if i < 0 {
+		err := &MismatchError{Seq: r.seq, Mode: r.opts.Match, Got: args}
+		r.errs = append(r.errs, err)
+		return nil, err
+	}
+	in := &r.cassette.Interactions[i]
+	if !r.equal(in.Args, args) {
+		err := &MismatchError{Seq: r.seq, Mode: r.opts.Match, Want: in, Got: args}
+		r.errs = append(r.errs, err)
+		return nil, err
+	}
+	r.used[i] = true
+	return in, nil
+}
+
+// candidate 按照匹配方式返回下一条应该对应的录制命令, 没有的时候返回 -1
+func (r *Replayer) candidate(args []string) int {
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] {
+			continue
+		}
+		if r.opts.Match == MatchStrict || commandKey(in.Args) == commandKey(args) {
+			return i
+		}
+	}
+	return -1
+}
+
+func commandKey(args []string) string {
+	if len(args) < 2 {
+		return ""
+	}
+	// EVAL/EVALSHA 的第一个 key 在 numkeys 之后
+	switch args[0] {
+	case "EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO":
+		if len(args) > 3 && args[2] != "0" {
+			return args[3]
+		}
+		return ""
+	}
+	return args[1]
+}
+
+func (r *Replayer) equal(want, got []string) bool {
+	if len(want) != len(got) {
+		return false
+	}
+	ignored := r.opts.IgnoreArgs[got[0]]
+	for i := range want {
+		if want[i] == got[i] {
+			continue
+		}
+		if slices.Contains(ignored, i) {
+			continue
+		}
+		if r.opts.Volatile != nil && r.opts.Volatile.MatchString(want[i]) && r.opts.Volatile.MatchString(got[i]) {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package rdbtest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/preceeder/rdb"
+)
+
+func init() {
+	register("EVAL", 2, evalCmd(false))
+	register("EVAL_RO", 2, evalCmd(false))
+	register("EVALSHA", 2, evalCmd(true))
+	register("EVALSHA_RO", 2, evalCmd(true))
+	register("SCRIPT", 1, cmdScript)
+}
+
+// ScriptFunc 用 go 实现的 lua 脚本, call 和 redis.pcall 一样执行命令并返回回复, 错误回复为 Error
+// 返回值按照 lua 的规则转换, 例如 float64 变成字符串, Map 变成扁平数组
+type ScriptFunc func(call func(args ...string) any, keys, argv []string) any
+
+// RegisterScript 注册脚本的 go 实现, EVAL/EVALSHA 执行内容为 script 的脚本的时候调用 fn
+// 内置支持 rdb.ExpireWrapScript 和 "return redis.call('GET', KEYS[1])" 这样只有一条命令的脚本, 其他脚本需要注册
+func (s *Store) RegisterScript(script string, fn ScriptFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.funcs[scriptSHA(script)] = fn
+}
+
+func scriptSHA(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// evalCmd EVAL script numkeys key... arg..., bySHA 为 true 的是 EVALSHA, 没有加载过的脚本返回 NOSCRIPT
+func evalCmd(bySHA bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		script := args[0]
+		if bySHA {
+			var ok bool
+			if script, ok = s.scripts[strings.ToLower(args[0])]; !ok {
+				return Error("NOSCRIPT No matching script. Please use EVAL.")
+			}
+		} else {
+			s.scripts[scriptSHA(script)] = script
+		}
+		numKeys, err := parseInt(args[1])
+		if err != nil {
+			return err
+		}
+		if numKeys < 0 || int(numKeys) > len(args)-2 {
+			return Error("ERR Number of keys can't be greater than number of args")
+		}
+		keys, argv := args[2:2+numKeys], args[2+numKeys:]
+		return luaReply(s.runScript(script, keys, argv))
+	}
+}
+
+func cmdScript(s *Store, args []string) any {
+	switch strings.ToUpper(args[0]) {
+	case "LOAD":
+		if len(args) != 2 {
+			return errArgs("SCRIPT|LOAD")
+		}
+		sha := scriptSHA(args[1])
+		s.scripts[sha] = args[1]
+		return sha
+	case "EXISTS":
+		out := make([]any, len(args)-1)
+		for i, sha := range args[1:] {
+			out[i] = int64(0)
+			if _, ok := s.scripts[strings.ToLower(sha)]; ok {
+				out[i] = int64(1)
+			}
+		}
+		return out
+	case "FLUSH":
+		s.scripts = map[string]string{}
+		return Status("OK")
+	}
+	return Error("ERR unknown subcommand '" + args[0] + "'")
+}
+
+func (s *Store) runScript(script string, keys, argv []string) any {
+	call := func(args ...string) any { return s.exec(args) }
+	if fn, ok := s.funcs[scriptSHA(script)]; ok {
+		return fn(call, keys, argv)
+	}
+	if script == rdb.ExpireWrapScript {
+		return runExpireWrap(call, argv)
+	}
+	if args, ok := parseOneLiner(script, keys, argv); ok {
+		return call(args...)
+	}
+	return Error("ERR rdbtest: unsupported script, use Store.RegisterScript to provide an implementation")
+}
+
+// runExpireWrap rdb.ExpireWrapScript 的 go 实现: ARGV[1] 为原命令参数个数, 之后是原命令和每条过期命令
+func runExpireWrap(call func(args ...string) any, argv []string) any {
+	n, err := strconv.Atoi(argv[0])
+	if err != nil || n+1 > len(argv) {
+		return Error("ERR rdbtest: malformed expire wrap arguments")
+	}
+	reply := call(argv[1 : n+1]...)
+	if _, failed := reply.(Error); failed {
+		return reply
+	}
+	for i := n + 1; i < len(argv); {
+		m, err := strconv.Atoi(argv[i])
+		if err != nil || i+m >= len(argv) {
+			break
+		}
+		if failed, ok := call(argv[i+1 : i+1+m]...).(Error); ok {
+			return Error(rdb.ExpireFailedReply + " " + argv[i+2] + " " + string(failed))
+		}
+		i += m + 1
+	}
+	return reply
+}
+
+var oneLiner = regexp.MustCompile(`(?s)^\s*return\s+redis\.p?call\s*\((.*)\)\s*;?\s*$`)
+
+var scriptRef = regexp.MustCompile(`^(KEYS|ARGV)\[(\d+)\]$`)
+
+// parseOneLiner 解析 "return redis.call('SET', KEYS[1], ARGV[1], 'EX', 10)" 这样的脚本
+// 参数只能是字符串、数字、KEYS[n] 或者 ARGV[n]
+func parseOneLiner(script string, keys, argv []string) ([]string, bool) {
+	m := oneLiner.FindStringSubmatch(script)
+	if m == nil {
+		return nil, false
+	}
+	var args []string
+	for _, tok := range splitArgs(m[1]) {
+		tok = strings.TrimSpace(tok)
+		switch {
+		case len(tok) >= 2 && (tok[0] == '\'' || tok[0] == '"') && tok[len(tok)-1] == tok[0]:
+			args = append(args, tok[1:len(tok)-1])
+		case scriptRef.MatchString(tok):
+			ref := scriptRef.FindStringSubmatch(tok)
+			i, _ := strconv.Atoi(ref[2])
+			src := keys
+			if ref[1] == "ARGV" {
+				src = argv
+			}
+			if i < 1 || i > len(src) {
+				return nil, false
+			}
+			args = append(args, src[i-1])
+		default:
+			if _, err := strconv.ParseFloat(tok, 64); err != nil {
+				return nil, false
+			}
+			args = append(args, tok)
+		}
+	}
+	return args, len(args) > 0
+}
+
+// splitArgs 按逗号分割参数, 忽略引号中的逗号
+func splitArgs(s string) []string {
+	var out []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ',':
+			out = append(out, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, s[start:])
+}
+
+// luaReply 回复经过 lua 之后的样子: 脚本以 RESP2 执行, 浮点数变成字符串, Map/Pairs 变成扁平数组
+func luaReply(reply any) any {
+	switch v := reply.(type) {
+	case float64:
+		return formatFloat(v)
+	case Map:
+		return luaReply([]any(v))
+	case Pairs:
+		return luaReply([]any(v))
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = luaReply(e)
+		}
+		return out
+	}
+	return reply
+}
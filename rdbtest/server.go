@@ -0,0 +1,470 @@
+package rdbtest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/preceeder/rdb"
+)
+
+var (
+	// ErrLoading 和 redis 启动加载数据时的回复一样, 可以作为 Fault.Reply
+	ErrLoading = Error("LOADING Redis is loading the dataset in memory")
+	// ErrNoScript 和 EVALSHA 找不到脚本时的回复一样, 可以作为 Fault.Reply
+	ErrNoScript = Error("NOSCRIPT No matching script. Please use EVAL.")
+)
+
+// Moved 集群中 key 所在的 slot 已经迁移到 addr 的回复
+func Moved(slot int, addr string) Error {
+	return Error(fmt.Sprintf("MOVED %d %s", slot, addr))
+}
+
+// Ask 集群中 slot 正在迁移到 addr 的回复
+func Ask(slot int, addr string) Error {
+	return Error(fmt.Sprintf("ASK %d %s", slot, addr))
+}
+
+// Fault 注入的故障, 匹配的命令按照 Delay、Drop、Reply 处理
+type Fault struct {
+	Cmd   string                   // 命令名, 不区分大小写; 为空的时候匹配所有命令, 但不包括 HELLO/AUTH/CLIENT/SELECT 这些握手命令
+	Key   string                   // 第一个参数的 glob, 例如 "user:*", 为空不检查
+	Match func(args []string) bool // 更复杂的匹配条件, 可以为 nil
+	Times int                      // 生效的次数, 0 表示一直生效
+	Delay time.Duration            // 处理之前等待, 用来测试超时
+	Drop  bool                     // 不回复, 直接关闭连接
+	Reply any                      // 不执行命令, 直接返回这个回复, 例如 ErrLoading 或者 Moved(3999, "127.0.0.1:7001")
+}
+
+// handshake 连接初始化时 go-redis 发送的命令, Cmd 为空的 Fault 不匹配
+var handshake = map[string]bool{"HELLO": true, "AUTH": true, "CLIENT": true, "SELECT": true, "QUIT": true}
+
+func (f *Fault) matches(args []string) bool {
+	name := strings.ToUpper(args[0])
+	if f.Cmd == "" && handshake[name] || f.Cmd != "" && !strings.EqualFold(f.Cmd, name) {
+		return false
+	}
+	if f.Key != "" && (len(args) < 2 || !matchGlob(f.Key, args[1])) {
+		return false
+	}
+	return f.Match == nil || f.Match(args)
+}
+
+// ServerOptions Server 的配置, 零值可以直接使用
+type ServerOptions struct {
+	Clock     *Clock // Store 使用的时钟, 为 nil 的时候从当前时间开始
+	Password  string // 不为空的时候需要 AUTH 或者 HELLO AUTH, Config 中会带上密码
+	RESP2Only bool   // 不支持 HELLO, 和 redis 6 之前一样, 客户端会退回 RESP2
+}
+
+// Server 监听本地端口的 redis 替身, 支持 RESP2/RESP3, 命令在 Store 中执行
+// 用来测试 initRedis、连接池、hook 和错误回复这些真实的网络路径; 所有 db 共用同一份数据
+type Server struct {
+	*Store
+	opts     ServerOptions
+	ln       net.Listener
+	mu       sync.Mutex
+	faults   []*Fault
+	conns    map[net.Conn]struct{}
+	accepted int
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer 在 127.0.0.1 的随机端口上启动 Server, 和 httptest.NewServer 一样监听失败的时候 panic
+// 用完之后需要 Close
+func NewServer(opts ServerOptions) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("rdbtest: failed to listen: " + err.Error())
+	}
+	s := &Server{Store: NewStore(opts.Clock), opts: opts, ln: ln, conns: map[net.Conn]struct{}{}}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Config 连接这个 Server 的配置, 可以直接用于 rdb.NewRedisClient
+func (s *Server) Config() rdb.Config {
+	host, port, _ := net.SplitHostPort(s.Addr())
+	return rdb.Config{Host: host, Port: port, Password: s.opts.Password}
+}
+
+// Inject 添加故障, 按添加的顺序匹配, 第一个匹配的生效
+func (s *Server) Inject(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range faults {
+		s.faults = append(s.faults, &f)
+	}
+}
+
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	s.faults = nil
+	s.mu.Unlock()
+}
+
+// Accepted 累计接受的连接数, 可以用来检查连接池的行为
+func (s *Server) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// DropConnections 关闭当前所有的连接, 模拟服务端重启或者网络中断, Server 继续接受新连接
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Close 停止监听并关闭所有的连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	err := s.ln.Close()
+	s.DropConnections()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.accepted++
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+// fault 返回第一个匹配 args 的故障, 次数用完的移除
+func (s *Server) fault(args []string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.faults {
+		if !f.matches(args) {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// session 一个连接的状态
+type session struct {
+	proto  int
+	authed bool
+	multi  bool       // 在 MULTI 中
+	queued [][]string // MULTI 之后排队的命令
+	dirty  bool       // 排队时有命令出错, EXEC 的时候放弃事务
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+	}()
+	r := bufio.NewReader(c)
+	w := &respWriter{w: bufio.NewWriter(c), proto: 2}
+	sess := &session{proto: 2, authed: s.opts.Password == ""}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				w.write(Error("ERR Protocol error: " + err.Error()))
+				w.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if f := s.fault(args); f != nil {
+			if f.Delay > 0 {
+				time.Sleep(f.Delay)
+			}
+			if f.Drop {
+				return
+			}
+			if f.Reply != nil {
+				if sess.multi {
+					sess.dirty = true
+				}
+				w.write(f.Reply)
+				if w.w.Flush() != nil {
+					return
+				}
+				continue
+			}
+		}
+		reply, quit := s.dispatch(sess, args)
+		w.proto = sess.proto
+		w.write(reply)
+		// pipeline 中的命令处理完再一起发送
+		if r.Buffered() == 0 || quit {
+			if w.w.Flush() != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// dispatch 处理连接相关的命令和事务, 其他命令交给 Store
+func (s *Server) dispatch(sess *session, args []string) (any, bool) {
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "HELLO":
+		return s.hello(sess, args[1:]), false
+	case "AUTH":
+		return s.auth(sess, args[1:]), false
+	case "QUIT":
+		return Status("OK"), true
+	}
+	if !sess.authed {
+		return Error("NOAUTH Authentication required."), false
+	}
+	switch name {
+	case "CLIENT":
+		if len(args) > 1 && strings.EqualFold(args[1], "ID") {
+			return int64(1), false
+		}
+		return Status("OK"), false
+	case "READONLY", "READWRITE", "WATCH", "UNWATCH":
+		return Status("OK"), false
+	case "COMMAND":
+		return []any{}, false
+	case "MULTI":
+		if sess.multi {
+			return Error("ERR MULTI calls can not be nested"), false
+		}
+		sess.multi, sess.queued, sess.dirty = true, nil, false
+		return Status("OK"), false
+	case "DISCARD":
+		if !sess.multi {
+			return Error("ERR DISCARD without MULTI"), false
+		}
+		sess.multi, sess.queued = false, nil
+		return Status("OK"), false
+	case "EXEC":
+		if !sess.multi {
+			return Error("ERR EXEC without MULTI"), false
+		}
+		queued, dirty := sess.queued, sess.dirty
+		sess.multi, sess.queued, sess.dirty = false, nil, false
+		if dirty {
+			return Error("EXECABORT Transaction discarded because of previous errors."), false
+		}
+		return s.DoMulti(queued), false
+	}
+	if sess.multi {
+		if _, ok := commands[name]; !ok {
+			sess.dirty = true
+			return Error("ERR unknown command '" + args[0] + "'"), false
+		}
+		sess.queued = append(sess.queued, args)
+		return Status("QUEUED"), false
+	}
+	return s.Do(args...), false
+}
+
+// hello HELLO [protover [AUTH username password] [SETNAME name]]
+func (s *Server) hello(sess *session, args []string) any {
+	if s.opts.RESP2Only {
+		return Error("ERR unknown command 'HELLO'")
+	}
+	proto := sess.proto
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < 2 || v > 3 {
+			return Error("NOPROTO unsupported protocol version")
+		}
+		proto = v
+	}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			if reply := s.auth(sess, args[i+1:i+3]); reply != Status("OK") {
+				return reply
+			}
+			i += 2
+		case "SETNAME":
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if !sess.authed {
+		return Error("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+	sess.proto = proto
+	return Map{
+		"server", "redis",
+		"version", "7.2.0",
+		"proto", int64(proto),
+		"id", int64(1),
+		"mode", "standalone",
+		"role", "master",
+		"modules", []any{},
+	}
+}
+
+// auth AUTH [username] password, 用户名不检查
+func (s *Server) auth(sess *session, args []string) any {
+	if len(args) == 0 || len(args) > 2 {
+		return errArgs("AUTH")
+	}
+	if s.opts.Password == "" {
+		return Error("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	if args[len(args)-1] != s.opts.Password {
+		return Error("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	sess.authed = true
+	return Status("OK")
+}
+
+// readCommand 读取一条命令, 支持 RESP 数组和 telnet 这样的内联命令
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return nil, errors.New("invalid multibulk length")
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("expected '$', got '%.1s'", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, errors.New("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// respWriter 按照连接协商的协议版本编码回复, RESP2 中 map 和 double 分别编码成扁平数组和字符串
+type respWriter struct {
+	w     *bufio.Writer
+	proto int
+}
+
+func (rw *respWriter) write(reply any) {
+	w := rw.w
+	switch v := reply.(type) {
+	case nil:
+		if rw.proto == 3 {
+			w.WriteString("_\r\n")
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+	case Status:
+		w.WriteString("+" + string(v) + "\r\n")
+	case Error:
+		w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(string(v)) + "\r\n")
+	case int64:
+		w.WriteString(":" + formatInt(v) + "\r\n")
+	case int:
+		w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case string:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case float64:
+		if rw.proto == 3 {
+			w.WriteString("," + formatFloat(v) + "\r\n")
+		} else {
+			rw.write(formatFloat(v))
+		}
+	case []any:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			rw.write(e)
+		}
+	case Map:
+		if rw.proto == 3 {
+			w.WriteString("%" + strconv.Itoa(len(v)/2) + "\r\n")
+			for _, e := range v {
+				rw.write(e)
+			}
+		} else {
+			rw.write([]any(v))
+		}
+	case Pairs:
+		if rw.proto == 3 {
+			w.WriteString("*" + strconv.Itoa(len(v)/2) + "\r\n")
+			for i := 0; i+1 < len(v); i += 2 {
+				w.WriteString("*2\r\n")
+				rw.write(v[i])
+				rw.write(v[i+1])
+			}
+		} else {
+			rw.write([]any(v))
+		}
+	case error:
+		rw.write(Error(v.Error()))
+	default:
+		rw.write(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,225 @@
+package rdbtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/preceeder/rdb"
+	"github.com/redis/go-redis/v9"
+)
+
+func newServerClient(t *testing.T, opts ServerOptions) (*rdb.RedisClient, *Server) {
+	t.Helper()
+	srv := NewServer(opts)
+	client := rdb.NewRedisClient(srv.Config())
+	t.Cleanup(func() {
+		client.RedisClose()
+		srv.Close()
+	})
+	return client, srv
+}
+
+func TestServer_Protocols(t *testing.T) {
+	for _, opts := range []ServerOptions{{}, {RESP2Only: true, Password: "secret"}} {
+		client, srv := newServerClient(t, opts)
+		ctx := context.Background()
+		args := map[string]any{"id": 1, "field": "name", "value": "tom"}
+		if err := client.HSet(ctx, user, args).Err(); err != nil {
+			t.Fatal(err)
+		}
+		if all := client.HGetAll(ctx, user, args).MapStringString().Val(); all["name"] != "tom" {
+			t.Errorf("resp2 only %v: unexpected HGETALL reply %v", opts.RESP2Only, all)
+		}
+
+		pip := client.PipeLine()
+		pip.ZAdd(ctx, rank, map[string]any{"score": 1.5, "member": "a"}).Int()
+		zs := pip.ZRange(ctx, rank, nil).ZSlice()
+		score := pip.ZScore(ctx, rank, map[string]any{"member": "a"}).Float()
+		if _, err := pip.Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if len(zs.Val()) != 1 || zs.Val()[0].Score != 1.5 || score.Val() != 1.5 {
+			t.Errorf("resp2 only %v: unexpected ZRANGE %v ZSCORE %v", opts.RESP2Only, zs.Val(), score.Val())
+		}
+		if ttl := srv.Do("TTL", "user:1"); ttl != int64(60) {
+			t.Errorf("resp2 only %v: unexpected TTL %v", opts.RESP2Only, ttl)
+		}
+	}
+}
+
+func TestServer_Auth(t *testing.T) {
+	srv := NewServer(ServerOptions{Password: "secret"})
+	defer srv.Close()
+	c := redis.NewClient(&redis.Options{Addr: srv.Addr(), Password: "wrong"})
+	defer c.Close()
+	if err := c.Ping(context.Background()).Err(); err == nil {
+		t.Error("expected auth error")
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	srv := NewServer(ServerOptions{})
+	defer srv.Close()
+	// 关闭 go-redis 自己的重试, 否则 LOADING 和断开的连接会在 go-redis 中重试掉
+	client := rdb.NewRedisClientWith(redis.NewClient(&redis.Options{Addr: srv.Addr(), MaxRetries: -1, ContextTimeoutEnabled: true}), rdb.Config{})
+	defer client.RedisClose()
+	ctx := context.Background()
+	str := rdb.RdCmd{Key: "s:{{id}}", CMD: map[rdb.Command]rdb.RdSubCmd{
+		rdb.GET: {Retry: &rdb.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, On: rdb.RetryLoading}, Idempotent: true},
+		rdb.SET: {Params: "{{v}}", Timeout: 50 * time.Millisecond},
+	}}
+	if err := client.Set(ctx, str, map[string]any{"id": 1, "v": "a"}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// LOADING 两次之后恢复, 按重试策略成功
+	srv.Inject(Fault{Cmd: "GET", Times: 2, Reply: ErrLoading})
+	get := client.Get(ctx, str, map[string]any{"id": 1})
+	if get.String().Val() != "a" || get.Attempts() != 3 {
+		t.Errorf("unexpected GET %q after %d attempts, err %v", get.String().Val(), get.Attempts(), get.Err())
+	}
+	srv.Inject(Fault{Cmd: "GET", Times: 1, Reply: ErrLoading})
+	if err := client.Client.Get(ctx, "s:1").Err(); !errors.Is(rdb.ClassifyError(err), rdb.ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable, got %v", err)
+	}
+
+	// NOSCRIPT 的时候重新加载脚本
+	lua := rdb.LuaScript{Script: "return redis.call('GET', KEYS[1])", Keys: []string{"k"}}
+	srv.Inject(Fault{Cmd: "EVALSHA", Times: 1, Reply: ErrNoScript})
+	if v := client.ExecScript(ctx, lua, map[string]string{"k": "s:1"}, nil).Val(); v != "a" {
+		t.Errorf("unexpected script result %v", v)
+	}
+
+	srv.Inject(Fault{Key: "moved:*", Reply: Moved(3999, "127.0.0.1:7001")})
+	if err := client.Client.Get(ctx, "moved:1").Err(); !redis.HasErrorPrefix(err, "MOVED") {
+		t.Errorf("expected MOVED, got %v", err)
+	}
+	srv.ClearFaults()
+
+	srv.Inject(Fault{Cmd: "SET", Times: 1, Delay: 200 * time.Millisecond})
+	if err := client.Set(ctx, str, map[string]any{"id": 1, "v": "b"}).Err(); !errors.Is(err, rdb.ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+
+	// 连接断开之后连接池重新建立连接
+	accepted := srv.Accepted()
+	srv.Inject(Fault{Cmd: "GET", Times: 1, Drop: true})
+	if err := client.Client.Get(ctx, "s:1").Err(); err == nil {
+		t.Error("expected error from dropped connection")
+	}
+	if err := client.Client.Get(ctx, "s:1").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Accepted() <= accepted {
+		t.Errorf("expected a new connection, accepted %d -> %d", accepted, srv.Accepted())
+	}
+}
+
+func TestServer_Transaction(t *testing.T) {
+	client, srv := newServerClient(t, ServerOptions{})
+	ctx := context.Background()
+	tx := client.TxPipeLine()
+	incr := tx.HIncrBy(ctx, user, map[string]any{"id": 1, "field": "n", "by": 2}).Int()
+	set := tx.HSet(ctx, user, map[string]any{"id": 1, "field": "name", "value": "tom"}).Int()
+	if _, err := tx.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if incr.Val() != 2 || set.Val() != 1 {
+		t.Errorf("unexpected results %d %d", incr.Val(), set.Val())
+	}
+
+	srv.Inject(Fault{Cmd: "HINCRBY", Times: 1, Reply: ErrLoading})
+	tx = client.TxPipeLine()
+	incr = tx.HIncrBy(ctx, user, map[string]any{"id": 1, "field": "n", "by": 2}).Int()
+	if _, err := tx.Exec(ctx); err == nil {
+		t.Error("expected transaction to be aborted")
+	}
+	if v := srv.Do("HGET", "user:1", "n"); v != "2" {
+		t.Errorf("aborted transaction should not run, got %v", v)
+	}
+}
+
+func TestServer_AutoPipelineDeadline(t *testing.T) {
+	client, srv := newServerClient(t, ServerOptions{})
+	client.EnableAutoPipeline(rdb.AutoPipelineOptions{})
+	defer client.DisableAutoPipeline()
+	str := rdb.RdCmd{Key: "s:{{id}}", CMD: map[rdb.Command]rdb.RdSubCmd{rdb.GET: {}}}
+
+	srv.Inject(Fault{Cmd: "GET", Times: 1, Delay: 500 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := client.Get(ctx, str, map[string]any{"id": 1}).Err(); !errors.Is(err, rdb.ErrTimeout) || time.Since(start) > 200*time.Millisecond {
+		t.Errorf("expected ErrTimeout before the delayed reply, got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestServer_NoHiddenRetry(t *testing.T) {
+	client, srv := newServerClient(t, ServerOptions{})
+	counter := rdb.RdCmd{Key: "c:{{id}}", CMD: map[rdb.Command]rdb.RdSubCmd{rdb.INCR: {}}}
+	ctx := context.Background()
+
+	// 读超时之后 go-redis 不会再次发送, 非幂等的 INCR 只执行一次
+	srv.Inject(Fault{Cmd: "INCR", Times: 1, Delay: 3500 * time.Millisecond})
+	incr := client.Incr(ctx, counter, map[string]any{"id": 1})
+	if err := incr.Err(); !errors.Is(err, rdb.ErrTimeout) || incr.Attempts() != 1 {
+		t.Errorf("expected a single timed out attempt, got %v after %d attempts", err, incr.Attempts())
+	}
+	time.Sleep(time.Second) // 等服务端执行完被延迟的命令
+	if v := srv.Do("GET", "c:1"); v != "1" {
+		t.Errorf("INCR should run once, counter %v", v)
+	}
+
+	// 连接断开也不会再次发送
+	srv.Inject(Fault{Cmd: "INCR", Times: 1, Drop: true})
+	incr = client.Incr(ctx, counter, map[string]any{"id": 2})
+	if err := incr.Err(); err == nil || incr.Attempts() != 1 {
+		t.Errorf("expected a single failed attempt, got %v after %d attempts", err, incr.Attempts())
+	}
+	if v := srv.Do("GET", "c:2"); v != nil {
+		t.Errorf("dropped INCR should not be sent again, counter %v", v)
+	}
+}
+
+func TestServer_CommandTimeout(t *testing.T) {
+	client, srv := newServerClient(t, ServerOptions{})
+	ctx := context.Background()
+	srv.Do("SET", "s:1", "a")
+	fast := rdb.RdCmd{Key: "s:{{id}}", CMD: map[rdb.Command]rdb.RdSubCmd{rdb.GET: {Timeout: 100 * time.Millisecond}}}
+	timedOut := func(name string, err error, start time.Time) {
+		t.Helper()
+		if !errors.Is(err, rdb.ErrTimeout) || time.Since(start) > 500*time.Millisecond {
+			t.Errorf("%s: expected ErrTimeout after 100ms, got %v after %v", name, err, time.Since(start))
+		}
+	}
+
+	// 没有配置 CmdTimeout 的时候子命令的超时也在连接上生效
+	srv.Inject(Fault{Cmd: "GET", Times: 2, Delay: time.Second})
+	start := time.Now()
+	timedOut("Get", client.Get(ctx, fast, map[string]any{"id": 1}).Err(), start)
+	start = time.Now()
+	timedOut("ExecuteCmd", rdb.ExecuteCmd[*redis.StringCmd](client, ctx, fast, rdb.GET, map[string]any{"id": 1}).Err(), start)
+
+	srv.Inject(Fault{Cmd: "EVALSHA", Times: 1, Delay: time.Second})
+	start = time.Now()
+	lua := rdb.LuaScript{Script: "return 1", Timeout: 100 * time.Millisecond}
+	timedOut("ExecScript", client.ExecScript(ctx, lua, nil, nil).Err(), start)
+
+	// 比 go-redis 默认的 3s 读超时更长的超时时间, 命令只发送一次
+	slow := rdb.RdCmd{Key: "c:{{id}}", CMD: map[rdb.Command]rdb.RdSubCmd{rdb.INCR: {Timeout: 5 * time.Second}}}
+	srv.Inject(Fault{Cmd: "INCR", Times: 1, Delay: 3500 * time.Millisecond})
+	if v, err := client.Incr(ctx, slow, map[string]any{"id": 1}).Int().Result(); err != nil || v != 1 {
+		t.Errorf("expected the delayed INCR to succeed once, got %v %v", v, err)
+	}
+
+	// 没有 deadline 的命令使用 CmdTimeout, 直接使用 Client 也一样
+	config := srv.Config()
+	config.CmdTimeout = 100
+	short := rdb.NewRedisClient(config)
+	defer short.RedisClose()
+	srv.Inject(Fault{Cmd: "GET", Times: 1, Delay: time.Second})
+	start = time.Now()
+	timedOut("Client.Get", rdb.ClassifyError(short.Client.Get(ctx, "s:1").Err()), start)
+}
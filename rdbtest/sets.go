@@ -0,0 +1,211 @@
+package rdbtest
+
+import (
+	"sort"
+)
+
+func init() {
+	register("SADD", 2, cmdSAdd)
+	register("SREM", 2, cmdSRem)
+	register("SCARD", 1, cmdSCard)
+	register("SISMEMBER", 2, cmdSIsMember)
+	register("SMISMEMBER", 2, cmdSMIsMember)
+	register("SMEMBERS", 1, func(s *Store, args []string) any { return setOp(s, opUnion, args[:1]) })
+	register("SMOVE", 3, cmdSMove)
+	register("SPOP", 1, cmdSPop)
+	register("SUNION", 1, func(s *Store, args []string) any { return setOp(s, opUnion, args) })
+	register("SINTER", 1, func(s *Store, args []string) any { return setOp(s, opInter, args) })
+	register("SDIFF", 1, func(s *Store, args []string) any { return setOp(s, opDiff, args) })
+	register("SUNIONSTORE", 2, setStoreCmd(opUnion))
+	register("SINTERSTORE", 2, setStoreCmd(opInter))
+	register("SDIFFSTORE", 2, setStoreCmd(opDiff))
+}
+
+func getSet(s *Store, key string) (map[string]struct{}, error) {
+	set, _, err := lookupAs[map[string]struct{}](s, key)
+	return set, err
+}
+
+// sortedMembers set 的成员排序之后返回, 保证回复的顺序稳定
+func sortedMembers(set map[string]struct{}) []string {
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func cmdSAdd(s *Store, args []string) any {
+	set, err := getSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		set = map[string]struct{}{}
+	}
+	var added int64
+	for _, m := range args[1:] {
+		if _, ok := set[m]; !ok {
+			set[m] = struct{}{}
+			added++
+		}
+	}
+	s.put(args[0], set)
+	return added
+}
+
+func cmdSRem(s *Store, args []string) any {
+	set, err := getSet(s, args[0])
+	if err != nil || set == nil {
+		return orZero(err)
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := set[m]; ok {
+			delete(set, m)
+			n++
+		}
+	}
+	s.put(args[0], set)
+	return n
+}
+
+func cmdSCard(s *Store, args []string) any {
+	set, err := getSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	return int64(len(set))
+}
+
+func cmdSIsMember(s *Store, args []string) any {
+	set, err := getSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	if _, ok := set[args[1]]; ok {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func cmdSMIsMember(s *Store, args []string) any {
+	set, err := getSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	out := make([]any, len(args)-1)
+	for i, m := range args[1:] {
+		out[i] = int64(0)
+		if _, ok := set[m]; ok {
+			out[i] = int64(1)
+		}
+	}
+	return out
+}
+
+func cmdSMove(s *Store, args []string) any {
+	src, err := getSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	if _, err := getSet(s, args[1]); err != nil {
+		return err
+	}
+	if _, ok := src[args[2]]; !ok {
+		return int64(0)
+	}
+	delete(src, args[2])
+	s.put(args[0], src)
+	cmdSAdd(s, []string{args[1], args[2]})
+	return int64(1)
+}
+
+// cmdSPop SPOP key [count], 为了结果稳定总是弹出排序最小的成员
+func cmdSPop(s *Store, args []string) any {
+	count, withCount := int64(1), len(args) > 1
+	if withCount {
+		var err error
+		if count, err = parseInt(args[1]); err != nil || count < 0 {
+			return Error("ERR value is out of range, must be positive")
+		}
+	}
+	set, err := getSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		if withCount {
+			return []any{}
+		}
+		return nil
+	}
+	members := sortedMembers(set)
+	members = members[:min(int(count), len(members))]
+	for _, m := range members {
+		delete(set, m)
+	}
+	s.put(args[0], set)
+	if !withCount {
+		return members[0]
+	}
+	return strSlice(members)
+}
+
+type setOpKind int
+
+const (
+	opUnion setOpKind = iota
+	opInter
+	opDiff
+)
+
+// combineSets SUNION/SINTER/SDIFF, 不存在的 key 看作空集合
+func combineSets(s *Store, op setOpKind, keys []string) (map[string]struct{}, error) {
+	var out map[string]struct{}
+	for i, key := range keys {
+		set, err := getSet(s, key)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			out = make(map[string]struct{}, len(set))
+			for m := range set {
+				out[m] = struct{}{}
+			}
+			continue
+		}
+		for m := range out {
+			_, ok := set[m]
+			if op == opInter && !ok || op == opDiff && ok {
+				delete(out, m)
+			}
+		}
+		if op == opUnion {
+			for m := range set {
+				out[m] = struct{}{}
+			}
+		}
+	}
+	return out, nil
+}
+
+func setOp(s *Store, op setOpKind, keys []string) any {
+	set, err := combineSets(s, op, keys)
+	if err != nil {
+		return err
+	}
+	return strSlice(sortedMembers(set))
+}
+
+func setStoreCmd(op setOpKind) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		set, err := combineSets(s, op, args[1:])
+		if err != nil {
+			return err
+		}
+		s.replace(args[0], set)
+		return int64(len(set))
+	}
+}
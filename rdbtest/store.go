@@ -0,0 +1,337 @@
+package rdbtest
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store 内存中的 redis 数据, 支持字符串、hash、list、set、zset、过期时间和常用的 lua 脚本
+// 过期的 key 在访问的时候删除, 时间来自 Clock; Fake 和 Server 共用
+type Store struct {
+	mu      sync.Mutex
+	clock   *Clock
+	data    map[string]*entry
+	scripts map[string]string     // SCRIPT LOAD/EVAL 缓存的脚本, sha1 -> 脚本
+	funcs   map[string]ScriptFunc // RegisterScript 注册的脚本实现, sha1 -> 实现
+}
+
+// entry 一个 key 的值, value 为 string、map[string]string(hash)、[]string(list)、
+// map[string]struct{}(set) 或者 map[string]float64(zset)
+type entry struct {
+	value    any
+	expireAt time.Time // 零值表示不过期
+}
+
+// NewStore clock 为 nil 的时候使用从当前时间开始的 Clock
+func NewStore(clock *Clock) *Store {
+	if clock == nil {
+		clock = NewClock(time.Time{})
+	}
+	return &Store{
+		clock:   clock,
+		data:    map[string]*entry{},
+		scripts: map[string]string{},
+		funcs:   map[string]ScriptFunc{},
+	}
+}
+
+func (s *Store) Clock() *Clock {
+	return s.clock
+}
+
+// Do 执行一条命令, 返回值为回复:
+// nil、int64、string、float64、Status、Error、[]any、Map 或者 Pairs
+func (s *Store) Do(args ...string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exec(args)
+}
+
+// DoMulti 原子执行多条命令, 用于 pipeline 和事务
+func (s *Store) DoMulti(cmds [][]string) []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replies := make([]any, len(cmds))
+	for i, args := range cmds {
+		replies[i] = s.exec(args)
+	}
+	return replies
+}
+
+// Keys 当前没有过期的所有 key, 已排序
+func (s *Store) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys("*")
+}
+
+func (s *Store) exec(args []string) any {
+	if len(args) == 0 {
+		return Error("ERR empty command")
+	}
+	name := strings.ToUpper(args[0])
+	c, ok := commands[name]
+	if !ok {
+		return Error("ERR unknown command '" + args[0] + "'")
+	}
+	if len(args)-1 < c.arity {
+		return errArgs(name)
+	}
+	return c.fn(s, args[1:])
+}
+
+// Status 简单字符串回复, 例如 OK、PONG
+type Status string
+
+// Error 错误回复, 实现了 redis.Error, 可以用 rdb.ClassifyError 分类
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+func (Error) RedisError() {}
+
+// Map 扁平的键值对 [k1, v1, k2, v2], RESP3 中是 map, RESP2 中是扁平数组, 例如 HGETALL
+type Map []any
+
+// Pairs 扁平的成员和分数 [m1, s1, m2, s2], RESP3 中是 [[m1, s1], [m2, s2]], RESP2 中是扁平数组, 例如 ZRANGE WITHSCORES
+type Pairs []any
+
+var (
+	errWrongType = Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInt    = Error("ERR value is not an integer or out of range")
+	errNotFloat  = Error("ERR value is not a valid float")
+	errSyntax    = Error("ERR syntax error")
+	errNoKey     = Error("ERR no such key")
+	errRange     = Error("ERR index out of range")
+	errMinMax    = Error("ERR min or max is not a float")
+	errLex       = Error("ERR min or max not valid string range item")
+	errOverflow  = Error("ERR increment or decrement would overflow")
+)
+
+func errArgs(name string) Error {
+	return Error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+}
+
+type command struct {
+	arity int // 最少参数个数, 不包括命令名
+	fn    func(s *Store, args []string) any
+}
+
+var commands = map[string]command{}
+
+// register 在各个文件的 init 中注册命令, 避免 commands 和 EVAL 之间的初始化循环
+func register(name string, arity int, fn func(s *Store, args []string) any) {
+	commands[name] = command{arity: arity, fn: fn}
+}
+
+// lookup 返回没有过期的 key, 过期的 key 在这里删除
+func (s *Store) lookup(key string) *entry {
+	e := s.data[key]
+	if e == nil {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !s.clock.Now().Before(e.expireAt) {
+		delete(s.data, key)
+		return nil
+	}
+	return e
+}
+
+// lookupAs 返回 T 类型的值, key 不存在返回 ok=false, 类型不对返回 WRONGTYPE
+func lookupAs[T any](s *Store, key string) (v T, ok bool, err error) {
+	e := s.lookup(key)
+	if e == nil {
+		return v, false, nil
+	}
+	if v, ok = e.value.(T); !ok {
+		return v, false, errWrongType
+	}
+	return v, true, nil
+}
+
+// put 写入 value, 已经存在的 key 保留过期时间; 空的集合类型删除 key, 和 redis 一致
+func (s *Store) put(key string, v any) {
+	if isEmpty(v) {
+		delete(s.data, key)
+		return
+	}
+	if e := s.lookup(key); e != nil {
+		e.value = v
+		return
+	}
+	s.data[key] = &entry{value: v}
+}
+
+// replace 写入 value 并清除过期时间, 例如 SET、*STORE
+func (s *Store) replace(key string, v any) {
+	if isEmpty(v) {
+		delete(s.data, key)
+		return
+	}
+	s.data[key] = &entry{value: v}
+}
+
+func isEmpty(v any) bool {
+	switch v := v.(type) {
+	case map[string]string:
+		return len(v) == 0
+	case []string:
+		return len(v) == 0
+	case map[string]struct{}:
+		return len(v) == 0
+	case map[string]float64:
+		return len(v) == 0
+	}
+	return false
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case map[string]string:
+		return "hash"
+	case []string:
+		return "list"
+	case map[string]struct{}:
+		return "set"
+	case map[string]float64:
+		return "zset"
+	}
+	return "none"
+}
+
+func (s *Store) keys(pattern string) []string {
+	var keys []string
+	for k := range s.data {
+		if s.lookup(k) != nil && matchGlob(pattern, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseInt(v string) (int64, error) {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, errNotInt
+	}
+	return n, nil
+}
+
+func parseFloat(v string) (float64, error) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errNotFloat
+	}
+	return f, nil
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// formatFloat 和 redis 一样, 整数不带小数点, 无穷大为 inf/-inf
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// normRange 把 LRANGE/ZRANGE 这类可以为负数的下标转换成 [start, stop], 范围为空的时候 ok=false
+func normRange(start, stop int64, n int) (int, int, bool) {
+	size := int64(n)
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	return int(start), int(stop), true
+}
+
+// matchGlob KEYS 使用的 glob 匹配, 支持 * ? [abc] [^a] [a-z] 和 \ 转义
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return pattern == s
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if s[0] >= class[i] && s[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+				} else if class[i] == s[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[end+2:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,162 @@
+package rdbtest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/preceeder/rdb"
+	"time"
+)
+
+func expectReply(t *testing.T, s *Store, want any, args ...string) {
+	t.Helper()
+	if got := s.Do(args...); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %#v, want %#v", strings.Join(args, " "), got, want)
+	}
+}
+
+func TestStore_Strings(t *testing.T) {
+	s := NewStore(nil)
+	expectReply(t, s, Status("OK"), "SET", "a", "1")
+	expectReply(t, s, nil, "SET", "a", "2", "NX")
+	expectReply(t, s, "1", "SET", "a", "3", "GET")
+	expectReply(t, s, int64(4), "INCR", "a")
+	expectReply(t, s, int64(-6), "DECRBY", "missing", "6")
+	expectReply(t, s, "5.5", "INCRBYFLOAT", "a", "1.5")
+	expectReply(t, s, int64(6), "APPEND", "b", "hello!")
+	expectReply(t, s, "ell", "GETRANGE", "b", "1", "3")
+	expectReply(t, s, []any{"5.5", nil, "hello!"}, "MGET", "a", "none", "b")
+	expectReply(t, s, errNotInt, "INCR", "b")
+	expectReply(t, s, "5.5", "GETDEL", "a")
+	expectReply(t, s, int64(0), "EXISTS", "a")
+	s.Do("HSET", "h", "f", "v")
+	expectReply(t, s, errWrongType, "GET", "h")
+	expectReply(t, s, Status("OK"), "SET", "h", "str")
+}
+
+func TestStore_Hashes(t *testing.T) {
+	s := NewStore(nil)
+	expectReply(t, s, int64(2), "HSET", "h", "b", "2", "a", "1")
+	expectReply(t, s, int64(0), "HSETNX", "h", "a", "x")
+	expectReply(t, s, Map{"a", "1", "b", "2"}, "HGETALL", "h")
+	expectReply(t, s, []any{"1", nil}, "HMGET", "h", "a", "c")
+	expectReply(t, s, int64(12), "HINCRBY", "h", "b", "10")
+	expectReply(t, s, []any{"a", "b"}, "HKEYS", "h")
+	expectReply(t, s, int64(2), "HDEL", "h", "a", "b", "c")
+	expectReply(t, s, Status("none"), "TYPE", "h")
+}
+
+func TestStore_Lists(t *testing.T) {
+	s := NewStore(nil)
+	expectReply(t, s, int64(3), "RPUSH", "l", "a", "b", "c")
+	expectReply(t, s, int64(4), "LPUSH", "l", "z")
+	expectReply(t, s, []any{"z", "a", "b", "c"}, "LRANGE", "l", "0", "-1")
+	expectReply(t, s, "c", "LINDEX", "l", "-1")
+	expectReply(t, s, int64(5), "LINSERT", "l", "AFTER", "a", "a")
+	expectReply(t, s, int64(2), "LREM", "l", "0", "a")
+	expectReply(t, s, "z", "LPOP", "l")
+	expectReply(t, s, []any{"c", "b"}, "RPOP", "l", "5")
+	expectReply(t, s, int64(0), "LLEN", "l")
+	expectReply(t, s, errNoKey, "LSET", "l", "0", "x")
+}
+
+func TestStore_Sets(t *testing.T) {
+	s := NewStore(nil)
+	expectReply(t, s, int64(3), "SADD", "s1", "c", "a", "b")
+	expectReply(t, s, int64(2), "SADD", "s2", "b", "d")
+	expectReply(t, s, []any{"a", "b", "c"}, "SMEMBERS", "s1")
+	expectReply(t, s, []any{"b"}, "SINTER", "s1", "s2")
+	expectReply(t, s, []any{"a", "c"}, "SDIFF", "s1", "s2")
+	expectReply(t, s, int64(4), "SUNIONSTORE", "u", "s1", "s2")
+	expectReply(t, s, int64(1), "SMOVE", "s2", "s1", "d")
+	expectReply(t, s, []any{int64(1), int64(0)}, "SMISMEMBER", "s1", "d", "x")
+}
+
+func TestStore_SortedSets(t *testing.T) {
+	s := NewStore(nil)
+	expectReply(t, s, int64(3), "ZADD", "z", "1", "a", "2", "b", "3", "c")
+	expectReply(t, s, int64(0), "ZADD", "z", "GT", "0", "a")
+	expectReply(t, s, 4.5, "ZINCRBY", "z", "2.5", "b")
+	expectReply(t, s, Pairs{"b", 4.5, "c", 3.0}, "ZRANGE", "z", "0", "1", "REV", "WITHSCORES")
+	expectReply(t, s, []any{"a", "c"}, "ZRANGEBYSCORE", "z", "-inf", "(4.5")
+	expectReply(t, s, []any{"c"}, "ZRANGE", "z", "+inf", "0", "BYSCORE", "REV", "LIMIT", "1", "1")
+	expectReply(t, s, int64(2), "ZCOUNT", "z", "2", "+inf")
+	expectReply(t, s, int64(0), "ZREVRANK", "z", "b")
+	expectReply(t, s, nil, "ZSCORE", "z", "x")
+	expectReply(t, s, int64(1), "ZREMRANGEBYRANK", "z", "0", "0")
+	s.Do("SADD", "set", "c", "d")
+	expectReply(t, s, Pairs{"d", 1.0, "c", 6.0, "b", 9.0}, "ZUNION", "2", "z", "set", "WEIGHTS", "2", "1", "AGGREGATE", "MAX", "WITHSCORES")
+	expectReply(t, s, Pairs{"c", 3.0}, "ZPOPMIN", "z")
+}
+
+func TestStore_Expire(t *testing.T) {
+	clock := NewClock(time.Unix(1700000000, 0))
+	s := NewStore(clock)
+	s.Do("SET", "a", "1", "EX", "10")
+	s.Do("SET", "b", "1")
+	expectReply(t, s, int64(10), "TTL", "a")
+	expectReply(t, s, int64(-1), "TTL", "b")
+	expectReply(t, s, int64(-2), "TTL", "c")
+	expectReply(t, s, int64(0), "EXPIRE", "a", "100", "NX")
+	expectReply(t, s, int64(1), "EXPIRE", "a", "20", "GT")
+	expectReply(t, s, int64(0), "EXPIRE", "b", "20", "GT")
+	expectReply(t, s, int64(1), "PEXPIREAT", "b", "1700000005000")
+
+	clock.Advance(5 * time.Second)
+	expectReply(t, s, nil, "GET", "b")
+	expectReply(t, s, int64(15000), "PTTL", "a")
+	// 写入不会清除过期时间, SET 会
+	s.Do("APPEND", "a", "2")
+	expectReply(t, s, int64(15), "TTL", "a")
+	clock.Advance(15 * time.Second)
+	if keys := s.Keys(); len(keys) != 0 {
+		t.Errorf("expired keys should be removed, got %v", keys)
+	}
+}
+
+func TestStore_Scripts(t *testing.T) {
+	s := NewStore(nil)
+	expectReply(t, s, Status("OK"), "EVAL", "return redis.call('SET', KEYS[1], ARGV[1])", "1", "k", "v")
+	sha := s.Do("SCRIPT", "LOAD", "return redis.call(\"ZSCORE\", KEYS[1], 'm')").(string)
+	s.Do("ZADD", "z", "1.5", "m")
+	expectReply(t, s, "1.5", "EVALSHA", sha, "1", "z")
+	expectReply(t, s, Error("NOSCRIPT No matching script. Please use EVAL."), "EVALSHA", "0000", "0")
+
+	script := "local v = redis.call('GET', KEYS[1]) return v .. ARGV[1]"
+	if _, ok := s.Do("EVAL", script, "1", "k", "!").(Error); !ok {
+		t.Error("unregistered script should fail")
+	}
+	s.RegisterScript(script, func(call func(args ...string) any, keys, argv []string) any {
+		return call("GET", keys[0]).(string) + argv[0]
+	})
+	expectReply(t, s, "v!", "EVAL", script, "1", "k", "!")
+
+	// rdb.ExpireWrapScript 中过期命令出错的时候返回 EXPIREFAILED
+	expectReply(t, s, int64(1), "EVAL", rdb.ExpireWrapScript, "1", "h", "4", "HSET", "h", "f", "v", "3", "EXPIRE", "h", "60")
+	reply, _ := s.Do("EVAL", rdb.ExpireWrapScript, "1", "h", "4", "HSET", "h", "f", "w", "3", "EXPIRE", "h", "x").(Error)
+	if !strings.HasPrefix(string(reply), rdb.ExpireFailedReply+" h ERR") {
+		t.Errorf("unexpected expire failure reply %q", reply)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "anything", true},
+		{"user:*:name", "user:1:name", true},
+		{"user:?", "user:12", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+	}
+	for _, c := range cases {
+		if got := matchGlob(c.pattern, c.s); got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v", c.pattern, c.s, got)
+		}
+	}
+}
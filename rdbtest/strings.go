@@ -0,0 +1,327 @@
+package rdbtest
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+func init() {
+	register("GET", 1, cmdGet)
+	register("SET", 2, cmdSet)
+	register("SETNX", 2, func(s *Store, args []string) any {
+		if s.lookup(args[0]) != nil {
+			return int64(0)
+		}
+		s.replace(args[0], args[1])
+		return int64(1)
+	})
+	register("SETEX", 3, setexCmd(time.Second))
+	register("PSETEX", 3, setexCmd(time.Millisecond))
+	register("GETSET", 2, func(s *Store, args []string) any {
+		return cmdSet(s, []string{args[0], args[1], "GET"})
+	})
+	register("GETDEL", 1, cmdGetDel)
+	register("GETEX", 1, cmdGetEx)
+	register("MGET", 1, cmdMGet)
+	register("MSET", 2, cmdMSet)
+	register("MSETNX", 2, cmdMSetNx)
+	register("APPEND", 2, cmdAppend)
+	register("STRLEN", 1, cmdStrlen)
+	register("INCR", 1, func(s *Store, args []string) any { return incrBy(s, args[0], 1) })
+	register("DECR", 1, func(s *Store, args []string) any { return incrBy(s, args[0], -1) })
+	register("INCRBY", 2, incrByCmd(1))
+	register("DECRBY", 2, incrByCmd(-1))
+	register("INCRBYFLOAT", 2, cmdIncrByFloat)
+	register("GETRANGE", 3, cmdGetRange)
+	register("SETRANGE", 3, cmdSetRange)
+}
+
+// getString key 不存在的时候 ok=false
+func getString(s *Store, key string) (string, bool, error) {
+	return lookupAs[string](s, key)
+}
+
+func cmdGet(s *Store, args []string) any {
+	v, ok, err := getString(s, args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// parseExpireOpt 解析 SET/GETEX 的 EX/PX/EXAT/PXAT, 返回过期的时间点
+func (s *Store) parseExpireOpt(opt, arg string) (time.Time, error) {
+	n, err := parseInt(arg)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n <= 0 {
+		return time.Time{}, Error("ERR invalid expire time in '" + strings.ToLower(opt) + "' command")
+	}
+	switch opt {
+	case "EX":
+		return s.clock.Now().Add(time.Duration(n) * time.Second), nil
+	case "PX":
+		return s.clock.Now().Add(time.Duration(n) * time.Millisecond), nil
+	case "EXAT":
+		return time.Unix(n, 0), nil
+	}
+	return time.UnixMilli(n), nil
+}
+
+// cmdSet SET key value [NX|XX] [GET] [EX|PX|EXAT|PXAT|KEEPTTL]
+func cmdSet(s *Store, args []string) any {
+	key, val := args[0], args[1]
+	var nx, xx, get, keep bool
+	var expireAt time.Time
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			keep = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 >= len(args) || !expireAt.IsZero() {
+				return errSyntax
+			}
+			i++
+			var err error
+			if expireAt, err = s.parseExpireOpt(opt, args[i]); err != nil {
+				return err
+			}
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx || keep && !expireAt.IsZero() {
+		return errSyntax
+	}
+	// 没有 GET 的 SET 可以覆盖其他类型的 key
+	e := s.lookup(key)
+	var reply any = Status("OK")
+	if get {
+		old, _, err := getString(s, key)
+		if err != nil {
+			return err
+		}
+		reply = nil
+		if e != nil {
+			reply = old
+		}
+	}
+	if nx && e != nil || xx && e == nil {
+		if get {
+			return reply
+		}
+		return nil
+	}
+	if keep && e != nil {
+		e.value = val
+	} else {
+		s.data[key] = &entry{value: val, expireAt: expireAt}
+	}
+	return reply
+}
+
+func setexCmd(unit time.Duration) func(s *Store, args []string) any {
+	opt := "EX"
+	if unit == time.Millisecond {
+		opt = "PX"
+	}
+	return func(s *Store, args []string) any {
+		return cmdSet(s, []string{args[0], args[2], opt, args[1]})
+	}
+}
+
+func cmdGetDel(s *Store, args []string) any {
+	reply := cmdGet(s, args)
+	if _, ok := reply.(string); ok {
+		delete(s.data, args[0])
+	}
+	return reply
+}
+
+// cmdGetEx GETEX key [EX|PX|EXAT|PXAT|PERSIST]
+func cmdGetEx(s *Store, args []string) any {
+	reply := cmdGet(s, args[:1])
+	if _, ok := reply.(string); !ok {
+		return reply
+	}
+	e := s.lookup(args[0])
+	for i := 1; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "PERSIST":
+			e.expireAt = time.Time{}
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			i++
+			at, err := s.parseExpireOpt(opt, args[i])
+			if err != nil {
+				return err
+			}
+			e.expireAt = at
+		default:
+			return errSyntax
+		}
+	}
+	return reply
+}
+
+// cmdMGet 不存在或者不是字符串的 key 返回 nil
+func cmdMGet(s *Store, args []string) any {
+	out := make([]any, len(args))
+	for i, key := range args {
+		if v, ok, _ := getString(s, key); ok {
+			out[i] = v
+		}
+	}
+	return out
+}
+
+func cmdMSet(s *Store, args []string) any {
+	if len(args)%2 != 0 {
+		return errArgs("MSET")
+	}
+	for i := 0; i < len(args); i += 2 {
+		s.replace(args[i], args[i+1])
+	}
+	return Status("OK")
+}
+
+func cmdMSetNx(s *Store, args []string) any {
+	if len(args)%2 != 0 {
+		return errArgs("MSETNX")
+	}
+	for i := 0; i < len(args); i += 2 {
+		if s.lookup(args[i]) != nil {
+			return int64(0)
+		}
+	}
+	cmdMSet(s, args)
+	return int64(1)
+}
+
+func cmdAppend(s *Store, args []string) any {
+	v, _, err := getString(s, args[0])
+	if err != nil {
+		return err
+	}
+	v += args[1]
+	s.put(args[0], v)
+	return int64(len(v))
+}
+
+func cmdStrlen(s *Store, args []string) any {
+	v, _, err := getString(s, args[0])
+	if err != nil {
+		return err
+	}
+	return int64(len(v))
+}
+
+func incrByCmd(sign int64) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		n, err := parseInt(args[1])
+		if err != nil {
+			return err
+		}
+		return incrBy(s, args[0], sign*n)
+	}
+}
+
+func incrBy(s *Store, key string, by int64) any {
+	v, ok, err := getString(s, key)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if ok {
+		if n, err = parseInt(v); err != nil {
+			return err
+		}
+	}
+	if by > 0 && n > math.MaxInt64-by || by < 0 && n < math.MinInt64-by {
+		return errOverflow
+	}
+	n += by
+	s.put(key, formatInt(n))
+	return n
+}
+
+func cmdIncrByFloat(s *Store, args []string) any {
+	by, err := parseFloat(args[1])
+	if err != nil {
+		return err
+	}
+	v, ok, err := getString(s, args[0])
+	if err != nil {
+		return err
+	}
+	var f float64
+	if ok {
+		if f, err = parseFloat(v); err != nil {
+			return err
+		}
+	}
+	f += by
+	if math.IsInf(f, 0) {
+		return Error("ERR increment would produce NaN or Infinity")
+	}
+	out := formatFloat(f)
+	s.put(args[0], out)
+	return out
+}
+
+func cmdGetRange(s *Store, args []string) any {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	v, _, err := getString(s, args[0])
+	if err != nil {
+		return err
+	}
+	i, j, ok := normRange(start, stop, len(v))
+	if !ok {
+		return ""
+	}
+	return v[i : j+1]
+}
+
+func cmdSetRange(s *Store, args []string) any {
+	offset, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	if offset < 0 {
+		return Error("ERR offset is out of range")
+	}
+	v, _, err := getString(s, args[0])
+	if err != nil {
+		return err
+	}
+	if len(args[2]) == 0 {
+		return int64(len(v))
+	}
+	buf := []byte(v)
+	if end := int(offset) + len(args[2]); end > len(buf) {
+		buf = append(buf, make([]byte, end-len(buf))...)
+	}
+	copy(buf[offset:], args[2])
+	s.put(args[0], string(buf))
+	return int64(len(buf))
+}
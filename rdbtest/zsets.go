@@ -0,0 +1,658 @@
+package rdbtest
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+func init() {
+	register("ZADD", 3, cmdZAdd)
+	register("ZINCRBY", 3, cmdZIncrBy)
+	register("ZREM", 2, cmdZRem)
+	register("ZCARD", 1, cmdZCard)
+	register("ZSCORE", 2, cmdZScore)
+	register("ZMSCORE", 2, cmdZMScore)
+	register("ZRANK", 2, zrankCmd(false))
+	register("ZREVRANK", 2, zrankCmd(true))
+	register("ZCOUNT", 3, zcountCmd(byScore))
+	register("ZLEXCOUNT", 3, zcountCmd(byLex))
+	register("ZRANGE", 3, cmdZRange)
+	register("ZREVRANGE", 3, zrangeCmd(byRank, true))
+	register("ZRANGEBYSCORE", 3, zrangeCmd(byScore, false))
+	register("ZREVRANGEBYSCORE", 3, zrangeCmd(byScore, true))
+	register("ZRANGEBYLEX", 3, zrangeCmd(byLex, false))
+	register("ZREVRANGEBYLEX", 3, zrangeCmd(byLex, true))
+	register("ZREMRANGEBYRANK", 3, zremRangeCmd(byRank))
+	register("ZREMRANGEBYSCORE", 3, zremRangeCmd(byScore))
+	register("ZREMRANGEBYLEX", 3, zremRangeCmd(byLex))
+	register("ZPOPMIN", 1, zpopCmd(false))
+	register("ZPOPMAX", 1, zpopCmd(true))
+	register("ZUNION", 2, zsetOpCmd(opUnion, false))
+	register("ZINTER", 2, zsetOpCmd(opInter, false))
+	register("ZDIFF", 2, zsetOpCmd(opDiff, false))
+	register("ZUNIONSTORE", 3, zsetOpCmd(opUnion, true))
+	register("ZINTERSTORE", 3, zsetOpCmd(opInter, true))
+	register("ZDIFFSTORE", 3, zsetOpCmd(opDiff, true))
+}
+
+type zmember struct {
+	member string
+	score  float64
+}
+
+func getZSet(s *Store, key string) (map[string]float64, error) {
+	z, _, err := lookupAs[map[string]float64](s, key)
+	return z, err
+}
+
+// sortedZ 按分数排序, 分数相同的按成员的字典序
+func sortedZ(z map[string]float64) []zmember {
+	out := make([]zmember, 0, len(z))
+	for m, score := range z {
+		out = append(out, zmember{m, score})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].score != out[j].score {
+			return out[i].score < out[j].score
+		}
+		return out[i].member < out[j].member
+	})
+	return out
+}
+
+func zreply(members []zmember, withScores bool) any {
+	if withScores {
+		out := make(Pairs, 0, 2*len(members))
+		for _, m := range members {
+			out = append(out, m.member, m.score)
+		}
+		return out
+	}
+	out := make([]any, len(members))
+	for i, m := range members {
+		out[i] = m.member
+	}
+	return out
+}
+
+// cmdZAdd ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func cmdZAdd(s *Store, args []string) any {
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	switch {
+	case len(pairs) == 0 || len(pairs)%2 != 0:
+		return errSyntax
+	case nx && xx:
+		return Error("ERR XX and NX options at the same time are not compatible")
+	case gt && lt || nx && (gt || lt):
+		return Error("ERR GT, LT, and/or NX options at the same time are not compatible")
+	case incr && len(pairs) != 2:
+		return Error("ERR INCR option supports a single increment-element pair")
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		f, err := parseFloat(pairs[2*j])
+		if err != nil {
+			return err
+		}
+		scores[j] = f
+	}
+	z, err := getZSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		z = map[string]float64{}
+	}
+	var added, changed int64
+	var result any
+	for j, score := range scores {
+		member := pairs[2*j+1]
+		old, exists := z[member]
+		if nx && exists || xx && !exists {
+			continue
+		}
+		if incr {
+			score += old
+		}
+		if exists && (gt && score <= old || lt && score >= old) {
+			continue
+		}
+		z[member] = score
+		result = score
+		if !exists {
+			added++
+		} else if score != old {
+			changed++
+		}
+	}
+	s.put(args[0], z)
+	if incr {
+		return result
+	}
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZIncrBy(s *Store, args []string) any {
+	by, err := parseFloat(args[1])
+	if err != nil {
+		return err
+	}
+	z, err := getZSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		z = map[string]float64{}
+	}
+	score := z[args[2]] + by
+	if math.IsNaN(score) {
+		return Error("ERR resulting score is not a number (NaN)")
+	}
+	z[args[2]] = score
+	s.put(args[0], z)
+	return score
+}
+
+func cmdZRem(s *Store, args []string) any {
+	z, err := getZSet(s, args[0])
+	if err != nil || z == nil {
+		return orZero(err)
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := z[m]; ok {
+			delete(z, m)
+			n++
+		}
+	}
+	s.put(args[0], z)
+	return n
+}
+
+func cmdZCard(s *Store, args []string) any {
+	z, err := getZSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	return int64(len(z))
+}
+
+func cmdZScore(s *Store, args []string) any {
+	z, err := getZSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	if score, ok := z[args[1]]; ok {
+		return score
+	}
+	return nil
+}
+
+func cmdZMScore(s *Store, args []string) any {
+	z, err := getZSet(s, args[0])
+	if err != nil {
+		return err
+	}
+	out := make([]any, len(args)-1)
+	for i, m := range args[1:] {
+		if score, ok := z[m]; ok {
+			out[i] = score
+		}
+	}
+	return out
+}
+
+func zrankCmd(rev bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		z, err := getZSet(s, args[0])
+		if err != nil {
+			return err
+		}
+		if _, ok := z[args[1]]; !ok {
+			return nil
+		}
+		sorted := sortedZ(z)
+		i := slices.IndexFunc(sorted, func(m zmember) bool { return m.member == args[1] })
+		if rev {
+			i = len(sorted) - 1 - i
+		}
+		return int64(i)
+	}
+}
+
+type rangeKind int
+
+const (
+	byRank rangeKind = iota
+	byScore
+	byLex
+)
+
+// zrange 一次范围查询, start/stop 按 kind 解释为下标、分数或者字典序的区间, 总是从小到大
+type zrange struct {
+	kind          rangeKind
+	start, stop   string
+	rev           bool
+	offset, count int64 // LIMIT, count 小于 0 表示不限制
+	withScores    bool
+}
+
+// selectZ 返回范围内的成员, rev 的时候从大到小
+func (r zrange) selectZ(z map[string]float64) ([]zmember, error) {
+	sorted := sortedZ(z)
+	var out []zmember
+	switch r.kind {
+	case byRank:
+		start, err := parseInt(r.start)
+		if err != nil {
+			return nil, err
+		}
+		stop, err := parseInt(r.stop)
+		if err != nil {
+			return nil, err
+		}
+		if r.rev {
+			slices.Reverse(sorted)
+		}
+		i, j, ok := normRange(start, stop, len(sorted))
+		if !ok {
+			return nil, nil
+		}
+		return sorted[i : j+1], nil
+	case byScore:
+		lo, err := parseScoreBound(r.start)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := parseScoreBound(r.stop)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range sorted {
+			if lo.below(m.score) && hi.above(m.score) {
+				out = append(out, m)
+			}
+		}
+	case byLex:
+		lo, err := parseLexBound(r.start)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := parseLexBound(r.stop)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range sorted {
+			if lo.below(m.member) && hi.above(m.member) {
+				out = append(out, m)
+			}
+		}
+	}
+	if r.rev {
+		slices.Reverse(out)
+	}
+	if r.offset > 0 || r.count >= 0 {
+		if r.offset < 0 || r.offset >= int64(len(out)) {
+			return nil, nil
+		}
+		out = out[r.offset:]
+		if r.count >= 0 && r.count < int64(len(out)) {
+			out = out[:r.count]
+		}
+	}
+	return out, nil
+}
+
+// parseOptions 解析 BYSCORE/BYLEX/REV/LIMIT/WITHSCORES, allowed 以外的选项是语法错误
+func (r *zrange) parseOptions(opts []string, allowed ...string) error {
+	for i := 0; i < len(opts); i++ {
+		opt := strings.ToUpper(opts[i])
+		if !slices.Contains(allowed, opt) {
+			return errSyntax
+		}
+		switch opt {
+		case "BYSCORE":
+			r.kind = byScore
+		case "BYLEX":
+			r.kind = byLex
+		case "REV":
+			r.rev = true
+		case "WITHSCORES":
+			r.withScores = true
+		case "LIMIT":
+			if i+2 >= len(opts) {
+				return errSyntax
+			}
+			var err error
+			if r.offset, err = parseInt(opts[i+1]); err != nil {
+				return err
+			}
+			if r.count, err = parseInt(opts[i+2]); err != nil {
+				return err
+			}
+			i += 2
+		}
+	}
+	if r.kind == byRank && r.count >= 0 {
+		return Error("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if r.kind == byLex && r.withScores {
+		return Error("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return nil
+}
+
+func (r zrange) run(s *Store, key string) any {
+	z, err := getZSet(s, key)
+	if err != nil {
+		return err
+	}
+	members, err := r.selectZ(z)
+	if err != nil {
+		return err
+	}
+	return zreply(members, r.withScores)
+}
+
+// cmdZRange ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func cmdZRange(s *Store, args []string) any {
+	r := zrange{start: args[1], stop: args[2], count: -1}
+	if err := r.parseOptions(args[3:], "BYSCORE", "BYLEX", "REV", "LIMIT", "WITHSCORES"); err != nil {
+		return err
+	}
+	// 按分数和字典序倒序的时候参数是 max min
+	if r.rev && r.kind != byRank {
+		r.start, r.stop = r.stop, r.start
+	}
+	return r.run(s, args[0])
+}
+
+// zrangeCmd ZREVRANGE/ZRANGEBYSCORE/ZREVRANGEBYSCORE/ZRANGEBYLEX/ZREVRANGEBYLEX
+func zrangeCmd(kind rangeKind, rev bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		r := zrange{kind: kind, start: args[1], stop: args[2], rev: rev, count: -1}
+		if rev && kind != byRank {
+			r.start, r.stop = r.stop, r.start
+		}
+		allowed := []string{"WITHSCORES", "LIMIT"}
+		switch kind {
+		case byRank:
+			allowed = allowed[:1]
+		case byLex:
+			allowed = allowed[1:]
+		}
+		if err := r.parseOptions(args[3:], allowed...); err != nil {
+			return err
+		}
+		return r.run(s, args[0])
+	}
+}
+
+func zcountCmd(kind rangeKind) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		z, err := getZSet(s, args[0])
+		if err != nil {
+			return err
+		}
+		members, err := zrange{kind: kind, start: args[1], stop: args[2], count: -1}.selectZ(z)
+		if err != nil {
+			return err
+		}
+		return int64(len(members))
+	}
+}
+
+func zremRangeCmd(kind rangeKind) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		z, err := getZSet(s, args[0])
+		if err != nil || z == nil {
+			return orZero(err)
+		}
+		members, err := zrange{kind: kind, start: args[1], stop: args[2], count: -1}.selectZ(z)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			delete(z, m.member)
+		}
+		s.put(args[0], z)
+		return int64(len(members))
+	}
+}
+
+// zpopCmd ZPOPMIN/ZPOPMAX key [count]
+func zpopCmd(highest bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		count := int64(1)
+		if len(args) > 1 {
+			var err error
+			if count, err = parseInt(args[1]); err != nil || count < 0 {
+				return Error("ERR value is out of range, must be positive")
+			}
+		}
+		z, err := getZSet(s, args[0])
+		if err != nil {
+			return err
+		}
+		sorted := sortedZ(z)
+		if highest {
+			slices.Reverse(sorted)
+		}
+		sorted = sorted[:min(int(count), len(sorted))]
+		for _, m := range sorted {
+			delete(z, m.member)
+		}
+		if z != nil {
+			s.put(args[0], z)
+		}
+		return zreply(sorted, true)
+	}
+}
+
+// zsetOpCmd ZUNION/ZINTER/ZDIFF numkeys key... [WEIGHTS w...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+// store 为 true 的时候第一个参数是目标 key, 返回结果的成员数; set 作为输入的时候分数为 1
+func zsetOpCmd(op setOpKind, store bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		var dest string
+		if store {
+			dest, args = args[0], args[1:]
+		}
+		numKeys, err := parseInt(args[0])
+		if err != nil {
+			return err
+		}
+		if numKeys <= 0 || int(numKeys) >= len(args) {
+			return errSyntax
+		}
+		keys, opts := args[1:numKeys+1], args[numKeys+1:]
+		weights := make([]float64, len(keys))
+		for i := range weights {
+			weights[i] = 1
+		}
+		aggregate, withScores := "SUM", false
+		for i := 0; i < len(opts); i++ {
+			switch strings.ToUpper(opts[i]) {
+			case "WEIGHTS":
+				if op == opDiff || i+len(keys) >= len(opts) {
+					return errSyntax
+				}
+				for j := range weights {
+					if weights[j], err = parseFloat(opts[i+1+j]); err != nil {
+						return Error("ERR weight value is not a float")
+					}
+				}
+				i += len(keys)
+			case "AGGREGATE":
+				if op == opDiff || i+1 >= len(opts) {
+					return errSyntax
+				}
+				i++
+				aggregate = strings.ToUpper(opts[i])
+				if aggregate != "SUM" && aggregate != "MIN" && aggregate != "MAX" {
+					return errSyntax
+				}
+			case "WITHSCORES":
+				if store {
+					return errSyntax
+				}
+				withScores = true
+			default:
+				return errSyntax
+			}
+		}
+		var out map[string]float64
+		for i, key := range keys {
+			z, err := zsetInput(s, key)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				out = make(map[string]float64, len(z))
+				for m, score := range z {
+					out[m] = score * weights[0]
+				}
+				continue
+			}
+			for m, score := range out {
+				other, ok := z[m]
+				switch {
+				case op == opInter && !ok, op == opDiff && ok:
+					delete(out, m)
+				case op != opDiff && ok:
+					out[m] = aggregateScore(aggregate, score, other*weights[i])
+				}
+			}
+			if op == opUnion {
+				for m, score := range z {
+					if _, ok := out[m]; !ok {
+						out[m] = score * weights[i]
+					}
+				}
+			}
+		}
+		if store {
+			s.replace(dest, out)
+			return int64(len(out))
+		}
+		return zreply(sortedZ(out), withScores)
+	}
+}
+
+// zsetInput ZUNION 这类命令的输入可以是 zset 或者 set
+func zsetInput(s *Store, key string) (map[string]float64, error) {
+	e := s.lookup(key)
+	if e == nil {
+		return nil, nil
+	}
+	switch v := e.value.(type) {
+	case map[string]float64:
+		return v, nil
+	case map[string]struct{}:
+		z := make(map[string]float64, len(v))
+		for m := range v {
+			z[m] = 1
+		}
+		return z, nil
+	}
+	return nil, errWrongType
+}
+
+func aggregateScore(aggregate string, a, b float64) float64 {
+	switch aggregate {
+	case "MIN":
+		return math.Min(a, b)
+	case "MAX":
+		return math.Max(a, b)
+	}
+	return a + b
+}
+
+// scoreBound 分数区间的一端, 例如 1.5、(1.5、-inf、+inf
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+func parseScoreBound(v string) (scoreBound, error) {
+	var b scoreBound
+	if strings.HasPrefix(v, "(") {
+		b.exclusive, v = true, v[1:]
+	}
+	f, err := parseFloat(v)
+	if err != nil {
+		return b, errMinMax
+	}
+	b.value = f
+	return b, nil
+}
+
+// below 作为下界的时候 score 在区间内
+func (b scoreBound) below(score float64) bool {
+	return score > b.value || !b.exclusive && score == b.value
+}
+
+// above 作为上界的时候 score 在区间内
+func (b scoreBound) above(score float64) bool {
+	return score < b.value || !b.exclusive && score == b.value
+}
+
+// lexBound 字典序区间的一端, 例如 [a、(a、-、+
+type lexBound struct {
+	value     string
+	exclusive bool
+	inf       int // -1 为 -, 1 为 +
+}
+
+func parseLexBound(v string) (lexBound, error) {
+	switch {
+	case v == "-":
+		return lexBound{inf: -1}, nil
+	case v == "+":
+		return lexBound{inf: 1}, nil
+	case strings.HasPrefix(v, "["):
+		return lexBound{value: v[1:]}, nil
+	case strings.HasPrefix(v, "("):
+		return lexBound{value: v[1:], exclusive: true}, nil
+	}
+	return lexBound{}, errLex
+}
+
+func (b lexBound) below(member string) bool {
+	if b.inf != 0 {
+		return b.inf < 0
+	}
+	return member > b.value || !b.exclusive && member == b.value
+}
+
+func (b lexBound) above(member string) bool {
+	if b.inf != 0 {
+		return b.inf > 0
+	}
+	return member < b.value || !b.exclusive && member == b.value
+}
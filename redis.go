@@ -22,6 +22,18 @@ type Config struct {
 	MinIdle     int    `json:"minIdle" yaml:"minIdle"`
 	IdleTimeout int    `json:"idleTimeout" yaml:"idleTimeout"`
 	PoolSize    int    `json:"poolSize" yaml:"poolSize"`
+	KeyPrefix   string `json:"keyPrefix" yaml:"keyPrefix"`   // 所有 key 的前缀, 可以用 WithKeyPrefix 在 ctx 上覆盖
+	CmdTimeout  int    `json:"cmdTimeout" yaml:"cmdTimeout"` // 命令默认的超时时间, 毫秒, RdSubCmd.Timeout/LuaScript.Timeout 没有设置的时候使用, 为 0 时没有 deadline 的命令使用 3s
+	// DisableContextTimeout 读写连接的时候不使用 ctx 的 deadline, 和 go-redis 默认一样使用 3s 的读写超时
+	// 关闭之后 RdSubCmd.Timeout/LuaScript.Timeout/CmdTimeout 和调用方 ctx 的 deadline 都不能打断阻塞的读写, 也不能超过 3s
+	DisableContextTimeout bool `json:"disableContextTimeout" yaml:"disableContextTimeout"`
+	// CmdLimits 按命令名限流, 例如 {"KEYS": {rps: 1}}; KeyLimits 按 RdCmd.Key 模板限流, 例如 {"user:{{userId}}:wealth": {concurrency: 10}}
+	// 对直接执行、自动 pipeline 和 Batch 中的命令生效, Batch 中每个命令消耗各自的 RPS, 并发数按 pipeline 计算;
+	// ExecScript 按命令名 EVALSHA/EVAL 限流, 显式的 pipeline/事务不受限制
+	CmdLimits map[string]Limit `json:"cmdLimits" yaml:"cmdLimits"`
+	KeyLimits map[string]Limit `json:"keyLimits" yaml:"keyLimits"`
+	// RedactParams Explain 中需要隐藏值的参数名, 为 nil 的时候使用 DefaultRedactParams
+	RedactParams []string `json:"redactParams" yaml:"redactParams"`
 }
 
 type RedisClient struct {
@@ -29,28 +41,50 @@ type RedisClient struct {
 	builder
 	Config Config
 	Client *redis.Client
+	// OnExpireError 设置过期时间失败的回调, 为 nil 时使用 slog 记录
+	OnExpireError ExpireErrorHook
+	autoPipe      *autoPipeliner // EnableAutoPipeline 开启
+	// Breaker 用 UseBreaker 设置的熔断器, 可以用来查看状态
+	Breaker *Breaker
+	limits  *limiterSet // Config 和 RdSubCmd 中的限流规则
 }
 
 func NewRedisClient(config Config) *RedisClient {
-	client := RedisClient{Client: initRedis(config), Config: config}
-	client.builder = client.Handler // Handler 现在返回 *CommandBuilder
-	client.lua = client.ExecScript
-	return &client
+	client := &RedisClient{Client: initRedis(config), Config: config}
+	client.setup()
+	return client
+}
+
+// NewRedisClientWith 使用已经创建好的 go-redis client, 不会再连接和 Ping
+// 用于自己配置 redis.Options、提前添加 hook, 或者接入 rdbtest 这样的测试替身
+// 需要 RdSubCmd.Timeout/Config.CmdTimeout 生效的时候 redis.Options 要打开 ContextTimeoutEnabled, 超过 3s 的还要把 ReadTimeout/WriteTimeout
+// 设置为 -1, 这时没有 deadline 的命令不会超时; Config.DisableContextTimeout 和默认的超时时间在这里不起作用
+// redis.Options.MaxRetries 要设置为 -1 关闭 go-redis 自己的重试, 否则读超时或者连接断开的命令会被再次发送,
+// 包括非幂等的写命令, 而且不受 RetryPolicy 和 Idempotent 控制, Attempts 也不准确
+func NewRedisClientWith(c *redis.Client, config Config) *RedisClient {
+	client := &RedisClient{Client: c, Config: config}
+	client.setup()
+	return client
+}
+
+// setup 按 Config 创建限流规则, 并绑定 builder 和 lua, 通过指针调用 Handler/ExecScript
+// 这样创建之后再设置的 OnExpireError、EnableAutoPipeline 等对 HGet、Set 这些方法也生效
+func (rdm *RedisClient) setup() {
+	rdm.limits = newLimiterSet(rdm.Config)
+	rdm.builder = func(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) *CommandBuilder {
+		return rdm.Handler(ctx, cmd, cmdName, args, includeArgs...)
+	}
+	rdm.lua = func(ctx context.Context, lua LuaScript, keyInfo map[string]string, valueInfo map[string]any) *redis.Cmd {
+		return rdm.ExecScript(ctx, lua, keyInfo, valueInfo)
+	}
 }
 
 func initRedis(c Config) *redis.Client {
 	slog.Info("redisDb connect", "info", c)
-	addr := c.Host + ":" + c.Port
-	redisOpt := &redis.Options{
-		Addr:         addr,
-		Password:     c.Password,
-		Username:     c.UserName,
-		DB:           c.Db,
-		PoolSize:     c.PoolSize,
-		MaxIdleConns: c.MaxIdle,
-		MinIdleConns: c.MinIdle,
+	rdb := redis.NewClient(redisOptions(c))
+	if !c.DisableContextTimeout {
+		rdb.AddHook(deadlineHook{timeout: defaultTimeout(c)})
 	}
-	rdb := redis.NewClient(redisOpt)
 	//rdb.AddHook(RKParesHook{})
 	cmd := rdb.Ping(context.Background())
 	if cmd.Err() != nil {
@@ -60,6 +94,26 @@ func initRedis(c Config) *redis.Client {
 	return rdb
 }
 
+func redisOptions(c Config) *redis.Options {
+	opts := &redis.Options{
+		Addr:         c.Host + ":" + c.Port,
+		Password:     c.Password,
+		Username:     c.UserName,
+		DB:           c.Db,
+		PoolSize:     c.PoolSize,
+		MaxIdleConns: c.MaxIdle,
+		MinIdleConns: c.MinIdle,
+		// 重试只由 RetryPolicy 控制, go-redis 默认会重新发送读超时和连接断开的命令, 即使是非幂等的写命令
+		MaxRetries: -1,
+	}
+	// 读写的超时完全由 ctx 的 deadline 决定, 这样 RdSubCmd.Timeout 比 3s 长也能生效; 没有 deadline 的命令由 deadlineHook 加上默认值
+	if !c.DisableContextTimeout {
+		opts.ContextTimeoutEnabled = true
+		opts.ReadTimeout, opts.WriteTimeout = -1, -1
+	}
+	return opts
+}
+
 func (rdm RedisClient) RedisClose() {
 	err := rdm.Client.Close()
 	if err != nil {
@@ -72,9 +126,15 @@ func (rdm RedisClient) RedisClose() {
 func (rdm RedisClient) Handler(ctx context.Context, cmd RdCmd, cmdName Command, args map[string]any, includeArgs ...any) *CommandBuilder {
 	// 返回 CommandBuilder，支持链式调用
 	// CommandBuilder 实现了 redis.Cmder 接口，可以直接作为 redis.Cmder 使用
+	ctx = withDefaultKeyPrefix(ctx, rdm.Config.KeyPrefix)
 	return NewCommandBuilder(&rdm, ctx, cmd, cmdName, args, includeArgs...)
 }
 
 func (rdm RedisClient) PipeLine() *RedisPipeline {
 	return newPipeline(rdm)
 }
+
+// TxPipeLine 事务, 用法和 PipeLine 一样, Exec 的时候所有命令在 MULTI/EXEC 中执行
+func (rdm RedisClient) TxPipeLine() *RedisPipeline {
+	return newTxPipeline(rdm)
+}
@@ -0,0 +1,99 @@
+package rdb
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry 按名字保存 RdCmd 和 LuaScript 定义, 可以从配置文件加载, 也可以在代码里注册
+type Registry struct {
+	mu   sync.RWMutex
+	cmds map[string]RdCmd
+	luas map[string]LuaScript
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		cmds: map[string]RdCmd{},
+		luas: map[string]LuaScript{},
+	}
+}
+
+// Register 注册一个 RdCmd, 名字重复会返回错误
+func (r *Registry) Register(name string, cmd RdCmd) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.cmds[name]; ok {
+		return fmt.Errorf("rdb: cmd %s already registered", name)
+	}
+	r.cmds[name] = cmd
+	return nil
+}
+
+// RegisterLua 注册一个 LuaScript, 名字重复会返回错误
+func (r *Registry) RegisterLua(name string, lua LuaScript) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.luas[name]; ok {
+		return fmt.Errorf("rdb: lua %s already registered", name)
+	}
+	r.luas[name] = lua
+	return nil
+}
+
+func (r *Registry) Cmd(name string) (RdCmd, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cmd, ok := r.cmds[name]
+	return cmd, ok
+}
+
+// MustCmd 获取 RdCmd, 不存在的时候 panic, 适合在包初始化的时候使用
+func (r *Registry) MustCmd(name string) RdCmd {
+	cmd, ok := r.Cmd(name)
+	if !ok {
+		panic(fmt.Errorf("rdb: cmd %s not registered", name))
+	}
+	return cmd
+}
+
+func (r *Registry) Lua(name string) (LuaScript, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	lua, ok := r.luas[name]
+	return lua, ok
+}
+
+// MustLua 获取 LuaScript, 不存在的时候 panic
+func (r *Registry) MustLua(name string) LuaScript {
+	lua, ok := r.Lua(name)
+	if !ok {
+		panic(fmt.Errorf("rdb: lua %s not registered", name))
+	}
+	return lua
+}
+
+// CmdNames 返回所有 RdCmd 的名字, 已排序
+func (r *Registry) CmdNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.cmds))
+	for name := range r.cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LuaNames 返回所有 LuaScript 的名字, 已排序
+func (r *Registry) LuaNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.luas))
+	for name := range r.luas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,127 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RetryClass 可以重试的错误类型, 可以组合
+type RetryClass uint8
+
+const (
+	RetryNetwork     RetryClass = 1 << iota // 网络错误: 连接断开、读写超时等, 不包括 ctx 取消
+	RetryLoading                            // LOADING, redis 正在加载数据
+	RetryTryAgain                           // TRYAGAIN, 集群迁移 slot 过程中的多 key 命令
+	RetryBusy                               // BUSY, 有 lua 脚本正在执行
+	RetryClusterDown                        // CLUSTERDOWN
+	// RetryTransient 默认的临时错误
+	RetryTransient = RetryNetwork | RetryLoading | RetryTryAgain | RetryBusy | RetryClusterDown
+)
+
+// RetryPolicy 遇到临时错误的重试策略, 只对直接执行的命令生效, pipeline/事务中的命令由调用方处理
+// 非幂等的命令 (没有设置 Idempotent 的 RdSubCmd/LuaScript) 默认不会重试, 因为失败的请求可能已经在 redis 中执行了
+// NewRedisClient 创建的 client 关闭了 go-redis 自己的重试 (MaxRetries: -1), 所有的重试都在这里, Attempts 是真实的发送次数
+type RetryPolicy struct {
+	MaxAttempts        int           // 包括第一次在内最多执行几次, 小于 2 不重试
+	Backoff            time.Duration // 第一次重试前的等待时间, 之后每次翻倍, 默认 10ms
+	MaxBackoff         time.Duration // 等待时间的上限, 默认 1s
+	Jitter             float64       // 等待时间的随机抖动比例, 0.2 表示 ±20%
+	On                 RetryClass    // 可以重试的错误, 默认 RetryTransient
+	AllowNonIdempotent bool          // 非幂等的命令也重试
+}
+
+// Retryable 判断 err 是否属于可以重试的错误
+func (c RetryClass) Retryable(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch {
+	case redis.HasErrorPrefix(err, "LOADING"):
+		return c&RetryLoading != 0
+	case redis.HasErrorPrefix(err, "TRYAGAIN"):
+		return c&RetryTryAgain != 0
+	case redis.HasErrorPrefix(err, "BUSY "): // 不包括 BUSYGROUP、BUSYKEY
+		return c&RetryBusy != 0
+	case redis.HasErrorPrefix(err, "CLUSTERDOWN"):
+		return c&RetryClusterDown != 0
+	}
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return c&RetryNetwork != 0
+	}
+	return false
+}
+
+// backoff 第 n 次重试前的等待时间, n 从 1 开始
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d, limit := p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = 10 * time.Millisecond
+	}
+	if limit <= 0 {
+		limit = time.Second
+	}
+	for i := 1; i < n && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	if p.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// retryFor 命令实际使用的策略, 不需要重试的时候返回 nil
+func retryFor(p *RetryPolicy, idempotent bool) *RetryPolicy {
+	if p == nil || p.MaxAttempts < 2 || (!idempotent && !p.AllowNonIdempotent) {
+		return nil
+	}
+	return p
+}
+
+// do 执行 fn, 遇到可以重试的错误按照策略重试, 返回执行的次数和最后一次的错误
+// p 为 nil 的时候只执行一次; ctx 取消的时候不再重试
+func (p *RetryPolicy) do(ctx context.Context, fn func() error) (int, error) {
+	attempts := 1
+	err := fn()
+	if p != nil {
+		on := p.On
+		if on == 0 {
+			on = RetryTransient
+		}
+		for attempts < p.MaxAttempts && on.Retryable(err) {
+			timer := time.NewTimer(p.backoff(attempts))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				recordAttempts(ctx, attempts)
+				return attempts, err
+			case <-timer.C:
+			}
+			attempts++
+			err = fn()
+		}
+	}
+	recordAttempts(ctx, attempts)
+	return attempts, err
+}
+
+type attemptsKey struct{}
+
+// WithAttempts 返回记录执行次数的 ctx, 用于 ExecScript、ExecuteCmd 这类返回 go-redis Cmd 的方法
+// 使用这个 ctx 直接执行之后 *attempts 为最后一个命令实际执行的次数, CommandBuilder 可以直接用 Attempts()
+func WithAttempts(ctx context.Context, attempts *int) context.Context {
+	return context.WithValue(ctx, attemptsKey{}, attempts)
+}
+
+func recordAttempts(ctx context.Context, attempts int) {
+	if p, ok := ctx.Value(attemptsKey{}).(*int); ok && p != nil {
+		*p = attempts
+	}
+}
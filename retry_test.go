@@ -0,0 +1,106 @@
+package rdb
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// serverErr 模拟 redis 返回的错误
+type serverErr string
+
+func (e serverErr) Error() string { return string(e) }
+func (serverErr) RedisError()     {}
+
+func TestRetryClass_Retryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		on   RetryClass
+		want bool
+	}{
+		{serverErr("LOADING Redis is loading the dataset in memory"), RetryTransient, true},
+		{serverErr("TRYAGAIN Multiple keys request during rehashing of slot"), RetryTransient, true},
+		{serverErr("BUSY Redis is busy running a script"), RetryTransient, true},
+		{serverErr("BUSYGROUP Consumer Group name already exists"), RetryTransient, false},
+		{serverErr("WRONGTYPE Operation against a key holding the wrong kind of value"), RetryTransient, false},
+		{serverErr("LOADING Redis is loading the dataset in memory"), RetryNetwork, false},
+		{io.EOF, RetryNetwork, true},
+		{io.EOF, RetryLoading, false},
+		{redis.Nil, RetryTransient, false},
+		{context.DeadlineExceeded, RetryTransient, false},
+		{nil, RetryTransient, false},
+	}
+	for _, tt := range tests {
+		if got := tt.on.Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for n, want := range map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond, 3: 40 * time.Millisecond, 4: 50 * time.Millisecond, 9: 50 * time.Millisecond} {
+		if got := p.backoff(n); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", n, got, want)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(1); d < 5*time.Millisecond || d > 15*time.Millisecond {
+			t.Fatalf("jitter out of range: %v", d)
+		}
+	}
+}
+
+func TestCommandBuilder_Retry(t *testing.T) {
+	failures := 0
+	client, hook := newReplyClient(func(args []any) (any, error) {
+		if failures > 0 {
+			failures--
+			return nil, serverErr("LOADING Redis is loading the dataset in memory")
+		}
+		return "v", nil
+	})
+	retry := &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	str := RdCmd{Key: "s:{{id}}", CMD: map[Command]RdSubCmd{
+		GET:  {Idempotent: true, Retry: retry},
+		INCR: {Retry: retry},
+	}}
+	ctx := context.Background()
+
+	failures = 2
+	cb := client.Handler(ctx, str, GET, map[string]any{"id": 1})
+	if v := cb.String().Val(); v != "v" || cb.Attempts() != 3 || len(hook.calls) != 3 {
+		t.Errorf("expected success after 3 attempts, got %q %d %v", v, cb.Attempts(), hook.calls)
+	}
+
+	failures = 3
+	cb = client.Handler(ctx, str, GET, map[string]any{"id": 1})
+	if err := cb.Err(); !redis.HasErrorPrefix(err, "LOADING") || cb.Attempts() != 3 {
+		t.Errorf("expected last error after 3 attempts, got %v %d", err, cb.Attempts())
+	}
+
+	// 非幂等的写命令不重试
+	failures = 1
+	cb = client.Handler(ctx, str, INCR, map[string]any{"id": 1})
+	if err := cb.Err(); err == nil || cb.Attempts() != 1 {
+		t.Errorf("non-idempotent command should not retry, got %v %d", err, cb.Attempts())
+	}
+	retry.AllowNonIdempotent = true
+	failures = 1
+	cb = client.Handler(ctx, str, INCR, map[string]any{"id": 1})
+	if err := cb.Err(); err != nil || cb.Attempts() != 2 {
+		t.Errorf("expected retry when allowed, got %v %d %v", err, cb.Attempts(), hook.calls)
+	}
+
+	// ExecScript 通过 ctx 记录次数
+	failures = 1
+	var attempts int
+	lua := LuaScript{Script: "return 1", Idempotent: true, Retry: &RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}}
+	if err := client.ExecScript(WithAttempts(ctx, &attempts), lua, nil, nil).Err(); err != nil || attempts != 2 {
+		t.Errorf("expected script retry, got %v %d", err, attempts)
+	}
+}
@@ -0,0 +1,96 @@
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 集群模式下 key 的 slot 计算, 与 redis 服务端的算法保持一致
+
+const clusterSlots = 16384
+
+// ErrCrossSlot 多 key 命令或 lua 脚本的 key 不在同一个 slot 中, 在发送给 redis 之前就会被拒绝
+var ErrCrossSlot = errors.New("rdb: keys in request don't hash to the same slot")
+
+var crc16Table [256]uint16
+
+func init() {
+	// CRC16-CCITT (XMODEM), 多项式 0x1021
+	for i := 0; i < 256; i++ {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^key[i]]
+	}
+	return crc
+}
+
+// HashTag 返回 key 中参与 slot 计算的部分
+// 第一个 '{' 与其后第一个 '}' 之间的内容非空时只用这部分计算, 否则使用整个 key
+func HashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start == -1 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+// KeySlot 计算 key 所在的集群 slot
+func KeySlot(key string) int {
+	return int(crc16(HashTag(key)) % clusterSlots)
+}
+
+// checkSlots 校验所有 key 是否落在同一个 slot
+func checkSlots(keys []string) error {
+	if len(keys) < 2 {
+		return nil
+	}
+	slot := KeySlot(keys[0])
+	for _, k := range keys[1:] {
+		if s := KeySlot(k); s != slot {
+			return fmt.Errorf("%w: %s(slot %d) %s(slot %d)", ErrCrossSlot, keys[0], slot, k, s)
+		}
+	}
+	return nil
+}
+
+// checkCmdSlots 根据命令的 key 位置取出所有 key 做 slot 校验
+func checkCmdSlots(cmdName Command, cmdArgs []any) error {
+	idx := keyIndexes(cmdName, cmdArgs)
+	if len(idx) < 2 {
+		return nil
+	}
+	keys := make([]string, 0, len(idx))
+	for _, i := range idx {
+		keys = append(keys, argString(cmdArgs[i]))
+	}
+	return checkSlots(keys)
+}
+
+func argString(v any) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	default:
+		return fmt.Sprint(s)
+	}
+}
@@ -0,0 +1,59 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestKeySlot(t *testing.T) {
+	// 与 CLUSTER KEYSLOT 的结果对照
+	tests := map[string]int{
+		"foo":               12182,
+		"bar":               5061,
+		"123456789":         12739,
+		"{user1000}.follow": KeySlot("user1000"),
+		"foo{}{bar}":        KeySlot("foo{}{bar}"),
+		"foo{{bar}}zap":     KeySlot("{bar"),
+	}
+	for key, want := range tests {
+		if got := KeySlot(key); got != want {
+			t.Errorf("KeySlot(%s) = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestBuild_HashTag(t *testing.T) {
+	walletCmd := RdCmd{
+		Key:     "user:{{userId}}:wallet",
+		HashTag: "userId",
+		CMD: map[Command]RdSubCmd{
+			SMOVE:       {Params: "{{dest}} {{member}}"},
+			SUNIONSTORE: {Params: "{{src}}"},
+		},
+	}
+
+	cmdArgs, key, _, err := build(context.Background(), walletCmd, SMOVE, map[string]any{
+		"userId": 42, "dest": "user:{42}:frozen", "member": "coin",
+	})
+	if err != nil {
+		t.Fatalf("same slot should pass: %v", err)
+	}
+	if key != "user:{42}:wallet" || cmdArgs[2] != "user:{42}:frozen" {
+		t.Errorf("unexpected args %v", cmdArgs)
+	}
+
+	_, _, _, err = build(context.Background(), walletCmd, SUNIONSTORE, map[string]any{
+		"userId": 42, "src": "user:{43}:wallet",
+	})
+	if !errors.Is(err, ErrCrossSlot) {
+		t.Errorf("expected ErrCrossSlot, got %v", err)
+	}
+}
+
+func Test_highPerfReplace_HashTag(t *testing.T) {
+	got, _ := highPerfReplace([]byte("user:{{{userId}}}:{{missing}}:x"), map[string]any{"userId": 7})
+	if string(got) != "user:{7}:{{missing}}:x" {
+		t.Errorf("got %s", got)
+	}
+}
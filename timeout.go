@@ -0,0 +1,78 @@
+package rdb
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// withCmdTimeout 返回单次执行使用的 ctx, timeout 没有设置的时候使用 client 的默认值 (Config.CmdTimeout), 都没有的时候不改变 ctx
+// context.WithTimeout 会保留调用方更早的 deadline, 所以两者取较短的那个
+func withCmdTimeout(ctx context.Context, timeout time.Duration, config Config) (context.Context, context.CancelFunc) {
+	if timeout = cmdTimeout(timeout, config); timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// cmdTimeout 子命令的超时时间, 没有设置的时候使用 Config.CmdTimeout, 都没有的时候为 0
+func cmdTimeout(timeout time.Duration, config Config) time.Duration {
+	if timeout <= 0 {
+		timeout = time.Duration(config.CmdTimeout) * time.Millisecond
+	}
+	return timeout
+}
+
+// defaultReadTimeout go-redis 默认的读写超时
+const defaultReadTimeout = 3 * time.Second
+
+// defaultTimeout 没有 deadline 的命令使用的超时时间, Config.CmdTimeout 没有设置的时候和 go-redis 默认的读写超时一样
+func defaultTimeout(config Config) time.Duration {
+	if timeout := cmdTimeout(0, config); timeout > 0 {
+		return timeout
+	}
+	return defaultReadTimeout
+}
+
+// blockingCommands 阻塞的命令由命令自己的参数决定等待多久, deadlineHook 不给它们加默认的超时
+var blockingCommands = commandSet(BLPOP, BRPOP, BRPOPLPUSH, BLMOVE, BLMPOP, BZPOPMIN, BZPOPMAX, BZMPOP, XREAD, XREADGROUP)
+
+// deadlineHook NewRedisClient 关闭了 ReadTimeout/WriteTimeout, 读写只受 ctx 的 deadline 控制
+// 这个 hook 给没有 deadline 的命令加上默认的超时, 直接使用 Client 执行的命令也一样, 阻塞的命令除外
+type deadlineHook struct {
+	timeout time.Duration
+}
+
+func (h deadlineHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h deadlineHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, cancel := h.withDeadline(ctx, cmd)
+		defer cancel()
+		return next(ctx, cmd)
+	}
+}
+
+func (h deadlineHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, cancel := h.withDeadline(ctx, cmds...)
+		defer cancel()
+		return next(ctx, cmds)
+	}
+}
+
+func (h deadlineHook) withDeadline(ctx context.Context, cmds ...redis.Cmder) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	for _, cmd := range cmds {
+		if blockingCommands[Command(strings.ToUpper(cmd.Name()))] {
+			return ctx, func() {}
+		}
+	}
+	return context.WithTimeout(ctx, h.timeout)
+}
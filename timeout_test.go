@@ -0,0 +1,83 @@
+package rdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestWithCmdTimeout(t *testing.T) {
+	remaining := func(ctx context.Context) time.Duration {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return 0
+		}
+		return time.Until(deadline).Round(time.Second)
+	}
+	bg := context.Background()
+
+	ctx, cancel := withCmdTimeout(bg, 0, Config{})
+	defer cancel()
+	if ctx != bg {
+		t.Error("ctx should be unchanged without timeout")
+	}
+	ctx, cancel = withCmdTimeout(bg, 0, Config{CmdTimeout: 2000})
+	defer cancel()
+	if remaining(ctx) != 2*time.Second {
+		t.Errorf("expected client default, got %v", remaining(ctx))
+	}
+	ctx, cancel = withCmdTimeout(bg, 5*time.Second, Config{CmdTimeout: 2000})
+	defer cancel()
+	if remaining(ctx) != 5*time.Second {
+		t.Errorf("command timeout should override default, got %v", remaining(ctx))
+	}
+
+	// 调用方更早的 deadline 优先
+	parent, cancelParent := context.WithTimeout(bg, time.Second)
+	defer cancelParent()
+	ctx, cancel = withCmdTimeout(parent, 5*time.Second, Config{})
+	defer cancel()
+	if remaining(ctx) != time.Second {
+		t.Errorf("caller deadline should win, got %v", remaining(ctx))
+	}
+}
+
+func Test_redisOptions_ContextTimeout(t *testing.T) {
+	opts := redisOptions(Config{})
+	if !opts.ContextTimeoutEnabled || opts.ReadTimeout != -1 || opts.WriteTimeout != -1 {
+		t.Errorf("ctx deadlines should control reads and writes, got %v %v %v", opts.ContextTimeoutEnabled, opts.ReadTimeout, opts.WriteTimeout)
+	}
+	opts = redisOptions(Config{DisableContextTimeout: true})
+	if opts.ContextTimeoutEnabled || opts.ReadTimeout != 0 || opts.WriteTimeout != 0 {
+		t.Errorf("go-redis defaults expected, got %v %v %v", opts.ContextTimeoutEnabled, opts.ReadTimeout, opts.WriteTimeout)
+	}
+	for _, config := range []Config{{}, {DisableContextTimeout: true}} {
+		if opts := redisOptions(config); opts.MaxRetries != -1 {
+			t.Errorf("%+v: go-redis retries should be disabled, got MaxRetries %d", config, opts.MaxRetries)
+		}
+	}
+}
+
+func Test_deadlineHook(t *testing.T) {
+	h := deadlineHook{timeout: defaultTimeout(Config{})}
+	bg := context.Background()
+
+	ctx, cancel := h.withDeadline(bg, redis.NewCmd(bg, "get", "k"))
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline).Round(time.Second) != 3*time.Second {
+		t.Errorf("expected the default timeout, got %v", deadline)
+	}
+	parent, cancelParent := context.WithTimeout(bg, 10*time.Second)
+	defer cancelParent()
+	if ctx, _ := h.withDeadline(parent, redis.NewCmd(bg, "get", "k")); ctx != parent {
+		t.Error("caller deadline should be kept")
+	}
+	if ctx, _ := h.withDeadline(bg, redis.NewCmd(bg, "get", "k"), redis.NewCmd(bg, "blpop", "k", 0)); ctx != bg {
+		t.Error("blocking commands should not get a default timeout")
+	}
+	if d := defaultTimeout(Config{CmdTimeout: 500}); d != 500*time.Millisecond {
+		t.Errorf("CmdTimeout should be the default, got %v", d)
+	}
+}